@@ -0,0 +1,121 @@
+package audit
+
+import (
+	"car-rental/entity"
+	"car-rental/utils"
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// Actions.
+const (
+	Create = "create"
+	Update = "update"
+	Delete = "delete"
+)
+
+// Audited resources. Wallet entries are keyed by user ID.
+const (
+	Users    = "user"
+	Products = "product"
+	Records  = "record"
+	Wallet   = "wallet"
+)
+
+// Actor is who made a change and from where.
+type Actor struct {
+	UserID    *uint
+	Role      string
+	IP        string
+	RequestID string
+}
+
+// ActorFrom reads the actor from the JWT claims of the request. Requests
+// without a valid token, such as a registration, have no user.
+func ActorFrom(c echo.Context) Actor {
+	actor := Actor{
+		Role:      "anonymous",
+		IP:        c.RealIP(),
+		RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+	}
+	claims, err := utils.DecodeToken(c)
+	if err != nil {
+		return actor
+	}
+	if id, ok := claims["userID"].(float64); ok {
+		userID := uint(id)
+		actor.UserID = &userID
+	}
+	if role, ok := claims["userRole"].(string); ok {
+		actor.Role = role
+	}
+	return actor
+}
+
+// Log records an immutable entry inside tx, so it is only kept if the change
+// is committed. before is nil for a create and after is nil for a delete.
+// Updates that changed nothing are skipped.
+func Log(tx *gorm.DB, actor Actor, action, resource string, id uint, before, after any) error {
+	entry := entity.AuditEntry{
+		ActorID:    actor.UserID,
+		ActorRole:  actor.Role,
+		Action:     action,
+		Resource:   resource,
+		ResourceID: id,
+		IP:         actor.IP,
+		RequestID:  actor.RequestID,
+	}
+	var err error
+	if entry.Before, err = snapshot(before); err != nil {
+		return err
+	}
+	if entry.After, err = snapshot(after); err != nil {
+		return err
+	}
+	entry.Changed = changed(entry.Before, entry.After)
+	if action == Update && len(entry.Changed) == 0 {
+		return nil
+	}
+	return tx.Create(&entry).Error
+}
+
+// snapshot turns a value into its JSON fields, without secrets and loaded
+// associations.
+func snapshot(v any) (map[string]any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for _, key := range []string{"password", "Records"} {
+		delete(fields, key)
+	}
+	return fields, nil
+}
+
+// changed lists the fields that differ between two snapshots.
+func changed(before, after map[string]any) []string {
+	keys := []string{}
+	for k, v := range after {
+		if !reflect.DeepEqual(before[k], v) {
+			keys = append(keys, k)
+		}
+	}
+	for k := range before {
+		if _, ok := after[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
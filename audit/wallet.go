@@ -0,0 +1,57 @@
+package audit
+
+import (
+	"car-rental/entity"
+
+	"gorm.io/gorm"
+)
+
+// Wallets holds the balances of users read before a change, to log the
+// change once it is made.
+type Wallets map[uint]map[string]any
+
+// SnapshotWallets reads the balances of the given users inside tx. Zero IDs
+// are ignored.
+func SnapshotWallets(tx *gorm.DB, userIDs ...uint) (Wallets, error) {
+	w := Wallets{}
+	for _, id := range userIDs {
+		if id == 0 {
+			continue
+		}
+		balances, err := balancesOf(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		w[id] = balances
+	}
+	return w, nil
+}
+
+// Log records a wallet update for every user whose balances changed since
+// the snapshot.
+func (w Wallets) Log(tx *gorm.DB, actor Actor) error {
+	for id, before := range w {
+		after, err := balancesOf(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := Log(tx, actor, Update, Wallet, id, before, after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func balancesOf(tx *gorm.DB, userID uint) (map[string]any, error) {
+	var user entity.User
+	result := tx.Where("id = ?", userID).First(&user)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return map[string]any{
+		"deposit":  user.Deposit,
+		"reserved": user.Reserved,
+		"owed":     user.Owed,
+		"currency": user.Currency,
+	}, nil
+}
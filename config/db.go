@@ -1,6 +1,7 @@
 package config
 
 import (
+	"car-rental/currency"
 	"car-rental/entity"
 	"fmt"
 	"log"
@@ -21,6 +22,27 @@ func ConnectDB() *gorm.DB {
 	if err != nil {
 		log.Fatal(err)
 	}
-	db.AutoMigrate(&entity.User{}, &entity.Product{}, &entity.Record{})
+	db.AutoMigrate(entity.Tables()...)
+	if err := protectAudit(db); err != nil {
+		log.Fatal(err)
+	}
+	if path := os.Getenv("EXCHANGE_RATES_FILE"); path != "" {
+		if err := currency.LoadFile(db, path); err != nil {
+			log.Fatal(err)
+		}
+	}
 	return db
 }
+
+// protectAudit makes the audit log append-only at the database level.
+func protectAudit(db *gorm.DB) error {
+	return db.Exec(`
+CREATE OR REPLACE FUNCTION audit_entries_immutable() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit entries cannot be changed or deleted';
+END
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS audit_entries_immutable ON audit_entries;
+CREATE TRIGGER audit_entries_immutable BEFORE UPDATE OR DELETE ON audit_entries
+	FOR EACH ROW EXECUTE FUNCTION audit_entries_immutable();`).Error
+}
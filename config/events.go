@@ -0,0 +1,20 @@
+package config
+
+import (
+	"car-rental/events"
+	"car-rental/loyalty"
+	"car-rental/notify"
+	"car-rental/webhook"
+
+	"gorm.io/gorm"
+)
+
+// ConnectEvents builds the domain event bus with its subscribers.
+func ConnectEvents(db *gorm.DB) *events.Bus {
+	bus := events.NewBus(db)
+	notify.Subscribe(bus)
+	webhook.Subscribe(bus)
+	loyalty.Subscribe(bus)
+	bus.Subscribe("log", events.All, events.LogSubscriber)
+	return bus
+}
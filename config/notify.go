@@ -0,0 +1,22 @@
+package config
+
+import (
+	"car-rental/notify"
+	"os"
+)
+
+// ConnectNotifier picks each channel's implementation: EMAIL_DRIVER smtp or
+// fake, SMS_DRIVER log or fake, WEBHOOK_DRIVER http or fake.
+func ConnectNotifier() notify.Notifier {
+	n := notify.Notifier{Channels: map[string]notify.Channel{
+		notify.Email:   notify.EmailChannel{},
+		notify.SMS:     notify.LogSMS{},
+		notify.Webhook: notify.WebhookChannel{},
+	}}
+	for channel, env := range map[string]string{notify.Email: "EMAIL_DRIVER", notify.SMS: "SMS_DRIVER", notify.Webhook: "WEBHOOK_DRIVER"} {
+		if os.Getenv(env) == "fake" {
+			n.Channels[channel] = &notify.FakeChannel{}
+		}
+	}
+	return n
+}
@@ -0,0 +1,19 @@
+package config
+
+import (
+	"car-rental/payout"
+	"log"
+	"os"
+	"time"
+)
+
+func ConnectPayouts() payout.Provider {
+	switch os.Getenv("PAYOUT_PROVIDER") {
+	case "", "fake":
+		delay, _ := time.ParseDuration(os.Getenv("FAKE_PAYOUT_DELAY"))
+		return &payout.FakeProvider{Delay: delay}
+	default:
+		log.Fatalf("unknown PAYOUT_PROVIDER %s", os.Getenv("PAYOUT_PROVIDER"))
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"car-rental/storage"
+	"os"
+)
+
+func ConnectStorage() storage.Storage {
+	if os.Getenv("STORAGE_DRIVER") == "s3" {
+		return storage.S3Storage{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			PublicURL: os.Getenv("S3_PUBLIC_URL"),
+		}
+	}
+	return storage.LocalStorage{
+		Dir:     UploadDir(),
+		BaseURL: "/uploads",
+	}
+}
+
+func UploadDir() string {
+	if dir := os.Getenv("UPLOAD_DIR"); dir != "" {
+		return dir
+	}
+	return "uploads"
+}
@@ -0,0 +1,127 @@
+package currency
+
+import (
+	"car-rental/entity"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Base is the currency exchange rates are quoted against, and the currency
+// of admin set amounts such as add-on prices, fixed promo values and
+// security holds. It is set by BASE_CURRENCY and defaults to IDR.
+func Base() string {
+	if base := os.Getenv("BASE_CURRENCY"); base != "" {
+		return strings.ToUpper(base)
+	}
+	return "IDR"
+}
+
+// Or returns code, or the base currency for rows stored before currencies
+// existed.
+func Or(code string) string {
+	if code == "" {
+		return Base()
+	}
+	return strings.ToUpper(code)
+}
+
+// Supported reports whether amounts can be converted from and to code.
+func Supported(db *gorm.DB, code string) (bool, error) {
+	if Or(code) == Base() {
+		return true, nil
+	}
+	var count int64
+	result := db.Model(&entity.ExchangeRate{}).Where("currency = ?", Or(code)).Count(&count)
+	return count > 0, result.Error
+}
+
+// Rate returns how many units of to one unit of from is worth.
+func Rate(db *gorm.DB, from, to string) (float64, error) {
+	from, to = Or(from), Or(to)
+	if from == to {
+		return 1, nil
+	}
+	fromRate, err := baseRate(db, from)
+	if err != nil {
+		return 0, err
+	}
+	toRate, err := baseRate(db, to)
+	if err != nil {
+		return 0, err
+	}
+	return toRate / fromRate, nil
+}
+
+// Convert converts amount from one currency to another, returning the
+// converted amount rounded to cents and the rate used.
+func Convert(db *gorm.DB, amount float64, from, to string) (float64, float64, error) {
+	rate, err := Rate(db, from, to)
+	if err != nil {
+		return 0, 0, err
+	}
+	return math.Round(amount*rate*100) / 100, rate, nil
+}
+
+func baseRate(db *gorm.DB, code string) (float64, error) {
+	if code == Base() {
+		return 1, nil
+	}
+	var rate entity.ExchangeRate
+	result := db.Where("currency = ?", code).First(&rate)
+	if result.Error != nil {
+		return 0, fmt.Errorf("no exchange rate for %s", code)
+	}
+	return rate.Rate, nil
+}
+
+// SaveRates upserts exchange rates, given as units of each currency per one
+// unit of the base currency. Nothing is saved when a rate is not positive.
+func SaveRates(db *gorm.DB, rates map[string]float64) error {
+	for code, rate := range rates {
+		if rate <= 0 && Or(code) != Base() {
+			return fmt.Errorf("rate for %s must be positive", Or(code))
+		}
+	}
+	for code, rate := range rates {
+		code = Or(code)
+		if code == Base() {
+			continue
+		}
+		result := db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&entity.ExchangeRate{Currency: code, Rate: rate})
+		if result.Error != nil {
+			return result.Error
+		}
+	}
+	return nil
+}
+
+// RatesFile is the format of the exchange rates file.
+type RatesFile struct {
+	Base  string             `json:"base"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+// LoadFile loads exchange rates from a JSON file such as
+// {"base": "IDR", "rates": {"USD": 0.000064, "SGD": 0.000086}}.
+func LoadFile(db *gorm.DB, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var file RatesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+	if Or(file.Base) != Base() {
+		return fmt.Errorf("rates file base %s does not match base currency %s", file.Base, Base())
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		return SaveRates(tx, file.Rates)
+	})
+}
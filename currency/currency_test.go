@@ -0,0 +1,89 @@
+package currency
+
+import (
+	"car-rental/entity"
+	"car-rental/testdb"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	t.Setenv("BASE_CURRENCY", "IDR")
+	db := testdb.Open(t)
+	if err := SaveRates(db, map[string]float64{"usd": 0.0001, "SGD": 0.000125}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		amount   float64
+		from, to string
+		want     float64
+		rate     float64
+	}{
+		{150000, "IDR", "IDR", 150000, 1},
+		{150000, "", "idr", 150000, 1},
+		{150000, "IDR", "USD", 15, 0.0001},
+		{15, "USD", "IDR", 150000, 10000},
+		{10, "USD", "SGD", 12.5, 1.25},
+		{33333, "IDR", "USD", 3.33, 0.0001},
+	}
+	for _, test := range tests {
+		got, rate, err := Convert(db, test.amount, test.from, test.to)
+		if err != nil {
+			t.Fatalf("%v %s to %s: %v", test.amount, test.from, test.to, err)
+		}
+		if got != test.want || rate != test.rate {
+			t.Errorf("%v %s to %s = %v at %v, want %v at %v", test.amount, test.from, test.to, got, rate, test.want, test.rate)
+		}
+	}
+	if _, _, err := Convert(db, 1, "EUR", "IDR"); err == nil {
+		t.Error("converted from a currency without a rate")
+	}
+}
+
+func TestSupported(t *testing.T) {
+	t.Setenv("BASE_CURRENCY", "IDR")
+	db := testdb.Open(t)
+	db.Create(&entity.ExchangeRate{Currency: "USD", Rate: 0.0001})
+	for code, want := range map[string]bool{"": true, "idr": true, "usd": true, "EUR": false} {
+		got, err := Supported(db, code)
+		if err != nil || got != want {
+			t.Errorf("Supported(%q) = %v, %v, want %v", code, got, err, want)
+		}
+	}
+
+	sqlDB, _ := db.DB()
+	sqlDB.Close()
+	if _, err := Supported(db, "USD"); err == nil {
+		t.Error("database error read as an unsupported currency")
+	}
+}
+
+func TestSaveRatesRejectsBadRates(t *testing.T) {
+	t.Setenv("BASE_CURRENCY", "IDR")
+	db := testdb.Open(t)
+	for _, rates := range []map[string]float64{
+		{"USD": 0.0001, "SGD": 0},
+		{"USD": 0.0001, "SGD": -1},
+	} {
+		if err := SaveRates(db, rates); err == nil {
+			t.Errorf("saved %v", rates)
+		}
+		var count int64
+		db.Model(&entity.ExchangeRate{}).Count(&count)
+		if count != 0 {
+			t.Errorf("saved %d rates of %v", count, rates)
+		}
+	}
+
+	// the base currency is skipped, whatever its rate
+	if err := SaveRates(db, map[string]float64{"IDR": 0, "USD": 0.0001}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveRates(db, map[string]float64{"USD": 0.0002}); err != nil {
+		t.Fatal(err)
+	}
+	var rates []entity.ExchangeRate
+	db.Find(&rates)
+	if len(rates) != 1 || rates[0].Currency != "USD" || rates[0].Rate != 0.0002 {
+		t.Errorf("stored %+v, want the updated USD rate only", rates)
+	}
+}
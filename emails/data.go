@@ -0,0 +1,96 @@
+package emails
+
+import (
+	"car-rental/entity"
+	"time"
+)
+
+// Template names.
+const (
+	Welcome            = "welcome"
+	TopUp              = "topup"
+	RentalReceipt      = "rental_receipt"
+	LowBalance         = "low_balance"
+	RentalStartingSoon = "rental_starting_soon"
+	RentalEndingSoon   = "rental_ending_soon"
+)
+
+type WelcomeData struct {
+	Name string
+}
+
+type TopUpData struct {
+	Name     string
+	Amount   float64
+	Deposit  float64
+	Currency string
+	Invoice  string
+}
+
+type RentalReceiptData struct {
+	Name           string
+	Product        string
+	RentLength     uint
+	Price          entity.PriceBreakdown
+	Deposit        float64
+	WalletCurrency string
+	Invoice        string
+}
+
+type LowBalanceData struct {
+	Name      string
+	Available float64
+	Threshold float64
+	Currency  string
+}
+
+// RentalReminderData is used by both rental reminders.
+type RentalReminderData struct {
+	Name        string
+	RecordID    uint
+	Product     string
+	Category    string
+	Description string
+	Branch      string
+	StartDate   time.Time
+	EndDate     time.Time
+}
+
+// Samples holds the data the admin preview renders each template with.
+var Samples = map[string]any{
+	Welcome: WelcomeData{Name: "Jane Doe"},
+	TopUp:   TopUpData{Name: "Jane Doe", Amount: 500000, Deposit: 750000, Currency: "IDR", Invoice: "INV-000042"},
+	RentalReceipt: RentalReceiptData{
+		Name:       "Jane Doe",
+		Product:    "Toyota Avanza",
+		RentLength: 3,
+		Price: entity.PriceBreakdown{
+			Currency:  "IDR",
+			DailyRate: 350000,
+			Base:      1050000,
+			Lines:     []entity.PriceLine{{Description: "Weekend surcharge", Amount: 70000}},
+			AddOns:    []entity.PriceLine{{Description: "Child seat x1", Quantity: 1, Amount: 60000}},
+			Tax:       117000,
+			TaxName:   "VAT",
+			TaxRate:   10,
+			Total:     1297000,
+		},
+		Deposit:        203000,
+		WalletCurrency: "IDR",
+		Invoice:        "INV-000043",
+	},
+	LowBalance:         LowBalanceData{Name: "Jane Doe", Available: 40000, Threshold: 100000, Currency: "IDR"},
+	RentalStartingSoon: sampleReminder,
+	RentalEndingSoon:   sampleReminder,
+}
+
+var sampleReminder = RentalReminderData{
+	Name:        "Jane Doe",
+	RecordID:    42,
+	Product:     "Toyota Avanza",
+	Category:    "car",
+	Description: "7 seater, automatic",
+	Branch:      "Jakarta Selatan",
+	StartDate:   time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC),
+	EndDate:     time.Date(2024, 1, 5, 10, 0, 0, 0, time.UTC),
+}
@@ -0,0 +1,162 @@
+package emails
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Each template is one file named <name>.<locale>.tmpl defining the
+// "subject", "text" and "html" blocks, and optionally a short "sms" one.
+// Files in EMAIL_TEMPLATES_DIR win over the built in ones, so content can be
+// changed without a rebuild.
+//
+//go:embed templates/*.tmpl
+var builtin embed.FS
+
+var ErrUnknownTemplate = errors.New("unknown email template")
+
+// Email is a rendered template.
+type Email struct {
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html"`
+	SMS     string `json:"sms"` // the "sms" block, or the subject when there is none
+}
+
+var funcs = map[string]any{
+	"money": func(v float64) string { return fmt.Sprintf("%.2f", v) },
+}
+
+// DefaultLocale is used when a user has none or theirs has no template, set
+// by EMAIL_DEFAULT_LOCALE.
+func DefaultLocale() string {
+	if locale := os.Getenv("EMAIL_DEFAULT_LOCALE"); locale != "" {
+		return locale
+	}
+	return "en"
+}
+
+var (
+	localePattern = regexp.MustCompile(`^[a-z]{2}(-[a-z]{2})?$`)
+	namePattern   = regexp.MustCompile(`^[a-z0-9_]+$`)
+)
+
+// NormalizeLocale lowercases a locale such as en_GB to en-gb, or returns ""
+// when it does not have the shape of a language with an optional region.
+// Locales are used in file names, so nothing else may get through.
+func NormalizeLocale(locale string) string {
+	locale = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(locale)), "_", "-")
+	if !localePattern.MatchString(locale) {
+		return ""
+	}
+	return locale
+}
+
+// Render renders a template in the closest locale available: the locale
+// itself, then its language without the region, then the default locale.
+func Render(name, locale string, data any) (Email, error) {
+	src, err := find(name, locale)
+	if err != nil {
+		return Email{}, err
+	}
+	var out Email
+	text, err := texttemplate.New(name).Funcs(funcs).Parse(src)
+	if err != nil {
+		return out, err
+	}
+	html, err := htmltemplate.New(name).Funcs(funcs).Parse(src)
+	if err != nil {
+		return out, err
+	}
+	var buf bytes.Buffer
+	if err := text.ExecuteTemplate(&buf, "subject", data); err != nil {
+		return out, err
+	}
+	out.Subject = strings.TrimSpace(buf.String())
+	buf.Reset()
+	if err := text.ExecuteTemplate(&buf, "text", data); err != nil {
+		return out, err
+	}
+	out.Text = strings.TrimSpace(buf.String())
+	buf.Reset()
+	if err := html.ExecuteTemplate(&buf, "html", data); err != nil {
+		return out, err
+	}
+	out.HTML = strings.TrimSpace(buf.String())
+	out.SMS = out.Subject
+	if text.Lookup("sms") != nil {
+		buf.Reset()
+		if err := text.ExecuteTemplate(&buf, "sms", data); err != nil {
+			return out, err
+		}
+		out.SMS = strings.TrimSpace(buf.String())
+	}
+	return out, nil
+}
+
+func find(name, locale string) (string, error) {
+	if !namePattern.MatchString(name) {
+		return "", fmt.Errorf("%w %q", ErrUnknownTemplate, name)
+	}
+	locale = NormalizeLocale(locale)
+	lang, _, _ := strings.Cut(locale, "-")
+	for _, l := range []string{locale, lang, NormalizeLocale(DefaultLocale())} {
+		if l == "" {
+			continue
+		}
+		file := name + "." + l + ".tmpl"
+		if dir := os.Getenv("EMAIL_TEMPLATES_DIR"); dir != "" {
+			if b, err := os.ReadFile(filepath.Join(dir, file)); err == nil {
+				return string(b), nil
+			}
+		}
+		if b, err := builtin.ReadFile("templates/" + file); err == nil {
+			return string(b), nil
+		}
+	}
+	return "", fmt.Errorf("%w %s for locale %s", ErrUnknownTemplate, name, locale)
+}
+
+// Templates lists every template name with the locales it has, built in or
+// from EMAIL_TEMPLATES_DIR.
+func Templates() map[string][]string {
+	found := map[string]map[string]bool{}
+	add := func(file string) {
+		name, locale, ok := strings.Cut(strings.TrimSuffix(file, ".tmpl"), ".")
+		if !ok || !strings.HasSuffix(file, ".tmpl") {
+			return
+		}
+		if found[name] == nil {
+			found[name] = map[string]bool{}
+		}
+		found[name][locale] = true
+	}
+	entries, _ := fs.ReadDir(builtin, "templates")
+	for _, e := range entries {
+		add(e.Name())
+	}
+	if dir := os.Getenv("EMAIL_TEMPLATES_DIR"); dir != "" {
+		entries, _ := os.ReadDir(dir)
+		for _, e := range entries {
+			add(e.Name())
+		}
+	}
+	out := map[string][]string{}
+	for name, locales := range found {
+		for locale := range locales {
+			out[name] = append(out[name], locale)
+		}
+		sort.Strings(out[name])
+	}
+	return out
+}
@@ -0,0 +1,46 @@
+package emails
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalizeLocale(t *testing.T) {
+	tests := map[string]string{
+		"en":                  "en",
+		" en_GB ":             "en-gb",
+		"id-ID":               "id-id",
+		"zh-Hant-TW":          "",
+		"eng":                 "",
+		"x/../../../tmp/evil": "",
+		"../en":               "",
+	}
+	for in, want := range tests {
+		if got := NormalizeLocale(in); got != want {
+			t.Errorf("NormalizeLocale(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestFindStaysInTemplatesDir(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "templates")
+	os.Mkdir(dir, 0o755)
+	os.WriteFile(filepath.Join(root, "evil.tmpl"), []byte(`{{define "subject"}}evil{{end}}`), 0o644)
+	t.Setenv("EMAIL_TEMPLATES_DIR", dir)
+
+	for _, locale := range []string{"x/../../evil", "../../evil"} {
+		src, err := find("welcome", locale)
+		if err != nil {
+			t.Fatal(err)
+		}
+		builtinSrc, _ := builtin.ReadFile("templates/welcome.en.tmpl")
+		if src != string(builtinSrc) {
+			t.Errorf("locale %q did not fall back to the default template", locale)
+		}
+	}
+	if _, err := find("../evil", "en"); err == nil {
+		t.Errorf("template name with a path was accepted")
+	}
+}
@@ -1,12 +1,26 @@
 package entity
 
+import "time"
+
 type TopUp struct {
 	Deposit float64 `json:"deposit"`
 }
 
 type Rent struct {
-	ProductID  uint `json:"product_id"`
-	RentLength uint `json:"rent_length"`
+	ProductID  uint        `json:"product_id"`
+	RentLength uint        `json:"rent_length"`
+	QuoteID    string      `json:"quote_id,omitempty"`
+	PromoCode  string      `json:"promo_code,omitempty"`
+	AddOns     []RentAddOn `json:"add_ons,omitempty"`
+	// loyalty points to redeem against the price
+	RedeemPoints uint `json:"redeem_points,omitempty"`
+	// book ahead for pickup at this time, empty starts the rent now
+	StartDate *time.Time `json:"start_date,omitempty"`
+}
+
+type RentAddOn struct {
+	AddOnID  uint `json:"add_on_id"`
+	Quantity uint `json:"quantity"`
 }
 
 type EmailValidate struct {
@@ -16,3 +30,193 @@ type EmailValidate struct {
 	IsValid       bool   `json:"isValid"`
 	IsDeliverable bool   `json:"isDeliverable"`
 }
+
+type PriceLine struct {
+	Description string  `json:"description"`
+	RuleID      uint    `json:"rule_id,omitempty"`
+	PromoCodeID uint    `json:"promo_code_id,omitempty"`
+	AddOnID     uint    `json:"add_on_id,omitempty"`
+	Quantity    uint    `json:"quantity,omitempty"`
+	Amount      float64 `json:"amount"`
+}
+
+type PriceBreakdown struct {
+	ProductID    uint        `json:"product_id"`
+	Currency     string      `json:"currency"`
+	DailyRate    float64     `json:"daily_rate"`
+	RentLength   uint        `json:"rent_length"`
+	Base         float64     `json:"base"`
+	Lines        []PriceLine `json:"lines"`   // discounts and surcharges
+	AddOns       []PriceLine `json:"add_ons"` // set by pricing.ApplyAddOns
+	Tax          float64     `json:"tax"`     // set by pricing.ApplyTax
+	TaxName      string      `json:"tax_name,omitempty"`
+	TaxRate      float64     `json:"tax_rate,omitempty"`
+	TaxInclusive bool        `json:"tax_inclusive"`
+	Total        float64     `json:"total"`
+	// refundable security hold, reserved in the wallet and not part of Total
+	SecurityHold   float64 `json:"security_hold"`
+	PointsRedeemed uint    `json:"points_redeemed,omitempty"`
+}
+
+type ReturnInspection struct {
+	DamageFee float64 `json:"damage_fee"`
+	Notes     string  `json:"notes"`
+}
+
+type InvoiceLine struct {
+	Description string  `json:"description"`
+	Amount      float64 `json:"amount"`
+}
+
+type TaxSummaryRow struct {
+	Currency string  `json:"currency"`
+	TaxName  string  `json:"tax_name"`
+	TaxRate  float64 `json:"tax_rate"`
+	Rents    int     `json:"rents"`
+	Total    float64 `json:"total"`
+	Net      float64 `json:"net"`
+	Tax      float64 `json:"tax"`
+}
+
+type GiftCardBatch struct {
+	Count     int        `json:"count"`
+	Value     float64    `json:"value"`
+	Currency  string     `json:"currency"`
+	Batch     string     `json:"batch"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type GiftCardRedeem struct {
+	Code string `json:"code"`
+}
+
+type GiftCardReportRow struct {
+	Currency      string  `json:"currency"`
+	Issued        int     `json:"issued"`
+	IssuedValue   float64 `json:"issued_value"`
+	Redeemed      int     `json:"redeemed"`
+	RedeemedValue float64 `json:"redeemed_value"`
+	Revoked       int     `json:"revoked"`
+	RevokedValue  float64 `json:"revoked_value"`
+	Expired       int     `json:"expired"`
+	ExpiredValue  float64 `json:"expired_value"`
+	// value of active cards that can still be redeemed
+	OutstandingValue float64 `json:"outstanding_value"`
+}
+
+type WithdrawalInput struct {
+	// amount in the wallet currency, zero withdraws the whole available balance
+	Amount      float64 `json:"amount"`
+	Destination string  `json:"destination"`
+}
+
+type WithdrawalDecision struct {
+	Reason string `json:"reason"`
+}
+
+type Attachment struct {
+	Name string `json:"name"`
+	Data []byte `json:"data"`
+}
+
+type NotificationSettings struct {
+	Phone      string `json:"phone"`
+	WebhookURL string `json:"webhook_url"`
+	// enabled channels by event, e.g. {"low_balance": {"sms": true}}
+	Preferences map[string]map[string]bool `json:"preferences"`
+}
+
+// NotificationSettingsInput changes only the settings that are sent, an
+// empty phone or webhook URL removes it.
+type NotificationSettingsInput struct {
+	Phone       *string                    `json:"phone"`
+	WebhookURL  *string                    `json:"webhook_url"`
+	Preferences map[string]map[string]bool `json:"preferences"`
+}
+
+type RevenueRow struct {
+	Group     string  `json:"group"` // period start date, category or product name
+	ProductID uint    `json:"product_id,omitempty"`
+	Rents     int     `json:"rents"`
+	Total     float64 `json:"total"` // includes Fees
+	Net       float64 `json:"net"`
+	Tax       float64 `json:"tax"`
+	Fees      float64 `json:"fees"`     // late and damage fees taken at return
+	Currency  string  `json:"currency"` // base currency
+}
+
+type UtilizationRow struct {
+	ProductID     uint    `json:"product_id"`
+	Name          string  `json:"name"`
+	Category      string  `json:"category"`
+	Units         int     `json:"units"`
+	Rents         int     `json:"rents"`
+	DaysRented    float64 `json:"days_rented"`
+	DaysAvailable float64 `json:"days_available"`
+	Utilization   float64 `json:"utilization"` // percent of DaysAvailable
+}
+
+type RentalLengthRow struct {
+	Category      string  `json:"category"`
+	Rents         int     `json:"rents"`
+	AvgBookedDays float64 `json:"avg_booked_days"`
+	Returned      int     `json:"returned"`
+	AvgActualDays float64 `json:"avg_actual_days"` // of returned rents only
+}
+
+type TopCustomerRow struct {
+	UserID   uint    `json:"user_id"`
+	Name     string  `json:"name"`
+	Email    string  `json:"email"`
+	Rents    int     `json:"rents"`
+	Spend    float64 `json:"spend"`
+	Currency string  `json:"currency"` // base currency
+}
+
+type TopUpRow struct {
+	Period   string  `json:"period"` // period start date
+	TopUps   int     `json:"top_ups"`
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency"` // base currency
+}
+
+// ProductInput holds the fields a client may set when creating a product.
+type ProductInput struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	RentalPrice float64 `json:"rental_price"`
+	Currency    string  `json:"currency"`
+	Stock       int     `json:"stock"`
+	Category    string  `json:"category"`
+	Branch      string  `json:"branch"`
+}
+
+// ProductRow is a product as it is imported and exported in bulk. Stock is
+// the number of units of the vehicle in the fleet.
+type ProductRow struct {
+	ID          uint    `json:"id,omitempty"` // updates this product when set, creates one otherwise
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	RentalPrice float64 `json:"rental_price"`
+	Currency    string  `json:"currency"`
+	Stock       int     `json:"stock"`
+	Category    string  `json:"category"`
+	Branch      string  `json:"branch"`
+	Version     uint    `json:"version,omitempty"` // when set, the update fails if the product changed since
+	Archived    bool    `json:"archived"`          // the row is an archived product, which stays archived
+}
+
+type ImportError struct {
+	Row   int    `json:"row"` // 1 for the first product
+	Error string `json:"error"`
+}
+
+type ImportResult struct {
+	Rows      int           `json:"rows"`
+	Created   int           `json:"created"`
+	Updated   int           `json:"updated"`
+	Failed    int           `json:"failed"`
+	DryRun    bool          `json:"dry_run"`
+	Committed bool          `json:"committed"` // false for a dry run or a failed all-or-nothing import
+	Errors    []ImportError `json:"errors"`
+}
@@ -1,29 +1,357 @@
 package entity
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type User struct {
-	ID       uint    `json:"id" gorm:"primaryKey"`
-	Name     string  `json:"name"`
-	Email    string  `json:"email" gorm:"unique;"`
-	Password string  `json:"password"`
-	Deposit  float64 `json:"deposit" gorm:"default:0"`
-	Role     string  `json:"role" gorm:"default:customer"` // customer,admin
-	Records  []Record
+	ID         uint    `json:"id" gorm:"primaryKey"`
+	Name       string  `json:"name"`
+	Email      string  `json:"email" gorm:"unique;"`
+	Password   string  `json:"password"`
+	Deposit    float64 `json:"deposit" gorm:"default:0"`
+	Reserved   float64 `json:"reserved" gorm:"default:0"`    // part of Deposit held for ongoing rents and requested withdrawals
+	Owed       float64 `json:"owed" gorm:"default:0"`        // return fees the deposit could not cover, paid off by the next credit
+	Currency   string  `json:"currency"`                     // wallet currency, empty is the base currency
+	Points     int     `json:"points" gorm:"default:0"`      // loyalty points
+	Role       string  `json:"role" gorm:"default:customer"` // customer,admin
+	Locale     string  `json:"locale"`                       // language of emails, e.g. en or id
+	Phone      string  `json:"phone,omitempty"`              // for SMS notifications
+	WebhookURL string  `json:"webhook_url,omitempty"`        // for webhook notifications
+	// code other users register with, and the code this user registered with
+	ReferralCode *string `json:"referral_code,omitempty" gorm:"uniqueIndex"`
+	ReferrerCode string  `json:"referrer_code,omitempty" gorm:"-"`
+	DeviceID     string  `json:"-"` // X-Device-ID sent when registering
+	Records      []Record
 }
 type Product struct {
 	ID          uint    `json:"id" gorm:"primaryKey"`
 	Name        string  `json:"name"`
 	Description string  `json:"description"`
 	RentalPrice float64 `json:"rental_price"`
+	Currency    string  `json:"currency"` // currency of RentalPrice, empty is the base currency
 	Stock       int     `json:"stock"`
 	Category    string  `json:"category"` // car,motorcycle
+	Branch      string  `json:"branch"`
 	Records     []Record
+	Images      []ProductImage `json:"images"`
+	// RentalPrice converted to the currency asked for by the customer
+	DisplayPrice    float64        `json:"display_price,omitempty" gorm:"-"`
+	DisplayCurrency string         `json:"display_currency,omitempty" gorm:"-"`
+	Version         uint           `json:"version" gorm:"not null;default:1"`
+	DeletedAt       gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index" swaggertype:"string" format:"date-time"`
 }
 type Record struct {
+	ID         uint          `json:"id" gorm:"primaryKey"`
+	UserID     uint          `json:"user_id"`
+	ProductID  uint          `json:"product_id"`
+	StartDate  time.Time     `json:"start_date" gorm:"autoCreateTime"`
+	EndDate    time.Time     `json:"end_date"`
+	ReturnedAt *time.Time    `json:"returned_at,omitempty"`
+	Total      float64       `json:"total"` // price in Currency, tax included
+	Currency   string        `json:"currency"`
+	DailyRate  float64       `json:"daily_rate"` // booked daily rate in Currency, charged per late day
+	Tax        float64       `json:"tax"`
+	TaxName    string        `json:"tax_name"`
+	TaxRate    float64       `json:"tax_rate"`
+	AddOns     []RecordAddOn `json:"add_ons"`
+	CreatedAt  time.Time     `json:"created_at"` // when it was booked, StartDate can be later
+}
+type ProductImage struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	ProductID    uint      `json:"product_id"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	Key          string    `json:"-"`
+	ThumbnailKey string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+type PricingRule struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	Name      string     `json:"name"`
+	Type      string     `json:"type"`                 // duration,weekend,season
+	Category  string     `json:"category"`             // empty applies to every category, otherwise overrides generic rules of the same type
+	MinDays   uint       `json:"min_days"`             // duration rules only, e.g. 7 for weekly, 30 for monthly
+	Percent   float64    `json:"percent"`              // positive is a surcharge, negative a discount
+	StartDate *time.Time `json:"start_date,omitempty"` // season rules only
+	EndDate   *time.Time `json:"end_date,omitempty"`   // season rules only, inclusive
+	Disabled  bool       `json:"disabled"`
+}
+type Quote struct {
+	ID             string         `json:"id" gorm:"primaryKey"`
+	UserID         uint           `json:"user_id"`
+	ProductID      uint           `json:"product_id"`
+	RentLength     uint           `json:"rent_length"`
+	PromoCode      string         `json:"promo_code,omitempty"`
+	AddOns         []RentAddOn    `json:"add_ons" gorm:"serializer:json"`
+	RedeemPoints   uint           `json:"redeem_points,omitempty"`
+	StartDate      *time.Time     `json:"start_date,omitempty"`
+	Price          PriceBreakdown `json:"price" gorm:"serializer:json"`
+	DepositNeeded  float64        `json:"deposit_needed"`  // deposit still missing to book the quote
+	WalletCurrency string         `json:"wallet_currency"` // currency of DepositNeeded
+	ExpiresAt      time.Time      `json:"expires_at"`
+	UsedAt         *time.Time     `json:"used_at,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
+}
+type PromoCode struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	Code           string     `json:"code" gorm:"uniqueIndex"`
+	Type           string     `json:"type"` // percent,fixed
+	Value          float64    `json:"value"`
+	StartsAt       *time.Time `json:"starts_at,omitempty"`
+	EndsAt         *time.Time `json:"ends_at,omitempty"`
+	MaxUses        uint       `json:"max_uses"`          // 0 is unlimited
+	MaxUsesPerUser uint       `json:"max_uses_per_user"` // 0 is unlimited
+	UsedCount      uint       `json:"used_count"`
+	Category       string     `json:"category"`   // empty applies to every category
+	ProductID      uint       `json:"product_id"` // 0 applies to every product
+	Disabled       bool       `json:"disabled"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+type PromoRedemption struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	PromoCodeID uint      `json:"promo_code_id" gorm:"index"`
+	UserID      uint      `json:"user_id" gorm:"index"`
+	RecordID    uint      `json:"record_id"`
+	Amount      float64   `json:"amount"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+type AddOn struct {
+	ID          uint    `json:"id" gorm:"primaryKey"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	PricingType string  `json:"pricing_type"` // per_day,per_rental
+	Price       float64 `json:"price"`
+	Stock       *int    `json:"stock"` // null for unlimited, otherwise units that can be out at the same time
+	Disabled    bool    `json:"disabled"`
+}
+type RecordAddOn struct {
+	ID        uint    `json:"id" gorm:"primaryKey"`
+	RecordID  uint    `json:"record_id" gorm:"index"`
+	AddOnID   uint    `json:"add_on_id" gorm:"index"`
+	Name      string  `json:"name"`
+	Quantity  uint    `json:"quantity"`
+	UnitPrice float64 `json:"unit_price"` // one unit for the whole rent, in the record currency
+	Amount    float64 `json:"amount"`
+}
+type HoldPolicy struct {
+	Category string  `json:"category" gorm:"primaryKey"`
+	Amount   float64 `json:"amount"`
+}
+type DepositHold struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"index"`
+	RecordID  uint       `json:"record_id" gorm:"uniqueIndex"`
+	Amount    float64    `json:"amount"` // in Currency, the wallet currency
+	Captured  float64    `json:"captured"`
+	Currency  string     `json:"currency"`
+	Status    string     `json:"status"` // held,released,captured
+	Notes     string     `json:"notes"`
+	CreatedAt time.Time  `json:"created_at"`
+	SettledAt *time.Time `json:"settled_at,omitempty"`
+}
+type LedgerEntry struct {
+	ID       uint    `json:"id" gorm:"primaryKey"`
+	UserID   uint    `json:"user_id" gorm:"index"`
+	Type     string  `json:"type"`             // topup,rental,hold_capture,return_fee,fee_payment,referral,gift_card,withdrawal,withdrawal_reversal
+	Status   string  `json:"status,omitempty"` // pending,settled,failed for payouts, empty when posted at once
+	Amount   float64 `json:"amount"`           // positive adds to the deposit, negative takes from it
+	Tax      float64 `json:"tax"`              // tax included in Amount
+	Currency string  `json:"currency"`
+	// what was charged before converting to the wallet currency
+	OriginalAmount   float64   `json:"original_amount"`
+	OriginalCurrency string    `json:"original_currency"`
+	ExchangeRate     float64   `json:"exchange_rate"`
+	RecordID         *uint     `json:"record_id,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+type Invoice struct {
+	ID             uint          `json:"id" gorm:"primaryKey"`
+	Number         string        `json:"number" gorm:"uniqueIndex"`
+	Sequence       uint          `json:"-"`
+	Kind           string        `json:"kind"` // rental,topup
+	UserID         uint          `json:"user_id" gorm:"index"`
+	RecordID       *uint         `json:"record_id,omitempty" gorm:"index"`
+	LedgerEntryID  *uint         `json:"ledger_entry_id,omitempty"`
+	CompanyName    string        `json:"company_name"`
+	CompanyAddress string        `json:"company_address"`
+	CompanyTaxID   string        `json:"company_tax_id"`
+	CustomerName   string        `json:"customer_name"`
+	CustomerEmail  string        `json:"customer_email"`
+	Lines          []InvoiceLine `json:"lines" gorm:"serializer:json"`
+	Subtotal       float64       `json:"subtotal"`
+	Tax            float64       `json:"tax"`
+	TaxInclusive   bool          `json:"tax_inclusive"` // line amounts already include the tax
+	Total          float64       `json:"total"`
+	Currency       string        `json:"currency"`
+	IssuedAt       time.Time     `json:"issued_at"`
+}
+type InvoiceSequence struct {
+	Name string `gorm:"primaryKey"`
+	Last uint
+}
+type TaxRate struct {
+	ID        uint    `json:"id" gorm:"primaryKey"`
+	Name      string  `json:"name"` // e.g. VAT, sales tax
+	Rate      float64 `json:"rate"` // percent
+	Category  string  `json:"category"`
+	Branch    string  `json:"branch"`
+	Inclusive bool    `json:"inclusive"` // prices already include the tax
+}
+type ExchangeRate struct {
+	Currency  string    `json:"currency" gorm:"primaryKey"`
+	Rate      float64   `json:"rate"` // units of Currency per unit of the base currency
+	UpdatedAt time.Time `json:"updated_at"`
+}
+type LoyaltyTier struct {
+	ID              uint    `json:"id" gorm:"primaryKey"`
+	Name            string  `json:"name"`      // e.g. Silver, Gold
+	MinSpend        float64 `json:"min_spend"` // rolling yearly spend in the base currency
+	DiscountPercent float64 `json:"discount_percent"`
+	FreeAddOnID     *uint   `json:"free_add_on_id,omitempty"` // one unit of this add-on is free
+}
+type PointsEntry struct {
 	ID        uint      `json:"id" gorm:"primaryKey"`
-	UserID    uint      `json:"user_id"`
-	ProductID uint      `json:"product_id"`
-	StartDate time.Time `json:"start_date" gorm:"autoCreateTime"`
-	EndDate   time.Time `json:"end_date"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	RecordID  uint      `json:"record_id" gorm:"uniqueIndex:idx_points_record_reason"`
+	Points    int       `json:"points"`
+	Reason    string    `json:"reason" gorm:"uniqueIndex:idx_points_record_reason"` // earned,redeemed, once per rent
+	CreatedAt time.Time `json:"created_at"`
+}
+type Referral struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	ReferrerID uint       `json:"referrer_id" gorm:"index"`
+	ReferredID uint       `json:"referred_id" gorm:"uniqueIndex"`
+	DeviceID   string     `json:"-" gorm:"index"`
+	Status     string     `json:"status"` // pending,rewarded
+	Reward     float64    `json:"reward"` // paid to each party
+	Currency   string     `json:"currency"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RewardedAt *time.Time `json:"rewarded_at,omitempty"`
+}
+
+// ReferralDevice is locked while the referrals made from a device are
+// counted, so concurrent registrations cannot exceed the device limit.
+type ReferralDevice struct {
+	DeviceID string `gorm:"primaryKey"`
+}
+type GiftCard struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	Code       string     `json:"code" gorm:"uniqueIndex"`
+	Value      float64    `json:"value"`
+	Currency   string     `json:"currency"`
+	Batch      string     `json:"batch" gorm:"index"` // label of the bulk generation
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	RedeemedAt *time.Time `json:"redeemed_at,omitempty"`
+	RedeemedBy *uint      `json:"redeemed_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+type Withdrawal struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	UserID        uint       `json:"user_id" gorm:"index"`
+	Amount        float64    `json:"amount"`
+	Currency      string     `json:"currency"`
+	Destination   string     `json:"destination"` // account the payout goes to
+	Status        string     `json:"status"`      // requested,rejected,processing,settled,failed
+	Reason        string     `json:"reason,omitempty"`
+	Reference     string     `json:"reference,omitempty"` // payout provider reference
+	LedgerEntryID *uint      `json:"ledger_entry_id,omitempty"`
+	DecidedBy     *uint      `json:"decided_by,omitempty"`
+	DecidedAt     *time.Time `json:"decided_at,omitempty"`
+	SettledAt     *time.Time `json:"settled_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+type OutboxMessage struct {
+	ID            uint         `json:"id" gorm:"primaryKey"`
+	Channel       string       `json:"channel" gorm:"default:email"` // email,sms,webhook
+	Event         string       `json:"event,omitempty"`
+	To            string       `json:"to"` // email address, phone number or webhook URL
+	Subject       string       `json:"subject"`
+	Text          string       `json:"text"` // plain text part, or the SMS
+	Body          string       `json:"body"` // HTML part, or the webhook JSON
+	Attachments   []Attachment `json:"attachments,omitempty" gorm:"serializer:json"`
+	Status        string       `json:"status" gorm:"index"` // pending,sending,sent,dead
+	Attempts      int          `json:"attempts"`
+	NextAttemptAt time.Time    `json:"next_attempt_at" gorm:"index"`
+	LastError     string       `json:"last_error,omitempty"`
+	CreatedAt     time.Time    `json:"created_at"`
+	SentAt        *time.Time   `json:"sent_at,omitempty"`
+}
+type NotificationPreference struct {
+	ID      uint   `json:"id" gorm:"primaryKey"`
+	UserID  uint   `json:"user_id" gorm:"uniqueIndex:idx_notification_preference"`
+	Event   string `json:"event" gorm:"uniqueIndex:idx_notification_preference"`
+	Channel string `json:"channel" gorm:"uniqueIndex:idx_notification_preference"`
+	Enabled bool   `json:"enabled"`
+}
+type Reminder struct {
+	ID       uint      `json:"id" gorm:"primaryKey"`
+	RecordID uint      `json:"record_id" gorm:"uniqueIndex:idx_reminder"`
+	Kind     string    `json:"kind" gorm:"uniqueIndex:idx_reminder"`   // pickup,return
+	Offset   string    `json:"offset" gorm:"uniqueIndex:idx_reminder"` // how long before the start or end, e.g. 24h0m0s
+	SentAt   time.Time `json:"sent_at"`
+}
+type WebhookEndpoint struct {
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	URL         string         `json:"url"`
+	Description string         `json:"description"`
+	Events      []string       `json:"events" gorm:"serializer:json"` // event types, or * for all
+	Secret      string         `json:"secret"`                        // HMAC key, generated on create
+	Disabled    bool           `json:"disabled"`
+	CreatedAt   time.Time      `json:"created_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+type WebhookDelivery struct {
+	ID             uint             `json:"id" gorm:"primaryKey"`
+	EndpointID     uint             `json:"endpoint_id" gorm:"uniqueIndex:idx_delivery_event,where:replay_of IS NULL"`
+	EventID        string           `json:"event_id" gorm:"uniqueIndex:idx_delivery_event,where:replay_of IS NULL"` // one first delivery per endpoint, replays repeat it
+	Event          string           `json:"event"`
+	Payload        string           `json:"payload"`
+	Status         string           `json:"status" gorm:"index"` // pending,sending,delivered,dead
+	Attempts       int              `json:"attempts"`
+	NextAttemptAt  time.Time        `json:"next_attempt_at"`
+	LastStatusCode int              `json:"last_status_code,omitempty"`
+	LastError      string           `json:"last_error,omitempty"`
+	ReplayOf       *uint            `json:"replay_of,omitempty"`
+	CreatedAt      time.Time        `json:"created_at"`
+	DeliveredAt    *time.Time       `json:"delivered_at,omitempty"`
+	Log            []WebhookAttempt `json:"log,omitempty" gorm:"foreignKey:DeliveryID"`
+}
+type WebhookAttempt struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	DeliveryID uint      `json:"delivery_id" gorm:"index"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Response   string    `json:"response,omitempty"` // first KB of the response body
+	DurationMS int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+type DomainEvent struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	Name        string     `json:"name" gorm:"index"`
+	Payload     string     `json:"payload"`
+	Done        []string   `json:"done" gorm:"serializer:json"` // subscribers that handled it
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"last_error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ProcessedAt *time.Time `json:"processed_at,omitempty" gorm:"index"`
+}
+type AuditEntry struct {
+	ID         uint           `json:"id" gorm:"primaryKey"`
+	ActorID    *uint          `json:"actor_id,omitempty" gorm:"index"`
+	ActorRole  string         `json:"actor_role"`
+	Action     string         `json:"action"` // create,update,delete
+	Resource   string         `json:"resource" gorm:"index:idx_audit_resource"`
+	ResourceID uint           `json:"resource_id" gorm:"index:idx_audit_resource"`
+	Before     map[string]any `json:"before,omitempty" gorm:"serializer:json"`
+	After      map[string]any `json:"after,omitempty" gorm:"serializer:json"`
+	Changed    []string       `json:"changed" gorm:"serializer:json"`
+	IP         string         `json:"ip"`
+	RequestID  string         `json:"request_id" gorm:"index"`
+	CreatedAt  time.Time      `json:"created_at" gorm:"index"`
 }
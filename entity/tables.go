@@ -0,0 +1,6 @@
+package entity
+
+// Tables lists every model stored in the database, for migrations.
+func Tables() []any {
+	return []any{&User{}, &Product{}, &Record{}, &ProductImage{}, &PricingRule{}, &Quote{}, &PromoCode{}, &PromoRedemption{}, &AddOn{}, &RecordAddOn{}, &HoldPolicy{}, &DepositHold{}, &LedgerEntry{}, &Invoice{}, &InvoiceSequence{}, &TaxRate{}, &ExchangeRate{}, &LoyaltyTier{}, &PointsEntry{}, &Referral{}, &ReferralDevice{}, &GiftCard{}, &Withdrawal{}, &OutboxMessage{}, &NotificationPreference{}, &Reminder{}, &WebhookEndpoint{}, &WebhookDelivery{}, &WebhookAttempt{}, &DomainEvent{}, &AuditEntry{}}
+}
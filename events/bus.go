@@ -0,0 +1,204 @@
+package events
+
+import (
+	"car-rental/entity"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Event is a typed domain event.
+type Event interface {
+	EventName() string
+}
+
+// Handler reacts to an event after the transaction that raised it
+// committed. It writes through tx, which also marks the event as handled by
+// it, so its writes are kept exactly once: a failed or interrupted run
+// keeps none of them and is retried. id is the stored event's ID, the same
+// on every retry.
+type Handler func(ctx context.Context, tx *gorm.DB, id uint, e Event) error
+
+// All subscribes to every event.
+const All = "*"
+
+var types = map[string]reflect.Type{}
+
+func register(events ...Event) {
+	for _, e := range events {
+		types[e.EventName()] = reflect.TypeOf(e)
+	}
+}
+
+type subscriber struct {
+	name string
+	fn   Handler
+}
+
+// Bus delivers domain events to in-process subscribers after commit. Every
+// event is stored in the transaction that raised it, so a crash between
+// commit and delivery only delays it: Run picks up what was not delivered
+// and retries failed subscribers.
+type Bus struct {
+	DB       *gorm.DB
+	Interval time.Duration // how often Run retries stored events
+
+	mu   sync.RWMutex
+	subs map[string][]subscriber
+}
+
+// NewBus returns a bus that retries stored events every EVENT_BUS_INTERVAL.
+func NewBus(db *gorm.DB) *Bus {
+	b := &Bus{DB: db, Interval: 30 * time.Second}
+	if v, err := time.ParseDuration(os.Getenv("EVENT_BUS_INTERVAL")); err == nil && v > 0 {
+		b.Interval = v
+	}
+	return b
+}
+
+// Subscribe registers fn under a unique subscriber name for an event name,
+// or All.
+func (b *Bus) Subscribe(name, event string, fn Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subs == nil {
+		b.subs = map[string][]subscriber{}
+	}
+	b.subs[event] = append(b.subs[event], subscriber{name: name, fn: fn})
+}
+
+func (b *Bus) subscribers(event string) []subscriber {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return append(append([]subscriber{}, b.subs[event]...), b.subs[All]...)
+}
+
+// Pending holds the events staged in a transaction until Flush.
+type Pending struct {
+	ids []uint
+}
+
+// Stage stores events raised inside tx, so they are only kept if it
+// commits.
+func (b *Bus) Stage(tx *gorm.DB, evts ...Event) (Pending, error) {
+	var p Pending
+	for _, e := range evts {
+		payload, err := json.Marshal(scrub(e))
+		if err != nil {
+			return p, err
+		}
+		row := entity.DomainEvent{Name: e.EventName(), Payload: string(payload), Done: []string{}}
+		if err := tx.Create(&row).Error; err != nil {
+			return p, err
+		}
+		p.ids = append(p.ids, row.ID)
+	}
+	return p, nil
+}
+
+// Flush delivers staged events once their transaction committed. Errors are
+// logged and retried from Run.
+func (b *Bus) Flush(ctx context.Context, p Pending) {
+	for _, id := range p.ids {
+		if err := b.process(ctx, id); err != nil {
+			log.Printf("events: %v", err)
+		}
+	}
+}
+
+// process runs the subscribers of a stored event that did not succeed yet,
+// holding a lock on it so only one instance does. Every subscriber runs in
+// a savepoint of the transaction that records it as done, so one that fails
+// leaves no writes behind and does not undo the others.
+func (b *Bus) process(ctx context.Context, id uint) error {
+	var failed error
+	err := b.DB.Transaction(func(tx *gorm.DB) error {
+		var row entity.DomainEvent
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("id = ? AND processed_at IS NULL", id).Limit(1).Find(&row)
+		if result.Error != nil || row.ID == 0 {
+			return result.Error
+		}
+		typ, ok := types[row.Name]
+		if !ok {
+			return fmt.Errorf("unknown event %s", row.Name)
+		}
+		ptr := reflect.New(typ)
+		if err := json.Unmarshal([]byte(row.Payload), ptr.Interface()); err != nil {
+			return err
+		}
+		e := ptr.Elem().Interface().(Event)
+
+		handled := map[string]bool{}
+		for _, name := range row.Done {
+			handled[name] = true
+		}
+		for _, sub := range b.subscribers(row.Name) {
+			if handled[sub.name] {
+				continue
+			}
+			if err := tx.SavePoint("subscriber").Error; err != nil {
+				return err
+			}
+			if err := sub.fn(ctx, tx, row.ID, e); err != nil {
+				failed = fmt.Errorf("%s failed on %s %d: %w", sub.name, row.Name, row.ID, err)
+				if err := tx.RollbackTo("subscriber").Error; err != nil {
+					return err
+				}
+				continue
+			}
+			row.Done = append(row.Done, sub.name)
+		}
+		// map updates skip the serializer
+		done, err := json.Marshal(row.Done)
+		if err != nil {
+			return err
+		}
+		updates := map[string]any{"done": string(done), "attempts": row.Attempts + 1, "last_error": ""}
+		if failed != nil {
+			updates["last_error"] = failed.Error()
+		} else {
+			updates["processed_at"] = time.Now()
+		}
+		return tx.Model(&row).Updates(updates).Error
+	})
+	if err != nil {
+		return err
+	}
+	return failed
+}
+
+// Run retries stored events that were not fully delivered, every Interval,
+// until ctx is cancelled.
+func (b *Bus) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.Interval)
+	defer ticker.Stop()
+	for {
+		var ids []uint
+		// leave fresh events to the Flush of the request that raised them
+		result := b.DB.Model(&entity.DomainEvent{}).
+			Where("processed_at IS NULL AND created_at < ?", time.Now().Add(-b.Interval)).
+			Order("id").Limit(100).Pluck("id", &ids)
+		if result.Error != nil {
+			log.Printf("events: %v", result.Error)
+		}
+		for _, id := range ids {
+			if err := b.process(ctx, id); err != nil {
+				log.Printf("events: %v", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package events
+
+import (
+	"car-rental/entity"
+	"car-rental/testdb"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestStageAndFlush(t *testing.T) {
+	db := testdb.Open(t)
+	bus := NewBus(db)
+	var ids []uint
+	fail := true
+	bus.Subscribe("welcome", All, func(ctx context.Context, tx *gorm.DB, id uint, e Event) error {
+		ids = append(ids, id)
+		return tx.Create(&entity.OutboxMessage{To: e.(UserRegistered).User.Email, Subject: "welcome"}).Error
+	})
+	bus.Subscribe("mail", NameUserRegistered, func(ctx context.Context, tx *gorm.DB, id uint, e Event) error {
+		// writes before failing are undone with the failure
+		if err := tx.Create(&entity.OutboxMessage{To: e.(UserRegistered).User.Email, Subject: "mail"}).Error; err != nil {
+			return err
+		}
+		if fail {
+			return errors.New("smtp down")
+		}
+		return nil
+	})
+
+	// events of a rolled back transaction are never delivered
+	tx := db.Begin()
+	if _, err := bus.Stage(tx, UserRegistered{User: entity.User{Email: "gone@example.com"}}); err != nil {
+		t.Fatal(err)
+	}
+	tx.Rollback()
+
+	tx = db.Begin()
+	pending, err := bus.Stage(tx, UserRegistered{User: entity.User{Email: "new@example.com", Password: "hash"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Commit()
+	bus.Flush(context.Background(), pending)
+
+	sent := func() map[string]int {
+		var msgs []entity.OutboxMessage
+		db.Find(&msgs)
+		out := map[string]int{}
+		for _, msg := range msgs {
+			out[msg.To+" "+msg.Subject]++
+		}
+		return out
+	}
+	if got := sent(); len(got) != 1 || got["new@example.com welcome"] != 1 {
+		t.Fatalf("queued %v after the first flush, want only the welcome message", got)
+	}
+
+	var row entity.DomainEvent
+	db.First(&row)
+	if row.ProcessedAt != nil || row.LastError == "" || len(row.Done) != 1 {
+		t.Errorf("failed event not kept for a retry: %+v", row)
+	}
+	var count int64
+	db.Model(&entity.DomainEvent{}).Count(&count)
+	if count != 1 {
+		t.Errorf("stored %d events, want 1", count)
+	}
+
+	// a retry only runs the subscriber that failed, with the same event ID
+	fail = false
+	if err := bus.process(context.Background(), row.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := sent(); len(got) != 2 || got["new@example.com welcome"] != 1 || got["new@example.com mail"] != 1 {
+		t.Errorf("queued %v after the retry, want one message per subscriber", got)
+	}
+	if len(ids) != 1 || ids[0] != row.ID {
+		t.Errorf("handlers got event IDs %v, want [%d]", ids, row.ID)
+	}
+	db.First(&row)
+	if row.ProcessedAt == nil || row.Attempts != 2 {
+		t.Errorf("event not processed after the retry: %+v", row)
+	}
+	if row.Payload == "" || strings.Contains(row.Payload, "hash") {
+		t.Errorf("stored payload %s", row.Payload)
+	}
+
+	// a processed event is not run again
+	if err := bus.process(context.Background(), row.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := sent(); len(got) != 2 || got["new@example.com mail"] != 1 {
+		t.Errorf("queued %v after processing twice", got)
+	}
+}
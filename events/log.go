@@ -0,0 +1,16 @@
+package events
+
+import (
+	"context"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// LogSubscriber writes one line per event with its name and ID, for audit
+// and analytics pipelines reading the logs. The payload, which can hold
+// personal data, stays in the event table.
+func LogSubscriber(ctx context.Context, tx *gorm.DB, id uint, e Event) error {
+	log.Printf("event %s %d", e.EventName(), id)
+	return nil
+}
@@ -0,0 +1,69 @@
+package events
+
+import "car-rental/entity"
+
+// Event names, shared with the partner webhook event types.
+const (
+	NameUserRegistered = "user.registered"
+	NameRentalCreated  = "rental.created"
+	NameRentalReturned = "rental.returned"
+	NameWalletToppedUp = "wallet.topped_up"
+	NameProductUpdated = "product.updated"
+)
+
+type UserRegistered struct {
+	User entity.User `json:"user"`
+}
+
+type RentalCreated struct {
+	User       entity.User           `json:"user"` // balances after the charge
+	Product    entity.Product        `json:"product"`
+	Record     entity.Record         `json:"record"`
+	RentLength uint                  `json:"rent_length"`
+	Price      entity.PriceBreakdown `json:"price"`
+	Invoice    entity.Invoice        `json:"invoice"`
+}
+
+type RentalReturned struct {
+	Record    entity.Record      `json:"record"`
+	LateFee   float64            `json:"late_fee"`
+	DamageFee float64            `json:"damage_fee"`
+	Hold      entity.DepositHold `json:"security_hold"`
+}
+
+type WalletToppedUp struct {
+	User    entity.User    `json:"user"` // balances after the top-up
+	Amount  float64        `json:"amount"`
+	Invoice entity.Invoice `json:"invoice"`
+}
+
+type ProductUpdated struct {
+	Product entity.Product `json:"product"`
+}
+
+func (UserRegistered) EventName() string { return NameUserRegistered }
+func (RentalCreated) EventName() string  { return NameRentalCreated }
+func (RentalReturned) EventName() string { return NameRentalReturned }
+func (WalletToppedUp) EventName() string { return NameWalletToppedUp }
+func (ProductUpdated) EventName() string { return NameProductUpdated }
+
+func init() {
+	register(UserRegistered{}, RentalCreated{}, RentalReturned{}, WalletToppedUp{}, ProductUpdated{})
+}
+
+// scrub drops the password hash of the users an event carries, so it never
+// reaches subscribers or the event table.
+func scrub(e Event) Event {
+	switch e := e.(type) {
+	case UserRegistered:
+		e.User.Password = ""
+		return e
+	case RentalCreated:
+		e.User.Password = ""
+		return e
+	case WalletToppedUp:
+		e.User.Password = ""
+		return e
+	}
+	return e
+}
@@ -0,0 +1,193 @@
+package fleet
+
+import (
+	"car-rental/audit"
+	"car-rental/currency"
+	"car-rental/entity"
+	"car-rental/events"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MaxRows is the most products one import takes.
+const MaxRows = 5000
+
+// Options of an import.
+type Options struct {
+	DryRun bool // validate and report, but keep nothing
+	Atomic bool // keep nothing if any row fails
+}
+
+// RowOf is the bulk form of a product.
+func RowOf(product entity.Product) entity.ProductRow {
+	return entity.ProductRow{
+		ID:          product.ID,
+		Name:        product.Name,
+		Description: product.Description,
+		RentalPrice: product.RentalPrice,
+		Currency:    product.Currency,
+		Stock:       product.Stock,
+		Category:    product.Category,
+		Branch:      product.Branch,
+		Version:     product.Version,
+		Archived:    product.DeletedAt.Valid,
+	}
+}
+
+// Validate checks a row before it is written.
+func Validate(db *gorm.DB, row entity.ProductRow) error {
+	if row.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if row.RentalPrice <= 0 {
+		return fmt.Errorf("rental_price must be positive")
+	}
+	if row.Stock < 0 {
+		return fmt.Errorf("stock cannot be negative")
+	}
+	supported, err := currency.Supported(db, currency.Or(row.Currency))
+	if err != nil {
+		return err
+	}
+	if !supported {
+		return fmt.Errorf("currency %s is not supported", row.Currency)
+	}
+	if row.Version > 0 && row.ID == 0 {
+		return fmt.Errorf("version needs an id")
+	}
+	return nil
+}
+
+// Row is one product of an import. Err is set when it could not be parsed.
+type Row struct {
+	N   int // 1 for the first product
+	Err error
+	entity.ProductRow
+}
+
+// Import creates the rows without an ID and updates the products of the
+// others in one transaction. Every row runs in its own savepoint so a
+// failing row does not undo the others, unless the import is atomic.
+// Updated products are published as events, flushed by the caller once
+// committed.
+func Import(db *gorm.DB, bus *events.Bus, actor audit.Actor, rows []Row, opts Options) (entity.ImportResult, events.Pending, error) {
+	res := entity.ImportResult{Rows: len(rows), DryRun: opts.DryRun, Errors: []entity.ImportError{}}
+	var pending events.Pending
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		return res, pending, tx.Error
+	}
+	var updated []events.Event
+	for _, row := range rows {
+		err := row.Err
+		if err == nil {
+			err = Validate(tx, row.ProductRow)
+		}
+		if err != nil {
+			res.Errors = append(res.Errors, entity.ImportError{Row: row.N, Error: err.Error()})
+			continue
+		}
+		if err := tx.SavePoint("import_row").Error; err != nil {
+			tx.Rollback()
+			return res, pending, err
+		}
+		product, created, err := write(tx, actor, row.ProductRow)
+		if err != nil {
+			if err := tx.RollbackTo("import_row").Error; err != nil {
+				tx.Rollback()
+				return res, pending, err
+			}
+			res.Errors = append(res.Errors, entity.ImportError{Row: row.N, Error: err.Error()})
+			continue
+		}
+		if created {
+			res.Created++
+		} else {
+			res.Updated++
+			updated = append(updated, events.ProductUpdated{Product: product})
+		}
+	}
+	res.Failed = len(res.Errors)
+
+	if opts.DryRun || (opts.Atomic && res.Failed > 0) {
+		return res, pending, tx.Rollback().Error
+	}
+	pending, err := bus.Stage(tx, updated...)
+	if err != nil {
+		tx.Rollback()
+		return res, pending, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return res, pending, err
+	}
+	res.Committed = true
+	return res, pending, nil
+}
+
+// write creates or updates the product of a valid row and audits it. A row
+// only updates a product in the same archived state, and only at its version
+// when it has one, so an import cannot undo a concurrent edit, archive or
+// restore.
+func write(tx *gorm.DB, actor audit.Actor, row entity.ProductRow) (entity.Product, bool, error) {
+	fields := map[string]any{
+		"name":         row.Name,
+		"description":  row.Description,
+		"rental_price": row.RentalPrice,
+		"currency":     currency.Or(row.Currency),
+		"stock":        row.Stock,
+		"category":     row.Category,
+		"branch":       row.Branch,
+	}
+	if row.ID == 0 {
+		product := entity.Product{
+			Name:        row.Name,
+			Description: row.Description,
+			RentalPrice: row.RentalPrice,
+			Currency:    currency.Or(row.Currency),
+			Stock:       row.Stock,
+			Category:    row.Category,
+			Branch:      row.Branch,
+		}
+		if row.Archived {
+			product.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+		}
+		if err := tx.Create(&product).Error; err != nil {
+			return product, true, err
+		}
+		return product, true, audit.Log(tx, actor, audit.Create, audit.Products, product.ID, nil, product)
+	}
+
+	var product entity.Product
+	result := tx.Unscoped().Where("id = ?", row.ID).Limit(1).Find(&product)
+	if result.Error != nil {
+		return product, false, result.Error
+	}
+	if product.ID == 0 {
+		return product, false, fmt.Errorf("product %d does not exist", row.ID)
+	}
+	if product.DeletedAt.Valid != row.Archived {
+		if row.Archived {
+			return product, false, fmt.Errorf("product %d is not archived", row.ID)
+		}
+		return product, false, fmt.Errorf("product %d is archived", row.ID)
+	}
+	if row.Version > 0 && row.Version != product.Version {
+		return product, false, fmt.Errorf("product %d changed since version %d", row.ID, row.Version)
+	}
+	before := product
+	fields["version"] = gorm.Expr("version + 1")
+	result = tx.Unscoped().Model(&product).Where("version = ?", product.Version).Updates(fields)
+	if result.Error != nil {
+		return product, false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return product, false, fmt.Errorf("product %d was modified concurrently", row.ID)
+	}
+	if err := tx.Unscoped().Where("id = ?", product.ID).First(&product).Error; err != nil {
+		return product, false, err
+	}
+	return product, false, audit.Log(tx, actor, audit.Update, audit.Products, product.ID, before, product)
+}
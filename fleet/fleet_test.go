@@ -0,0 +1,65 @@
+package fleet
+
+import (
+	"car-rental/audit"
+	"car-rental/entity"
+	"car-rental/events"
+	"car-rental/testdb"
+	"testing"
+)
+
+func TestImport(t *testing.T) {
+	db := testdb.Open(t)
+	live := entity.Product{Name: "Clio", RentalPrice: 30, Stock: 2}
+	edited := entity.Product{Name: "Golf", RentalPrice: 40, Stock: 1}
+	archived := entity.Product{Name: "Panda", RentalPrice: 20, Stock: 1}
+	db.Create(&live)
+	db.Create(&edited)
+	db.Create(&archived)
+	db.Delete(&archived)
+	// an admin edited the Golf after it was exported at version 1
+	db.Model(&edited).Updates(map[string]any{"rental_price": 45, "version": 2})
+
+	rows := []Row{
+		{N: 1, ProductRow: entity.ProductRow{ID: live.ID, Name: "Clio", RentalPrice: 35, Stock: 2, Version: 1}},
+		{N: 2, ProductRow: entity.ProductRow{ID: edited.ID, Name: "Golf", RentalPrice: 42, Stock: 1, Version: 1}},
+		{N: 3, ProductRow: entity.ProductRow{ID: archived.ID, Name: "Panda", RentalPrice: 18, Stock: 1, Archived: true}},
+		{N: 4, ProductRow: entity.ProductRow{ID: archived.ID, Name: "Panda", RentalPrice: 18, Stock: 1}},
+		{N: 5, ProductRow: entity.ProductRow{ID: live.ID, Name: "Clio", RentalPrice: 35, Stock: 2, Archived: true}},
+		{N: 6, ProductRow: entity.ProductRow{Name: "Twingo", RentalPrice: 25, Stock: 1, Archived: true}},
+		{N: 7, ProductRow: entity.ProductRow{Name: "Polo", RentalPrice: 25, Stock: 1, Version: 3}},
+	}
+	res, _, err := Import(db, events.NewBus(db), audit.Actor{Role: "admin"}, rows, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Created != 1 || res.Updated != 2 || res.Failed != 4 {
+		t.Errorf("got %+v, want 1 created, 2 updated and 4 failed", res)
+	}
+	failed := map[int]bool{}
+	for _, e := range res.Errors {
+		failed[e.Row] = true
+	}
+	for _, n := range []int{2, 4, 5, 7} {
+		if !failed[n] {
+			t.Errorf("row %d did not fail: %+v", n, res.Errors)
+		}
+	}
+
+	var products []entity.Product
+	db.Unscoped().Order("id").Find(&products)
+	want := []struct {
+		price    float64
+		version  uint
+		archived bool
+	}{{35, 2, false}, {45, 2, false}, {18, 2, true}, {25, 1, true}}
+	if len(products) != len(want) {
+		t.Fatalf("got %d products, want %d", len(products), len(want))
+	}
+	for i, p := range products {
+		row := RowOf(p)
+		if row.RentalPrice != want[i].price || row.Version != want[i].version || row.Archived != want[i].archived {
+			t.Errorf("%s exports as %+v, want %+v", p.Name, row, want[i])
+		}
+	}
+}
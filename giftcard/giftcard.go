@@ -0,0 +1,137 @@
+package giftcard
+
+import (
+	"car-rental/currency"
+	"car-rental/entity"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MaxBatch caps how many cards one bulk generation can create.
+const MaxBatch = 1000
+
+// ErrUnusable is returned when a code is unknown, redeemed, revoked or
+// expired. Customers are not told which, so codes cannot be probed.
+var ErrUnusable = errors.New("gift card cannot be redeemed")
+
+// NewCode generates an 80 bit code formatted as four groups of four.
+func NewCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := base32.StdEncoding.EncodeToString(b)
+	return code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16], nil
+}
+
+// NormalizeCode makes codes case insensitive and tolerant of missing dashes.
+func NormalizeCode(code string) string {
+	code = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	if len(code) != 16 {
+		return code
+	}
+	return code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16]
+}
+
+// ValidateBatch checks a bulk generation request.
+func ValidateBatch(db *gorm.DB, batch entity.GiftCardBatch, now time.Time) error {
+	if batch.Count < 1 || batch.Count > MaxBatch {
+		return fmt.Errorf("count must be between 1 and %d", MaxBatch)
+	}
+	if batch.Value <= 0 {
+		return fmt.Errorf("value must be positive")
+	}
+	if batch.ExpiresAt != nil && !batch.ExpiresAt.After(now) {
+		return fmt.Errorf("expires_at must be in the future")
+	}
+	supported, err := currency.Supported(db, batch.Currency)
+	if err != nil {
+		return err
+	}
+	if !supported {
+		return fmt.Errorf("currency %s is not supported", batch.Currency)
+	}
+	return nil
+}
+
+// Generate builds the cards of a batch, not yet stored.
+func Generate(batch entity.GiftCardBatch) ([]entity.GiftCard, error) {
+	cards := make([]entity.GiftCard, 0, batch.Count)
+	for i := 0; i < batch.Count; i++ {
+		code, err := NewCode()
+		if err != nil {
+			return nil, err
+		}
+		cards = append(cards, entity.GiftCard{
+			Code:      code,
+			Value:     batch.Value,
+			Currency:  currency.Or(batch.Currency),
+			Batch:     batch.Batch,
+			ExpiresAt: batch.ExpiresAt,
+		})
+	}
+	return cards, nil
+}
+
+// Status describes a card as active, redeemed, revoked or expired.
+func Status(card entity.GiftCard, now time.Time) string {
+	switch {
+	case card.RedeemedAt != nil:
+		return "redeemed"
+	case card.RevokedAt != nil:
+		return "revoked"
+	case card.ExpiresAt != nil && !card.ExpiresAt.After(now):
+		return "expired"
+	}
+	return "active"
+}
+
+// Redeem marks a card as redeemed by user and credits its value, converted
+// to the wallet currency, inside tx. The conditional update makes sure a
+// code is only used once even under concurrent requests.
+func Redeem(tx *gorm.DB, code string, user entity.User, now time.Time) (entity.GiftCard, float64, error) {
+	var card entity.GiftCard
+	result := tx.Where("code = ?", NormalizeCode(code)).Limit(1).Find(&card)
+	if result.Error != nil {
+		return card, 0, result.Error
+	}
+	if card.ID == 0 {
+		return card, 0, ErrUnusable
+	}
+	result = tx.Model(&entity.GiftCard{}).
+		Where("id = ? AND redeemed_at IS NULL AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", card.ID, now).
+		Updates(map[string]any{"redeemed_at": now, "redeemed_by": user.ID})
+	if result.Error != nil {
+		return card, 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return card, 0, ErrUnusable
+	}
+	card.RedeemedAt = &now
+	card.RedeemedBy = &user.ID
+
+	amount, rate, err := currency.Convert(tx, card.Value, card.Currency, user.Currency)
+	if err != nil {
+		return card, 0, err
+	}
+	result = tx.Model(&entity.User{}).Where("id = ?", user.ID).Update("deposit", gorm.Expr("deposit + ?", amount))
+	if result.Error != nil {
+		return card, 0, result.Error
+	}
+	result = tx.Create(&entity.LedgerEntry{
+		UserID:           user.ID,
+		Type:             "gift_card",
+		Amount:           amount,
+		Currency:         currency.Or(user.Currency),
+		OriginalAmount:   card.Value,
+		OriginalCurrency: card.Currency,
+		ExchangeRate:     rate,
+	})
+	return card, amount, result.Error
+}
@@ -0,0 +1,103 @@
+package giftcard
+
+import (
+	"car-rental/entity"
+	"car-rental/testdb"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestValidateBatch(t *testing.T) {
+	db := testdb.Open(t)
+	db.Create(&entity.ExchangeRate{Currency: "USD", Rate: 0.000064})
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	tests := []struct {
+		name  string
+		batch entity.GiftCardBatch
+		ok    bool
+	}{
+		{"base currency", entity.GiftCardBatch{Count: 10, Value: 100000}, true},
+		{"supported currency", entity.GiftCardBatch{Count: 10, Value: 10, Currency: "USD"}, true},
+		{"unsupported currency", entity.GiftCardBatch{Count: 10, Value: 10, Currency: "USDD"}, false},
+		{"too many", entity.GiftCardBatch{Count: MaxBatch + 1, Value: 10}, false},
+		{"no value", entity.GiftCardBatch{Count: 1}, false},
+		{"already expired", entity.GiftCardBatch{Count: 1, Value: 10, ExpiresAt: &past}, false},
+	}
+	for _, test := range tests {
+		err := ValidateBatch(db, test.batch, now)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: got %v", test.name, err)
+		}
+	}
+}
+
+func TestRedeemUnusable(t *testing.T) {
+	db := testdb.Open(t)
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	user := entity.User{Email: "bob@example.com"}
+	db.Create(&user)
+	cards := []entity.GiftCard{
+		{Code: "AAAA-AAAA-AAAA-AAAA", Value: 10, RedeemedAt: &past},
+		{Code: "BBBB-BBBB-BBBB-BBBB", Value: 10, RevokedAt: &past},
+		{Code: "CCCC-CCCC-CCCC-CCCC", Value: 10, ExpiresAt: &past},
+	}
+	db.Create(&cards)
+
+	// every reason looks the same to the customer
+	for _, code := range []string{"aaaaaaaaaaaaaaaa", "BBBB-BBBB-BBBB-BBBB", "CCCC-CCCC-CCCC-CCCC", "DDDD-DDDD-DDDD-DDDD"} {
+		_, _, err := Redeem(db, code, user, now)
+		if err != ErrUnusable {
+			t.Errorf("%s: got %v, want ErrUnusable", code, err)
+		}
+	}
+}
+
+func TestRedeemConcurrent(t *testing.T) {
+	db := testdb.Open(t)
+	card := entity.GiftCard{Code: "EEEE-EEEE-EEEE-EEEE", Value: 25}
+	db.Create(&card)
+	var users []entity.User
+	for i := 0; i < 10; i++ {
+		users = append(users, entity.User{Email: string(rune('a'+i)) + "@example.com"})
+	}
+	db.Create(&users)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(users))
+	for _, user := range users {
+		wg.Add(1)
+		go func(user entity.User) {
+			defer wg.Done()
+			errs <- db.Transaction(func(tx *gorm.DB) error {
+				_, _, err := Redeem(tx, card.Code, user, time.Now())
+				return err
+			})
+		}(user)
+	}
+	wg.Wait()
+	close(errs)
+
+	redeemed := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			redeemed++
+		case !errors.Is(err, ErrUnusable):
+			t.Fatal(err)
+		}
+	}
+	if redeemed != 1 {
+		t.Errorf("redeemed %d times, want once", redeemed)
+	}
+	var credited float64
+	db.Model(&entity.User{}).Select("SUM(deposit)").Scan(&credited)
+	if credited != 25 {
+		t.Errorf("credited %.2f in total, want 25", credited)
+	}
+}
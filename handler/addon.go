@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"car-rental/entity"
+	"car-rental/pricing"
+	"car-rental/utils"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ReadAllAddOns godoc
+//
+//	@Summary		Show all add-ons
+//	@Description	Show all add-ons that can be picked when renting
+//	@Tags			AddOn
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{array}		entity.AddOn
+//	@Failure		401	{object}	utils.ErrorResponse
+//	@Failure		500	{object}	utils.ErrorResponse
+//	@Router			/addons/ [get]
+func (ah AddOnHandler) ReadAllAddOns(c echo.Context) error {
+	var addOns []entity.AddOn
+	result := ah.DB.Where("disabled = ?", false).Order("id").Find(&addOns)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving data")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, addOns)
+	return nil
+}
+
+// CreateAddOn godoc
+//
+//	@Summary		Create add-on
+//	@Description	Insert a new add-on priced per_day or per_rental. A null stock means unlimited.
+//	@Tags			AddOn
+//	@Accept			json
+//	@Produce		json
+//	@Param			addon	body		entity.AddOn	true	"Add-on"
+//	@Success		201		{object}	entity.AddOn
+//	@Failure		400		{object}	utils.ErrorResponse
+//	@Failure		401		{object}	utils.ErrorResponse
+//	@Router			/addons/ [post]
+func (ah AddOnHandler) CreateAddOn(c echo.Context) error {
+	// get input
+	var addOn entity.AddOn
+	if err := c.Bind(&addOn); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+	addOn.ID = 0
+	if err := pricing.ValidateAddOn(addOn); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Invalid add-on")
+		return err
+	}
+
+	// insert data
+	result := ah.DB.Create(&addOn)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error inserting data")
+		return result.Error
+	}
+	c.JSON(http.StatusCreated, addOn)
+	return nil
+}
+
+// UpdateAddOn godoc
+//
+//	@Summary		Update add-on
+//	@Description	Replace the add-on targeted by the given ID. Rents already booked keep their price.
+//	@Tags			AddOn
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int				true	"Add-on ID"
+//	@Param			addon	body		entity.AddOn	true	"Add-on"
+//	@Success		200		{object}	entity.AddOn
+//	@Failure		400		{object}	utils.ErrorResponse
+//	@Failure		401		{object}	utils.ErrorResponse
+//	@Router			/addons/{id} [put]
+func (ah AddOnHandler) UpdateAddOn(c echo.Context) error {
+	// get add-on by ID
+	var stored entity.AddOn
+	result := ah.DB.Where("id = ?", c.Param("id")).First(&stored)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error retrieving add-on data")
+		return result.Error
+	}
+
+	// get input
+	var addOn entity.AddOn
+	if err := c.Bind(&addOn); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+	addOn.ID = stored.ID
+	if err := pricing.ValidateAddOn(addOn); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Invalid add-on")
+		return err
+	}
+
+	// replace data
+	result = ah.DB.Save(&addOn)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error updating data")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, addOn)
+	return nil
+}
+
+// DeleteAddOn godoc
+//
+//	@Summary		Delete add-on
+//	@Description	Delete the add-on targeted by the given ID. Add-ons already on rents are disabled instead.
+//	@Tags			AddOn
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"Add-on ID"
+//	@Success		200	{object}	string
+//	@Failure		400	{object}	utils.ErrorResponse
+//	@Failure		401	{object}	utils.ErrorResponse
+//	@Failure		500	{object}	utils.ErrorResponse
+//	@Router			/addons/{id} [delete]
+func (ah AddOnHandler) DeleteAddOn(c echo.Context) error {
+	var addOn entity.AddOn
+	result := ah.DB.Where("id = ?", c.Param("id")).First(&addOn)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error retrieving add-on data")
+		return result.Error
+	}
+
+	var used int64
+	ah.DB.Model(&entity.RecordAddOn{}).Where("add_on_id = ?", addOn.ID).Count(&used)
+	if used > 0 {
+		result = ah.DB.Model(&addOn).Update("disabled", true)
+		if result.Error != nil {
+			utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error disabling add-on")
+			return result.Error
+		}
+		c.JSON(http.StatusOK, map[string]any{
+			"message": "add-on was already rented and has been disabled",
+		})
+		return nil
+	}
+
+	result = ah.DB.Delete(&addOn)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error deleting add-on")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, map[string]any{
+		"message": "add-on successfully deleted",
+	})
+	return nil
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"car-rental/entity"
+	"car-rental/utils"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ReadAuditLog godoc
+//
+//	@Summary		Search audit log
+//	@Description	Show the latest 200 audit entries matching the filters, newest first. Use before_id with the last ID of a page to get the next one. field finds entries that changed the given field, e.g. rental_price or role.
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			actor_id	query		int		false	"User who made the change"
+//	@Param			resource	query		string	false	"user, product, record or wallet"
+//	@Param			resource_id	query		int		false	"Resource ID, the user ID for a wallet"
+//	@Param			action		query		string	false	"create, update or delete"
+//	@Param			field		query		string	false	"Changed field"
+//	@Param			ip			query		string	false	"IP address"
+//	@Param			request_id	query		string	false	"Request ID"
+//	@Param			from		query		string	false	"Start date, YYYY-MM-DD"
+//	@Param			to			query		string	false	"End date, YYYY-MM-DD, inclusive"
+//	@Param			before_id	query		int		false	"Only entries older than this ID"
+//	@Success		200			{array}		entity.AuditEntry
+//	@Failure		400			{object}	utils.ErrorResponse
+//	@Failure		401			{object}	utils.ErrorResponse
+//	@Failure		500			{object}	utils.ErrorResponse
+//	@Router			/admin/audit [get]
+func (ah AuditHandler) ReadAuditLog(c echo.Context) error {
+	query := ah.DB.Order("id DESC").Limit(200)
+	for param, column := range map[string]string{
+		"actor_id":    "actor_id",
+		"resource":    "resource",
+		"resource_id": "resource_id",
+		"action":      "action",
+		"ip":          "ip",
+		"request_id":  "request_id",
+	} {
+		if v := c.QueryParam(param); v != "" {
+			query = query.Where(column+" = ?", v)
+		}
+	}
+	if field := c.QueryParam("field"); field != "" {
+		changed, _ := json.Marshal([]string{field})
+		query = query.Where("changed::jsonb @> ?::jsonb", string(changed))
+	}
+	if id := c.QueryParam("before_id"); id != "" {
+		query = query.Where("id < ?", id)
+	}
+	if q := c.QueryParam("from"); q != "" {
+		from, err := time.ParseInLocation("2006-01-02", q, time.Local)
+		if err != nil {
+			utils.HandleError(c, http.StatusBadRequest, err, "Error reading from date")
+			return err
+		}
+		query = query.Where("created_at >= ?", from)
+	}
+	if q := c.QueryParam("to"); q != "" {
+		to, err := time.ParseInLocation("2006-01-02", q, time.Local)
+		if err != nil {
+			utils.HandleError(c, http.StatusBadRequest, err, "Error reading to date")
+			return err
+		}
+		query = query.Where("created_at < ?", to.AddDate(0, 0, 1))
+	}
+
+	var entries []entity.AuditEntry
+	result := query.Find(&entries)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving data")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, entries)
+	return nil
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"car-rental/currency"
+	"car-rental/entity"
+	"car-rental/utils"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// ReadRates godoc
+//
+//	@Summary		Show exchange rates
+//	@Description	Show the base currency and the exchange rates against it
+//	@Tags			Currency
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	currency.RatesFile
+//	@Failure		401	{object}	utils.ErrorResponse
+//	@Failure		500	{object}	utils.ErrorResponse
+//	@Router			/currencies/ [get]
+func (ch CurrencyHandler) ReadRates(c echo.Context) error {
+	var rates []entity.ExchangeRate
+	result := ch.DB.Order("currency").Find(&rates)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving data")
+		return result.Error
+	}
+	out := currency.RatesFile{Base: currency.Base(), Rates: map[string]float64{}}
+	for _, rate := range rates {
+		out.Rates[rate.Currency] = rate.Rate
+	}
+	c.JSON(http.StatusOK, out)
+	return nil
+}
+
+// SetRates godoc
+//
+//	@Summary		Set exchange rates
+//	@Description	Insert or update exchange rates, given as units of each currency per one unit of the base currency
+//	@Tags			Currency
+//	@Accept			json
+//	@Produce		json
+//	@Param			rates	body		map[string]number	true	"Rates by currency code"
+//	@Success		200		{object}	currency.RatesFile
+//	@Failure		400		{object}	utils.ErrorResponse
+//	@Failure		401		{object}	utils.ErrorResponse
+//	@Router			/currencies/rates [put]
+func (ch CurrencyHandler) SetRates(c echo.Context) error {
+	var rates map[string]float64
+	if err := c.Bind(&rates); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+	err := ch.DB.Transaction(func(tx *gorm.DB) error {
+		return currency.SaveRates(tx, rates)
+	})
+	if err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error saving rates")
+		return err
+	}
+	return ch.ReadRates(c)
+}
+
+// ReloadRates godoc
+//
+//	@Summary		Reload exchange rates
+//	@Description	Reload the exchange rates from the file set by EXCHANGE_RATES_FILE
+//	@Tags			Currency
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	currency.RatesFile
+//	@Failure		400	{object}	utils.ErrorResponse
+//	@Failure		401	{object}	utils.ErrorResponse
+//	@Router			/currencies/reload [post]
+func (ch CurrencyHandler) ReloadRates(c echo.Context) error {
+	path := os.Getenv("EXCHANGE_RATES_FILE")
+	if path == "" {
+		err := fmt.Errorf("EXCHANGE_RATES_FILE is not set")
+		utils.HandleError(c, http.StatusBadRequest, err, "No rates file configured")
+		return err
+	}
+	if err := currency.LoadFile(ch.DB, path); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error loading rates file")
+		return err
+	}
+	return ch.ReadRates(c)
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"car-rental/emails"
+	"car-rental/utils"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ReadEmailTemplates godoc
+//
+//	@Summary		Show email templates
+//	@Description	Show every email template name with the locales it is available in, including overrides from EMAIL_TEMPLATES_DIR
+//	@Tags			Email
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	map[string][]string
+//	@Failure		401	{object}	utils.ErrorResponse
+//	@Router			/emails/templates [get]
+func (eh EmailHandler) ReadEmailTemplates(c echo.Context) error {
+	c.JSON(http.StatusOK, emails.Templates())
+	return nil
+}
+
+// PreviewEmailTemplate godoc
+//
+//	@Summary		Preview email template
+//	@Description	Render an email template with sample data. The format html, text or sms returns only that part, otherwise every part is returned as json.
+//	@Tags			Email
+//	@Accept			json
+//	@Produce		json,html,plain
+//	@Param			name	path		string	true	"Template name"
+//	@Param			locale	query		string	false	"Locale, defaults to EMAIL_DEFAULT_LOCALE"
+//	@Param			format	query		string	false	"html, text or sms"
+//	@Success		200		{object}	emails.Email
+//	@Failure		400		{object}	utils.ErrorResponse
+//	@Failure		401		{object}	utils.ErrorResponse
+//	@Failure		404		{object}	utils.ErrorResponse
+//	@Router			/emails/templates/{name}/preview [get]
+func (eh EmailHandler) PreviewEmailTemplate(c echo.Context) error {
+	name := c.Param("name")
+	email, err := emails.Render(name, c.QueryParam("locale"), emails.Samples[name])
+	if errors.Is(err, emails.ErrUnknownTemplate) {
+		utils.HandleError(c, http.StatusNotFound, err, "Template not found")
+		return err
+	}
+	if err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error rendering template")
+		return err
+	}
+
+	switch c.QueryParam("format") {
+	case "html":
+		return c.HTML(http.StatusOK, email.HTML)
+	case "text":
+		return c.String(http.StatusOK, email.Text)
+	case "sms":
+		return c.String(http.StatusOK, email.SMS)
+	case "":
+		return c.JSON(http.StatusOK, email)
+	}
+	err = fmt.Errorf("unknown format %q", c.QueryParam("format"))
+	utils.HandleError(c, http.StatusBadRequest, err, "Error reading format")
+	return err
+}
@@ -0,0 +1,220 @@
+package handler
+
+import (
+	"bytes"
+	"car-rental/audit"
+	"car-rental/entity"
+	"car-rental/fleet"
+	"car-rental/utils"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const maxImportSize = 10 << 20 // 10 MB
+
+// ImportProducts godoc
+//
+//	@Summary		Import products
+//	@Description	Create or update products in bulk from a CSV file with a header row, or a JSON array, using the columns of the export. Rows with an id update that product, rows without one create a product; stock is the number of units. A row with a version only updates the product if it is still at that version. Archived rows update or create archived products, and only they match archived products. Each row is validated and reported on its own. With dry_run nothing is kept; with atomic nothing is kept when any row fails, answered with 422.
+//	@Tags			Product
+//	@Accept			json,text/csv
+//	@Produce		json
+//	@Param			format		query		string				false	"json or csv, defaults to the Content-Type"
+//	@Param			dry_run		query		bool				false	"Validate only"
+//	@Param			atomic		query		bool				false	"All or nothing"
+//	@Param			products	body		[]entity.ProductRow	true	"Products"
+//	@Success		200			{object}	entity.ImportResult
+//	@Failure		400			{object}	utils.ErrorResponse
+//	@Failure		401			{object}	utils.ErrorResponse
+//	@Failure		422			{object}	entity.ImportResult
+//	@Failure		500			{object}	utils.ErrorResponse
+//	@Router			/products/import [post]
+func (ph ProductHandler) ImportProducts(c echo.Context) error {
+	var opts fleet.Options
+	for param, dst := range map[string]*bool{"dry_run": &opts.DryRun, "atomic": &opts.Atomic} {
+		if q := c.QueryParam(param); q != "" {
+			v, err := strconv.ParseBool(q)
+			if err != nil {
+				err = fmt.Errorf("%s must be true or false", param)
+				utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+				return err
+			}
+			*dst = v
+		}
+	}
+
+	rows, err := readImport(c)
+	if err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading products")
+		return err
+	}
+	if len(rows) == 0 || len(rows) > fleet.MaxRows {
+		err = fmt.Errorf("import must have between 1 and %d products", fleet.MaxRows)
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading products")
+		return err
+	}
+
+	res, pending, err := fleet.Import(ph.DB, ph.Events, audit.ActorFrom(c), rows, opts)
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error importing products")
+		return err
+	}
+	ph.Events.Flush(c.Request().Context(), pending)
+	if opts.Atomic && res.Failed > 0 {
+		return c.JSON(http.StatusUnprocessableEntity, res)
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// readImport parses the request body as CSV or JSON rows. Rows that cannot
+// be parsed are returned with their error.
+func readImport(c echo.Context) ([]fleet.Row, error) {
+	format := c.QueryParam("format")
+	if format == "" {
+		format = "json"
+		if strings.Contains(c.Request().Header.Get(echo.HeaderContentType), "csv") {
+			format = "csv"
+		}
+	}
+	body := http.MaxBytesReader(c.Response(), c.Request().Body, maxImportSize)
+
+	var rows []fleet.Row
+	switch format {
+	case "csv":
+		dec, err := utils.NewCSVDecoder(body, reflect.TypeOf(entity.ProductRow{}))
+		if err != nil {
+			return nil, err
+		}
+		for n := 1; ; n++ {
+			row := fleet.Row{N: n}
+			err := dec.Decode(&row.ProductRow)
+			if err == io.EOF {
+				return rows, nil
+			}
+			var rowErr *utils.CSVRowError
+			if errors.As(err, &rowErr) {
+				row.Err = rowErr
+			} else if err != nil {
+				return nil, err
+			}
+			rows = append(rows, row)
+		}
+	case "json":
+		var raws []json.RawMessage
+		if err := json.NewDecoder(body).Decode(&raws); err != nil {
+			return nil, err
+		}
+		for i, raw := range raws {
+			row := fleet.Row{N: i + 1}
+			dec := json.NewDecoder(bytes.NewReader(raw))
+			dec.DisallowUnknownFields()
+			row.Err = dec.Decode(&row.ProductRow)
+			rows = append(rows, row)
+		}
+		return rows, nil
+	}
+	return nil, fmt.Errorf("format must be json or csv")
+}
+
+// ExportProducts godoc
+//
+//	@Summary		Export products
+//	@Description	Stream the whole catalog as CSV or a JSON array, in the format taken by the import, with the version and archived state of each product
+//	@Tags			Product
+//	@Accept			json
+//	@Produce		json,text/csv
+//	@Param			format		query		string	false	"json or csv"
+//	@Param			archived	query		bool	false	"Include archived products"
+//	@Success		200			{array}		entity.ProductRow
+//	@Failure		400			{object}	utils.ErrorResponse
+//	@Failure		401			{object}	utils.ErrorResponse
+//	@Failure		500			{object}	utils.ErrorResponse
+//	@Router			/products/export [get]
+func (ph ProductHandler) ExportProducts(c echo.Context) error {
+	format := c.QueryParam("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		err := fmt.Errorf("format must be json or csv")
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+	query := ph.DB.Model(&entity.Product{}).Order("id")
+	if c.QueryParam("archived") == "true" {
+		query = query.Unscoped()
+	}
+	rows, err := query.Rows()
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error retrieving data")
+		return err
+	}
+	defer rows.Close()
+
+	res := c.Response()
+	if format == "csv" {
+		res.Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+		res.Header().Set(echo.HeaderContentDisposition, `attachment; filename="products.csv"`)
+	} else {
+		res.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+	}
+	res.WriteHeader(http.StatusOK)
+
+	// write rows as they are read, flushing every batch
+	out := csv.NewWriter(res)
+	enc := json.NewEncoder(res)
+	if format == "csv" {
+		err = out.Write(utils.CSVHeader(reflect.TypeOf(entity.ProductRow{})))
+	} else {
+		_, err = io.WriteString(res, "[")
+	}
+	if err != nil {
+		return err
+	}
+	for n := 0; rows.Next(); n++ {
+		var product entity.Product
+		if err := ph.DB.ScanRows(rows, &product); err != nil {
+			return err
+		}
+		row := fleet.RowOf(product)
+		if format == "csv" {
+			err = out.Write(utils.CSVRecord(row))
+		} else {
+			if n > 0 {
+				if _, err := io.WriteString(res, ","); err != nil {
+					return err
+				}
+			}
+			err = enc.Encode(row)
+		}
+		if err != nil {
+			return err
+		}
+		if n%100 == 99 {
+			out.Flush()
+			if err := out.Error(); err != nil {
+				return err
+			}
+			res.Flush()
+		}
+	}
+	if format == "json" {
+		if _, err := io.WriteString(res, "]\n"); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		return err
+	}
+	return rows.Err()
+}
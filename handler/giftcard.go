@@ -0,0 +1,269 @@
+package handler
+
+import (
+	"car-rental/audit"
+	"car-rental/currency"
+	"car-rental/entity"
+	"car-rental/giftcard"
+	"car-rental/pricing"
+	"car-rental/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RedeemGiftCard godoc
+//
+//	@Summary		Redeem gift card
+//	@Description	Redeem a gift card code into the logged in user's deposit, converted to the wallet currency. A code can only be redeemed once.
+//	@Tags			GiftCard
+//	@Accept			json
+//	@Produce		json
+//	@Param			code	body		entity.GiftCardRedeem	true	"Gift card code"
+//	@Success		200		{object}	string
+//	@Failure		400		{object}	utils.ErrorResponse
+//	@Failure		401		{object}	utils.ErrorResponse
+//	@Failure		409		{object}	utils.ErrorResponse
+//	@Router			/giftcards/redeem [post]
+func (gh GiftCardHandler) RedeemGiftCard(c echo.Context) error {
+	// get user from auth token
+	claims, err := utils.DecodeToken(c)
+	if err != nil {
+		utils.HandleError(c, http.StatusUnauthorized, err, "Error reading token")
+		return err
+	}
+	var user entity.User
+	result := gh.DB.Where("id = ?", claims["userID"]).First(&user)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving user data")
+		return result.Error
+	}
+
+	var input entity.GiftCardRedeem
+	if err := c.Bind(&input); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+
+	tx := gh.DB.Begin()
+	wallets, err := audit.SnapshotWallets(tx, user.ID)
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error reading wallet")
+		tx.Rollback()
+		return err
+	}
+	card, amount, err := giftcard.Redeem(tx, input.Code, user, time.Now())
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, giftcard.ErrUnusable) {
+			status = http.StatusConflict
+		}
+		utils.HandleError(c, status, err, "Gift card cannot be redeemed")
+		tx.Rollback()
+		return err
+	}
+	// the credit pays off unpaid return fees first
+	if _, err := pricing.PayOwed(tx, user.ID); err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error paying owed fees")
+		tx.Rollback()
+		return err
+	}
+	if err := wallets.Log(tx, audit.ActorFrom(c)); err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error writing audit log")
+		tx.Rollback()
+		return err
+	}
+	result = tx.Commit()
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "commit error?")
+		return result.Error
+	}
+
+	gh.DB.Where("id = ?", user.ID).First(&user)
+	c.JSON(http.StatusOK, map[string]any{
+		"gift_card":    card,
+		"credited":     amount,
+		"currency":     currency.Or(user.Currency),
+		"user_balance": user.Deposit,
+		"owed":         user.Owed,
+	})
+	return nil
+}
+
+// ReadAllGiftCards godoc
+//
+//	@Summary		Show all gift cards
+//	@Description	Show gift cards, optionally only those of a batch or with a status of active, redeemed, revoked or expired
+//	@Tags			GiftCard
+//	@Accept			json
+//	@Produce		json
+//	@Param			batch	query		string	false	"Batch label"
+//	@Param			status	query		string	false	"active, redeemed, revoked or expired"
+//	@Success		200		{array}		entity.GiftCard
+//	@Failure		400		{object}	utils.ErrorResponse
+//	@Failure		401		{object}	utils.ErrorResponse
+//	@Failure		500		{object}	utils.ErrorResponse
+//	@Router			/giftcards/ [get]
+func (gh GiftCardHandler) ReadAllGiftCards(c echo.Context) error {
+	now := time.Now()
+	query := gh.DB.Order("id")
+	if batch := c.QueryParam("batch"); batch != "" {
+		query = query.Where("batch = ?", batch)
+	}
+	switch c.QueryParam("status") {
+	case "":
+	case "active":
+		query = query.Where("redeemed_at IS NULL AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", now)
+	case "redeemed":
+		query = query.Where("redeemed_at IS NOT NULL")
+	case "revoked":
+		query = query.Where("redeemed_at IS NULL AND revoked_at IS NOT NULL")
+	case "expired":
+		query = query.Where("redeemed_at IS NULL AND revoked_at IS NULL AND expires_at <= ?", now)
+	default:
+		err := fmt.Errorf("unknown status %q", c.QueryParam("status"))
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading status")
+		return err
+	}
+
+	var cards []entity.GiftCard
+	result := query.Find(&cards)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving data")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, cards)
+	return nil
+}
+
+// GenerateGiftCards godoc
+//
+//	@Summary		Generate gift cards
+//	@Description	Generate up to 1000 gift cards of the same value with random codes, labelled with a batch name and an optional expiry date
+//	@Tags			GiftCard
+//	@Accept			json
+//	@Produce		json
+//	@Param			batch	body		entity.GiftCardBatch	true	"Batch to generate"
+//	@Success		201		{array}		entity.GiftCard
+//	@Failure		400		{object}	utils.ErrorResponse
+//	@Failure		401		{object}	utils.ErrorResponse
+//	@Failure		500		{object}	utils.ErrorResponse
+//	@Router			/giftcards/ [post]
+func (gh GiftCardHandler) GenerateGiftCards(c echo.Context) error {
+	var batch entity.GiftCardBatch
+	if err := c.Bind(&batch); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+	if err := giftcard.ValidateBatch(gh.DB, batch, time.Now()); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Invalid gift card batch")
+		return err
+	}
+	cards, err := giftcard.Generate(batch)
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error generating codes")
+		return err
+	}
+	result := gh.DB.Create(&cards)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error inserting data")
+		return result.Error
+	}
+	c.JSON(http.StatusCreated, cards)
+	return nil
+}
+
+// RevokeGiftCard godoc
+//
+//	@Summary		Revoke gift card
+//	@Description	Revoke the gift card targeted by the given ID so it can no longer be redeemed
+//	@Tags			GiftCard
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"Gift card ID"
+//	@Success		200	{object}	entity.GiftCard
+//	@Failure		400	{object}	utils.ErrorResponse
+//	@Failure		401	{object}	utils.ErrorResponse
+//	@Failure		409	{object}	utils.ErrorResponse
+//	@Router			/giftcards/{id}/revoke [post]
+func (gh GiftCardHandler) RevokeGiftCard(c echo.Context) error {
+	var card entity.GiftCard
+	result := gh.DB.Where("id = ?", c.Param("id")).First(&card)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error retrieving gift card data")
+		return result.Error
+	}
+	result = gh.DB.Model(&card).Where("redeemed_at IS NULL AND revoked_at IS NULL").Update("revoked_at", time.Now())
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error revoking gift card")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		err := fmt.Errorf("gift card %d is already %s", card.ID, giftcard.Status(card, time.Now()))
+		utils.HandleError(c, http.StatusConflict, err, "Gift card cannot be revoked")
+		return err
+	}
+	gh.DB.Where("id = ?", card.ID).First(&card)
+	c.JSON(http.StatusOK, card)
+	return nil
+}
+
+// GiftCardReport godoc
+//
+//	@Summary		Gift card report
+//	@Description	Count and sum the value of gift cards issued in a period per currency, split into redeemed, revoked, expired and still outstanding
+//	@Tags			GiftCard
+//	@Accept			json
+//	@Produce		json
+//	@Param			from	query		string	false	"Start date, YYYY-MM-DD, defaults to every card"
+//	@Param			to		query		string	false	"End date, YYYY-MM-DD, inclusive, defaults to today"
+//	@Success		200		{array}		entity.GiftCardReportRow
+//	@Failure		400		{object}	utils.ErrorResponse
+//	@Failure		401		{object}	utils.ErrorResponse
+//	@Failure		500		{object}	utils.ErrorResponse
+//	@Router			/giftcards/report [get]
+func (gh GiftCardHandler) GiftCardReport(c echo.Context) error {
+	now := time.Now()
+	var from time.Time
+	to := now
+	var err error
+	if q := c.QueryParam("from"); q != "" {
+		if from, err = time.ParseInLocation("2006-01-02", q, now.Location()); err != nil {
+			utils.HandleError(c, http.StatusBadRequest, err, "Error reading from date")
+			return err
+		}
+	}
+	if q := c.QueryParam("to"); q != "" {
+		if to, err = time.ParseInLocation("2006-01-02", q, now.Location()); err != nil {
+			utils.HandleError(c, http.StatusBadRequest, err, "Error reading to date")
+			return err
+		}
+	}
+
+	const (
+		redeemed = "redeemed_at IS NOT NULL"
+		revoked  = "redeemed_at IS NULL AND revoked_at IS NOT NULL"
+		expired  = "redeemed_at IS NULL AND revoked_at IS NULL AND expires_at <= @now"
+		active   = "redeemed_at IS NULL AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > @now)"
+	)
+	var rows []entity.GiftCardReportRow
+	result := gh.DB.Model(&entity.GiftCard{}).
+		Select(`currency, COUNT(*) AS issued, SUM(value) AS issued_value,
+			COUNT(*) FILTER (WHERE `+redeemed+`) AS redeemed, COALESCE(SUM(value) FILTER (WHERE `+redeemed+`), 0) AS redeemed_value,
+			COUNT(*) FILTER (WHERE `+revoked+`) AS revoked, COALESCE(SUM(value) FILTER (WHERE `+revoked+`), 0) AS revoked_value,
+			COUNT(*) FILTER (WHERE `+expired+`) AS expired, COALESCE(SUM(value) FILTER (WHERE `+expired+`), 0) AS expired_value,
+			COALESCE(SUM(value) FILTER (WHERE `+active+`), 0) AS outstanding_value`, map[string]any{"now": now}).
+		Where("created_at >= ? AND created_at < ?", from, to.AddDate(0, 0, 1)).
+		Group("currency").
+		Order("currency").
+		Scan(&rows)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving data")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, rows)
+	return nil
+}
@@ -1,13 +1,63 @@
 package handler
 
-import "gorm.io/gorm"
+import (
+	"car-rental/events"
+	"car-rental/payout"
+	"car-rental/pricing"
+	"car-rental/storage"
+
+	"gorm.io/gorm"
+)
 
 type UserHandler struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	Events *events.Bus
 }
 type ProductHandler struct {
-	DB *gorm.DB
+	DB      *gorm.DB
+	Storage storage.Storage
+	Events  *events.Bus
 }
 type RentalHandler struct {
+	DB      *gorm.DB
+	Pricing pricing.Service
+	Events  *events.Bus
+}
+type PricingHandler struct {
+	DB *gorm.DB
+}
+type PromoHandler struct {
+	DB *gorm.DB
+}
+type AddOnHandler struct {
+	DB *gorm.DB
+}
+type TaxHandler struct {
+	DB *gorm.DB
+}
+type CurrencyHandler struct {
+	DB *gorm.DB
+}
+type LoyaltyHandler struct {
+	DB *gorm.DB
+}
+type GiftCardHandler struct {
+	DB *gorm.DB
+}
+type WithdrawalHandler struct {
+	DB      *gorm.DB
+	Payouts payout.Provider
+}
+type OutboxHandler struct {
+	DB *gorm.DB
+}
+type EmailHandler struct{}
+type WebhookHandler struct {
+	DB *gorm.DB
+}
+type AuditHandler struct {
+	DB *gorm.DB
+}
+type ReportHandler struct {
 	DB *gorm.DB
 }
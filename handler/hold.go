@@ -0,0 +1,306 @@
+package handler
+
+import (
+	"car-rental/audit"
+	"car-rental/currency"
+	"car-rental/entity"
+	"car-rental/events"
+	"car-rental/pricing"
+	"car-rental/referral"
+	"car-rental/utils"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ReadHoldPolicies godoc
+//
+//	@Summary		Show security hold policies
+//	@Description	Show the refundable security hold taken per product category at booking
+//	@Tags			Rental
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{array}		entity.HoldPolicy
+//	@Failure		401	{object}	utils.ErrorResponse
+//	@Failure		500	{object}	utils.ErrorResponse
+//	@Router			/rent/holds/policies [get]
+func (rh RentalHandler) ReadHoldPolicies(c echo.Context) error {
+	var policies []entity.HoldPolicy
+	result := rh.DB.Order("category").Find(&policies)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving data")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, policies)
+	return nil
+}
+
+// SetHoldPolicy godoc
+//
+//	@Summary		Set security hold policy
+//	@Description	Set the refundable security hold taken when renting a product of the given category, 0 disables it
+//	@Tags			Rental
+//	@Accept			json
+//	@Produce		json
+//	@Param			category	path		string				true	"Product category"
+//	@Param			policy		body		entity.HoldPolicy	true	"Hold amount"
+//	@Success		200			{object}	entity.HoldPolicy
+//	@Failure		400			{object}	utils.ErrorResponse
+//	@Failure		401			{object}	utils.ErrorResponse
+//	@Router			/rent/holds/policies/{category} [put]
+func (rh RentalHandler) SetHoldPolicy(c echo.Context) error {
+	var policy entity.HoldPolicy
+	if err := c.Bind(&policy); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+	policy.Category = c.Param("category")
+	if policy.Amount < 0 {
+		err := fmt.Errorf("hold amount cannot be negative")
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+
+	result := rh.DB.Save(&policy)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error saving data")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, policy)
+	return nil
+}
+
+// ReturnRent godoc
+//
+//	@Summary		Return a rent
+//	@Description	Close the rent targeted by the given ID after the return inspection. Late days are charged at the daily rate the rent was booked at. Damage and late fees are captured from the security hold and the rest of the hold is released. Fees above the hold are charged from the available deposit, and what it cannot cover is recorded as owed and paid off by the next top-up. The damage fee is given in the currency of the user's wallet.
+//	@Tags			Rental
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			path		int						true	"Record ID"
+//	@Param			inspection	body		entity.ReturnInspection	true	"Return inspection"
+//	@Success		200			{object}	string
+//	@Failure		400			{object}	utils.ErrorResponse
+//	@Failure		401			{object}	utils.ErrorResponse
+//	@Failure		500			{object}	utils.ErrorResponse
+//	@Router			/rent/{id}/return [post]
+func (rh RentalHandler) ReturnRent(c echo.Context) error {
+	// read input
+	var inspection entity.ReturnInspection
+	if err := c.Bind(&inspection); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+	if inspection.DamageFee < 0 {
+		err := fmt.Errorf("damage fee cannot be negative")
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+
+	// get record and its product
+	var record entity.Record
+	result := rh.DB.Where("id = ?", c.Param("id")).First(&record)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error retrieving record data")
+		return result.Error
+	}
+	var product entity.Product
+	result = rh.DB.Unscoped().Where("id = ?", record.ProductID).First(&product)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving product data")
+		return result.Error
+	}
+
+	// late fee per started day after the end date, at the booked daily rate
+	now := time.Now()
+	var lateFee float64
+	if now.After(record.EndDate) {
+		dailyRate := record.DailyRate
+		if dailyRate == 0 {
+			// booked before the rate was stored
+			rate, _, err := currency.Convert(rh.DB, product.RentalPrice, product.Currency, record.Currency)
+			if err != nil {
+				utils.HandleError(c, http.StatusInternalServerError, err, "Error converting late fee")
+				return err
+			}
+			dailyRate = rate
+		}
+		lateDays := math.Ceil(now.Sub(record.EndDate).Hours() / 24)
+		lateFee = math.Round(lateDays*dailyRate*100) / 100
+	}
+	// the damage fee is given in the hold currency, the late fee is in the
+	// rent currency
+	var hold entity.DepositHold
+	result = rh.DB.Where("record_id = ?", record.ID).First(&hold)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving security hold")
+		return result.Error
+	}
+	holdCurrency := hold.Currency
+	if hold.ID == 0 {
+		var user entity.User
+		rh.DB.Where("id = ?", record.UserID).First(&user)
+		holdCurrency = user.Currency
+	}
+	lateFeeConverted, _, err := currency.Convert(rh.DB, lateFee, record.Currency, holdCurrency)
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error converting late fee")
+		return err
+	}
+	fees := inspection.DamageFee + lateFeeConverted
+
+	tx := rh.DB.Begin()
+	// the referrer is credited too when this is the referred user's first rent
+	referrerID, err := referral.PendingReferrer(tx, record.UserID)
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error retrieving referral")
+		tx.Rollback()
+		return err
+	}
+	wallets, err := audit.SnapshotWallets(tx, record.UserID, referrerID)
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error reading wallet")
+		tx.Rollback()
+		return err
+	}
+	before := record
+	// mark record as returned
+	result = tx.Model(&record).Where("returned_at IS NULL").Update("returned_at", now)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error updating record")
+		tx.Rollback()
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		err := fmt.Errorf("record %d is already returned", record.ID)
+		utils.HandleError(c, http.StatusBadRequest, err, "Rent is already returned")
+		tx.Rollback()
+		return err
+	}
+
+	// settle the security hold
+	hold = entity.DepositHold{}
+	result = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("record_id = ? AND status = ?", record.ID, pricing.HoldHeld).First(&hold)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving security hold")
+		tx.Rollback()
+		return result.Error
+	}
+	if hold.ID != 0 {
+		hold.Captured = math.Min(fees, hold.Amount)
+		hold.Status = pricing.HoldReleased
+		if hold.Captured > 0 {
+			hold.Status = pricing.HoldCaptured
+		}
+		hold.Notes = inspection.Notes
+		hold.SettledAt = &now
+		result = tx.Save(&hold)
+		if result.Error != nil {
+			utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error settling security hold")
+			tx.Rollback()
+			return result.Error
+		}
+		result = tx.Model(&entity.User{}).
+			Where("id = ? AND deposit >= ? AND reserved >= ?", hold.UserID, hold.Captured, hold.Amount).
+			Updates(map[string]any{
+				"deposit":  gorm.Expr("deposit - ?", hold.Captured),
+				"reserved": gorm.Expr("reserved - ?", hold.Amount),
+			})
+		if result.Error != nil {
+			utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error updating user")
+			tx.Rollback()
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			err := fmt.Errorf("wallet of user %d no longer holds the security hold of %.2f", hold.UserID, hold.Amount)
+			utils.HandleError(c, http.StatusInternalServerError, err, "Error settling security hold")
+			tx.Rollback()
+			return err
+		}
+		if hold.Captured > 0 {
+			result = tx.Create(&entity.LedgerEntry{
+				UserID:           hold.UserID,
+				Type:             "hold_capture",
+				Amount:           -hold.Captured,
+				Currency:         currency.Or(hold.Currency),
+				OriginalAmount:   -hold.Captured,
+				OriginalCurrency: currency.Or(hold.Currency),
+				ExchangeRate:     1,
+				RecordID:         &record.ID,
+			})
+			if result.Error != nil {
+				utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error inserting ledger entry")
+				tx.Rollback()
+				return result.Error
+			}
+		}
+	}
+
+	// charge fees above the hold from the deposit, recording what it cannot cover
+	var charged, owed float64
+	if remainder := math.Round((fees-hold.Captured)*100) / 100; remainder > 0 {
+		charged, owed, err = pricing.ChargeFees(tx, record.UserID, remainder, &record.ID)
+		if err != nil {
+			utils.HandleError(c, http.StatusInternalServerError, err, "Error charging fees")
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// reward the referral once the referred user completes their first rent
+	if _, err := referral.Complete(tx, record.UserID, now); err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error rewarding referral")
+		tx.Rollback()
+		return err
+	}
+
+	record.ReturnedAt = &now
+	actor := audit.ActorFrom(c)
+	if err := audit.Log(tx, actor, audit.Update, audit.Records, record.ID, before, record); err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error writing audit log")
+		tx.Rollback()
+		return err
+	}
+	if err := wallets.Log(tx, actor); err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error writing audit log")
+		tx.Rollback()
+		return err
+	}
+	pending, err := rh.Events.Stage(tx, events.RentalReturned{
+		Record:    record,
+		LateFee:   lateFee,
+		DamageFee: inspection.DamageFee,
+		Hold:      hold,
+	})
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error recording events")
+		tx.Rollback()
+		return err
+	}
+
+	result = tx.Commit()
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "commit error?")
+		return result.Error
+	}
+	rh.Events.Flush(c.Request().Context(), pending)
+
+	rh.DB.Where("id = ?", record.ID).First(&record)
+	c.JSON(http.StatusOK, map[string]any{
+		"rental_record":     record,
+		"late_fee":          lateFee,
+		"late_fee_currency": currency.Or(record.Currency),
+		"damage_fee":        inspection.DamageFee,
+		"fee_currency":      currency.Or(holdCurrency),
+		"security_hold":     hold,
+		"charged":           charged,
+		"outstanding":       owed,
+	})
+	return nil
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"car-rental/entity"
+	"car-rental/invoice"
+	"car-rental/utils"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetRentInvoice godoc
+//
+//	@Summary		Get rent invoice
+//	@Description	Show the invoice of the rent targeted by the given ID as JSON, or as a PDF with format=pdf or an Accept: application/pdf header. Only the renting user and admins can see it.
+//	@Tags			Rental
+//	@Accept			json
+//	@Produce		json,application/pdf
+//	@Param			id		path		int		true	"Record ID"
+//	@Param			format	query		string	false	"json or pdf"
+//	@Success		200		{object}	entity.Invoice
+//	@Failure		400		{object}	utils.ErrorResponse
+//	@Failure		401		{object}	utils.ErrorResponse
+//	@Failure		403		{object}	utils.ErrorResponse
+//	@Router			/rent/{id}/invoice [get]
+func (rh RentalHandler) GetRentInvoice(c echo.Context) error {
+	var inv entity.Invoice
+	result := rh.DB.Where("record_id = ? AND kind = ?", c.Param("id"), invoice.KindRental).First(&inv)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error retrieving invoice data")
+		return result.Error
+	}
+	return writeInvoice(c, inv)
+}
+
+// ReadInvoices godoc
+//
+//	@Summary		Show user invoices
+//	@Description	Show all rent and top up invoices of the logged in user
+//	@Tags			User
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{array}		entity.Invoice
+//	@Failure		401	{object}	utils.ErrorResponse
+//	@Failure		500	{object}	utils.ErrorResponse
+//	@Router			/users/invoices [get]
+func (uh UserHandler) ReadInvoices(c echo.Context) error {
+	claims, err := utils.DecodeToken(c)
+	if err != nil {
+		utils.HandleError(c, http.StatusUnauthorized, err, "Error reading token")
+		return err
+	}
+	var invoices []entity.Invoice
+	result := uh.DB.Where("user_id = ?", claims["userID"]).Order("sequence").Find(&invoices)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving data")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, invoices)
+	return nil
+}
+
+// ReadInvoiceByNumber godoc
+//
+//	@Summary		Get invoice
+//	@Description	Show an invoice by its number as JSON, or as a PDF with format=pdf or an Accept: application/pdf header. Only its user and admins can see it.
+//	@Tags			User
+//	@Accept			json
+//	@Produce		json,application/pdf
+//	@Param			number	path		string	true	"Invoice number"
+//	@Param			format	query		string	false	"json or pdf"
+//	@Success		200		{object}	entity.Invoice
+//	@Failure		400		{object}	utils.ErrorResponse
+//	@Failure		401		{object}	utils.ErrorResponse
+//	@Failure		403		{object}	utils.ErrorResponse
+//	@Router			/users/invoices/{number} [get]
+func (uh UserHandler) ReadInvoiceByNumber(c echo.Context) error {
+	var inv entity.Invoice
+	result := uh.DB.Where("number = ?", c.Param("number")).First(&inv)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error retrieving invoice data")
+		return result.Error
+	}
+	return writeInvoice(c, inv)
+}
+
+// writeInvoice answers with inv as JSON or PDF, after checking the caller
+// owns it or is an admin.
+func writeInvoice(c echo.Context, inv entity.Invoice) error {
+	claims, err := utils.DecodeToken(c)
+	if err != nil {
+		utils.HandleError(c, http.StatusUnauthorized, err, "Error reading token")
+		return err
+	}
+	if claims["userRole"] != "admin" && claims["userID"] != float64(inv.UserID) {
+		err = fmt.Errorf("invoice %s belongs to another user", inv.Number)
+		utils.HandleError(c, http.StatusForbidden, err, "Not allowed to see this invoice")
+		return err
+	}
+
+	if c.QueryParam("format") == "pdf" || strings.Contains(c.Request().Header.Get("Accept"), "application/pdf") {
+		c.Response().Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pdf"`, inv.Number))
+		return c.Blob(http.StatusOK, "application/pdf", invoice.RenderPDF(inv))
+	}
+	c.JSON(http.StatusOK, inv)
+	return nil
+}
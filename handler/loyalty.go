@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"car-rental/entity"
+	"car-rental/loyalty"
+	"car-rental/utils"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ReadAllTiers godoc
+//
+//	@Summary		Show all loyalty tiers
+//	@Description	Show all loyalty tiers ordered by the rolling yearly spend that unlocks them
+//	@Tags			Loyalty
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{array}		entity.LoyaltyTier
+//	@Failure		401	{object}	utils.ErrorResponse
+//	@Failure		500	{object}	utils.ErrorResponse
+//	@Router			/loyalty/tiers [get]
+func (lh LoyaltyHandler) ReadAllTiers(c echo.Context) error {
+	var tiers []entity.LoyaltyTier
+	result := lh.DB.Order("min_spend").Find(&tiers)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving data")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, tiers)
+	return nil
+}
+
+// CreateTier godoc
+//
+//	@Summary		Create loyalty tier
+//	@Description	Insert a new loyalty tier. Users whose spend on returned rents over the last year reaches min_spend, in the base currency, get its discount and one free unit of its add-on.
+//	@Tags			Loyalty
+//	@Accept			json
+//	@Produce		json
+//	@Param			tier	body		entity.LoyaltyTier	true	"Loyalty tier"
+//	@Success		201		{object}	entity.LoyaltyTier
+//	@Failure		400		{object}	utils.ErrorResponse
+//	@Failure		401		{object}	utils.ErrorResponse
+//	@Router			/loyalty/tiers [post]
+func (lh LoyaltyHandler) CreateTier(c echo.Context) error {
+	var tier entity.LoyaltyTier
+	if err := c.Bind(&tier); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+	tier.ID = 0
+	if err := loyalty.ValidateTier(tier); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Invalid loyalty tier")
+		return err
+	}
+
+	result := lh.DB.Create(&tier)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error inserting data")
+		return result.Error
+	}
+	c.JSON(http.StatusCreated, tier)
+	return nil
+}
+
+// UpdateTier godoc
+//
+//	@Summary		Update loyalty tier
+//	@Description	Replace the loyalty tier targeted by the given ID. Rents already booked keep their price.
+//	@Tags			Loyalty
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int					true	"Tier ID"
+//	@Param			tier	body		entity.LoyaltyTier	true	"Loyalty tier"
+//	@Success		200		{object}	entity.LoyaltyTier
+//	@Failure		400		{object}	utils.ErrorResponse
+//	@Failure		401		{object}	utils.ErrorResponse
+//	@Router			/loyalty/tiers/{id} [put]
+func (lh LoyaltyHandler) UpdateTier(c echo.Context) error {
+	var stored entity.LoyaltyTier
+	result := lh.DB.Where("id = ?", c.Param("id")).First(&stored)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error retrieving tier data")
+		return result.Error
+	}
+
+	var tier entity.LoyaltyTier
+	if err := c.Bind(&tier); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+	tier.ID = stored.ID
+	if err := loyalty.ValidateTier(tier); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Invalid loyalty tier")
+		return err
+	}
+
+	result = lh.DB.Save(&tier)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error updating data")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, tier)
+	return nil
+}
+
+// DeleteTier godoc
+//
+//	@Summary		Delete loyalty tier
+//	@Description	Delete the loyalty tier targeted by the given ID
+//	@Tags			Loyalty
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"Tier ID"
+//	@Success		200	{object}	string
+//	@Failure		400	{object}	utils.ErrorResponse
+//	@Failure		401	{object}	utils.ErrorResponse
+//	@Failure		500	{object}	utils.ErrorResponse
+//	@Router			/loyalty/tiers/{id} [delete]
+func (lh LoyaltyHandler) DeleteTier(c echo.Context) error {
+	var tier entity.LoyaltyTier
+	result := lh.DB.Where("id = ?", c.Param("id")).First(&tier)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error retrieving tier data")
+		return result.Error
+	}
+	result = lh.DB.Delete(&tier)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error deleting tier")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, map[string]any{
+		"message": "tier successfully deleted",
+	})
+	return nil
+}
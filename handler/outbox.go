@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"car-rental/entity"
+	"car-rental/outbox"
+	"car-rental/utils"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ReadOutbox godoc
+//
+//	@Summary		Show outbox messages
+//	@Description	Show queued emails without their attachments, optionally only those with a status of pending, sending, sent or dead
+//	@Tags			Outbox
+//	@Accept			json
+//	@Produce		json
+//	@Param			status	query		string	false	"Message status"
+//	@Success		200		{array}		entity.OutboxMessage
+//	@Failure		401		{object}	utils.ErrorResponse
+//	@Failure		500		{object}	utils.ErrorResponse
+//	@Router			/outbox/ [get]
+func (oh OutboxHandler) ReadOutbox(c echo.Context) error {
+	query := oh.DB.Omit("attachments").Order("id DESC").Limit(200)
+	if status := c.QueryParam("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var msgs []entity.OutboxMessage
+	result := query.Find(&msgs)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving data")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, msgs)
+	return nil
+}
+
+// RetryOutboxMessage godoc
+//
+//	@Summary		Retry dead outbox message
+//	@Description	Put a dead-lettered email back in the queue with a fresh attempt count
+//	@Tags			Outbox
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"Message ID"
+//	@Success		200	{object}	string
+//	@Failure		400	{object}	utils.ErrorResponse
+//	@Failure		401	{object}	utils.ErrorResponse
+//	@Failure		409	{object}	utils.ErrorResponse
+//	@Router			/outbox/{id}/retry [post]
+func (oh OutboxHandler) RetryOutboxMessage(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading message ID")
+		return err
+	}
+	ok, err := outbox.Retry(oh.DB, uint(id))
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error updating message")
+		return err
+	}
+	if !ok {
+		err = fmt.Errorf("message %d is not dead", id)
+		utils.HandleError(c, http.StatusConflict, err, "Only dead messages can be retried")
+		return err
+	}
+	c.JSON(http.StatusOK, map[string]any{
+		"message": "message queued for retry",
+	})
+	return nil
+}
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"car-rental/entity"
+	"car-rental/pricing"
+	"car-rental/utils"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ReadAllRules godoc
+//
+//	@Summary		Show all pricing rules
+//	@Description	Show all duration, weekend and season pricing rules
+//	@Tags			Pricing
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{array}		entity.PricingRule
+//	@Failure		401	{object}	utils.ErrorResponse
+//	@Failure		500	{object}	utils.ErrorResponse
+//	@Router			/pricing/rules [get]
+func (ph PricingHandler) ReadAllRules(c echo.Context) error {
+	var rules []entity.PricingRule
+	result := ph.DB.Order("id").Find(&rules)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving data")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, rules)
+	return nil
+}
+
+// CreateRule godoc
+//
+//	@Summary		Create pricing rule
+//	@Description	Insert a new pricing rule. Type is duration (needs min_days), weekend, or season (needs start_date and end_date). Percent is positive for a surcharge and negative for a discount.
+//	@Tags			Pricing
+//	@Accept			json
+//	@Produce		json
+//	@Param			rule	body		entity.PricingRule	true	"Pricing rule"
+//	@Success		201		{object}	entity.PricingRule
+//	@Failure		400		{object}	utils.ErrorResponse
+//	@Failure		401		{object}	utils.ErrorResponse
+//	@Router			/pricing/rules [post]
+func (ph PricingHandler) CreateRule(c echo.Context) error {
+	// get input
+	var rule entity.PricingRule
+	if err := c.Bind(&rule); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+	rule.ID = 0
+	if err := pricing.Validate(rule); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Invalid pricing rule")
+		return err
+	}
+
+	// insert data
+	result := ph.DB.Create(&rule)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error inserting data")
+		return result.Error
+	}
+	c.JSON(http.StatusCreated, rule)
+	return nil
+}
+
+// UpdateRule godoc
+//
+//	@Summary		Update pricing rule
+//	@Description	Replace the pricing rule targeted by the given ID
+//	@Tags			Pricing
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int					true	"Rule ID"
+//	@Param			rule	body		entity.PricingRule	true	"Pricing rule"
+//	@Success		200		{object}	entity.PricingRule
+//	@Failure		400		{object}	utils.ErrorResponse
+//	@Failure		401		{object}	utils.ErrorResponse
+//	@Router			/pricing/rules/{id} [put]
+func (ph PricingHandler) UpdateRule(c echo.Context) error {
+	// get rule by ID
+	var stored entity.PricingRule
+	result := ph.DB.Where("id = ?", c.Param("id")).First(&stored)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error retrieving rule data")
+		return result.Error
+	}
+
+	// get input
+	var rule entity.PricingRule
+	if err := c.Bind(&rule); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+	rule.ID = stored.ID
+	if err := pricing.Validate(rule); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Invalid pricing rule")
+		return err
+	}
+
+	// replace data
+	result = ph.DB.Save(&rule)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error updating data")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, rule)
+	return nil
+}
+
+// DeleteRule godoc
+//
+//	@Summary		Delete pricing rule
+//	@Description	Delete the pricing rule targeted by the given ID
+//	@Tags			Pricing
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"Rule ID"
+//	@Success		200	{object}	string
+//	@Failure		400	{object}	utils.ErrorResponse
+//	@Failure		401	{object}	utils.ErrorResponse
+//	@Failure		500	{object}	utils.ErrorResponse
+//	@Router			/pricing/rules/{id} [delete]
+func (ph PricingHandler) DeleteRule(c echo.Context) error {
+	var rule entity.PricingRule
+	result := ph.DB.Where("id = ?", c.Param("id")).First(&rule)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error retrieving rule data")
+		return result.Error
+	}
+	result = ph.DB.Delete(&rule)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error deleting rule")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, map[string]any{
+		"message": "pricing rule successfully deleted",
+	})
+	return nil
+}
@@ -1,59 +1,121 @@
 package handler
 
 import (
+	"bytes"
+	"car-rental/audit"
+	"car-rental/currency"
 	"car-rental/entity"
+	"car-rental/events"
 	"car-rental/utils"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
 )
 
 // ReadAll godoc
 //
 //	@Summary		Show all products
-//	@Description	Show all products and related rents
+//	@Description	Show all products and related rents, with prices also shown in the currency asked for or the user's wallet currency
 //	@Tags			Product
 //	@Accept			json
 //	@Produce		json
-//	@Success		200	{array}		entity.Product
-//	@Failure		400	{object}	utils.ErrorResponse
-//	@Failure		401	{object}	utils.ErrorResponse
-//	@Failure		500	{object}	utils.ErrorResponse
+//	@Param			currency	query		string	false	"Display currency"
+//	@Success		200			{array}		entity.Product
+//	@Failure		400			{object}	utils.ErrorResponse
+//	@Failure		401			{object}	utils.ErrorResponse
+//	@Failure		500			{object}	utils.ErrorResponse
 //	@Router			/products/ [get]
 func (ph ProductHandler) ReadAll(c echo.Context) error {
 	var products []entity.Product
-	result := ph.DB.Preload("Records").Find(&products)
+	result := ph.DB.Preload("Records").Preload("Images").Find(&products)
 	if result.Error != nil {
 		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving data")
 		return result.Error
 	}
+	code := ph.displayCurrency(c)
+	for i := range products {
+		if err := ph.setDisplayPrice(c, &products[i], code); err != nil {
+			return err
+		}
+	}
 	c.JSON(http.StatusOK, products)
 	return nil
 }
 
+// displayCurrency is the currency query parameter, or the wallet currency
+// of the logged in user.
+func (ph ProductHandler) displayCurrency(c echo.Context) string {
+	if code := c.QueryParam("currency"); code != "" {
+		return currency.Or(code)
+	}
+	claims, err := utils.DecodeToken(c)
+	if err != nil {
+		return currency.Base()
+	}
+	var user entity.User
+	ph.DB.Where("id = ?", claims["userID"]).First(&user)
+	return currency.Or(user.Currency)
+}
+
+func (ph ProductHandler) setDisplayPrice(c echo.Context, product *entity.Product, code string) error {
+	price, _, err := currency.Convert(ph.DB, product.RentalPrice, product.Currency, code)
+	if err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error converting price")
+		return err
+	}
+	product.DisplayPrice = price
+	product.DisplayCurrency = code
+	return nil
+}
+
 // ReadByID godoc
 //
 //	@Summary		Show product
-//	@Description	Show product by id from url
+//	@Description	Show product by id from url, including its image URLs. The response carries an ETag that changes with the product, its rents and the display price, a matching If-None-Match returns 304. The ETag can be sent in If-Match to change the product.
 //	@Tags			Product
 //	@Accept			json
 //	@Produce		json
-//	@Param			id	path		int	true	"Product ID"
-//	@Success		200	{object}	entity.Product
-//	@Failure		400	{object}	utils.ErrorResponse
-//	@Failure		401	{object}	utils.ErrorResponse
+//	@Param			id				path		int		true	"Product ID"
+//	@Param			currency		query		string	false	"Display currency"
+//	@Param			If-None-Match	header		string	false	"ETag from a previous read"
+//	@Success		200				{object}	entity.Product
+//	@Success		304				"Not Modified"
+//	@Failure		400				{object}	utils.ErrorResponse
+//	@Failure		401				{object}	utils.ErrorResponse
 //	@Router			/products/{id} [get]
 func (ph ProductHandler) ReadByID(c echo.Context) error {
 	id := c.Param("id")
 
 	var product entity.Product
-	result := ph.DB.Preload("Records").Where("id = ?", id).First(&product)
+	result := ph.DB.Preload("Records").Preload("Images").Where("id = ?", id).First(&product)
 	if result.Error != nil {
 		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error retrieving data")
 		return result.Error
 	}
-	c.JSON(http.StatusOK, product)
-	return nil
+
+	if err := ph.setDisplayPrice(c, &product, ph.displayCurrency(c)); err != nil {
+		return err
+	}
+
+	// conditional get, the tag covers the rents and display price in the body
+	body, err := json.Marshal(product)
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error encoding product")
+		return err
+	}
+	etag := utils.ReadETag(product.ID, product.Version, body)
+	c.Response().Header().Set("ETag", etag)
+	c.Response().Header().Set("Vary", "Authorization")
+	if match := c.Request().Header.Get("If-None-Match"); match != "" && utils.MatchETag(match, etag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return c.JSONBlob(http.StatusOK, body)
 }
 
 // CreateProduct godoc
@@ -63,42 +125,78 @@ func (ph ProductHandler) ReadByID(c echo.Context) error {
 //	@Tags			Product
 //	@Accept			json
 //	@Produce		json
-//	@Param			product	body		entity.Product	true	"Product Data"
+//	@Param			product	body		entity.ProductInput	true	"Product Data"
 //	@Success		201		{object}	entity.Product
 //	@Failure		400		{object}	utils.ErrorResponse
 //	@Failure		401		{object}	utils.ErrorResponse
 //	@Router			/products/ [post]
 func (ph ProductHandler) CreateProduct(c echo.Context) error {
-	// get input
-	var product entity.Product
-	if err := c.Bind(&product); err != nil {
+	// get input, only editable fields can be set
+	var input entity.ProductInput
+	if err := c.Bind(&input); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+	product := entity.Product{
+		Name:        input.Name,
+		Description: input.Description,
+		RentalPrice: input.RentalPrice,
+		Currency:    input.Currency,
+		Stock:       input.Stock,
+		Category:    input.Category,
+		Branch:      input.Branch,
+	}
+	product.Currency = currency.Or(product.Currency)
+	supported, err := currency.Supported(ph.DB, product.Currency)
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error retrieving currencies")
+		return err
+	}
+	if !supported {
+		err := fmt.Errorf("currency %s is not supported", product.Currency)
 		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
 		return err
 	}
 
 	// insert data
-	result := ph.DB.Create(&product)
+	tx := ph.DB.Begin()
+	result := tx.Create(&product)
 	if result.Error != nil {
 		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error inserting data")
+		tx.Rollback()
 		return result.Error
 	}
-	result.Preload("Records").First(&product)
+	if err := audit.Log(tx, audit.ActorFrom(c), audit.Create, audit.Products, product.ID, nil, product); err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error writing audit log")
+		tx.Rollback()
+		return err
+	}
+	result = tx.Commit()
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "commit error?")
+		return result.Error
+	}
+	ph.DB.Preload("Records").Where("id = ?", product.ID).First(&product)
+	c.Response().Header().Set("ETag", utils.ETag(product.ID, product.Version))
 	c.JSON(http.StatusCreated, product)
 	return nil
 }
 
 // UpdateProduct godoc
 //
-//	@Summary		Update product
-//	@Description	Update product targeted by the given ID using given product data
+//	@Summary		Replace product
+//	@Description	Replace product targeted by the given ID using given product data. Every field is written, omitted fields are set to their zero value. Requires the product's current ETag in If-Match.
 //	@Tags			Product
 //	@Accept			json
 //	@Produce		json
-//	@Param			id		path		int				true	"Product ID"
-//	@Param			product	body		entity.Product	true	"Product Data"
-//	@Success		200		{object}	entity.Product
-//	@Failure		400		{object}	utils.ErrorResponse
-//	@Failure		401		{object}	utils.ErrorResponse
+//	@Param			id			path		int				true	"Product ID"
+//	@Param			If-Match	header		string			true	"Current product ETag"
+//	@Param			product		body		entity.Product	true	"Product Data"
+//	@Success		202			{object}	entity.Product
+//	@Failure		400			{object}	utils.ErrorResponse
+//	@Failure		401			{object}	utils.ErrorResponse
+//	@Failure		412			{object}	utils.ErrorResponse
+//	@Failure		428			{object}	utils.ErrorResponse
 //	@Router			/products/{id} [put]
 func (ph ProductHandler) UpdateProductByID(c echo.Context) error {
 	// get input
@@ -108,32 +206,178 @@ func (ph ProductHandler) UpdateProductByID(c echo.Context) error {
 		return err
 	}
 
-	// get id from param
-	id := c.Param("id")
+	// update every field, including zero values
+	return ph.updateProduct(c, c.Param("id"), productFields(product), http.StatusAccepted)
+}
+
+// PatchProduct godoc
+//
+//	@Summary		Patch product
+//	@Description	Partially update product targeted by the given ID using JSON Merge Patch (RFC 7396). Only fields present in the body are written, so they can be set to zero or empty; null resets a field to its zero value. Requires the product's current ETag in If-Match.
+//	@Tags			Product
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			path		int				true	"Product ID"
+//	@Param			If-Match	header		string			true	"Current product ETag"
+//	@Param			product		body		entity.Product	true	"Fields to update"
+//	@Success		200			{object}	entity.Product
+//	@Failure		400			{object}	utils.ErrorResponse
+//	@Failure		401			{object}	utils.ErrorResponse
+//	@Failure		412			{object}	utils.ErrorResponse
+//	@Failure		428			{object}	utils.ErrorResponse
+//	@Router			/products/{id} [patch]
+func (ph ProductHandler) PatchProductByID(c echo.Context) error {
+	// get input, keeping track of which fields are present
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+	var present map[string]json.RawMessage
+	if err := json.Unmarshal(body, &present); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input, body must be a JSON object")
+		return err
+	}
+	var product entity.Product
+	if err := json.Unmarshal(body, &product); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+
+	// only update present fields
+	fields := productFields(product)
+	updates := map[string]any{}
+	for key := range present {
+		value, ok := fields[key]
+		if !ok {
+			err = fmt.Errorf("field %q cannot be updated", key)
+			utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+			return err
+		}
+		updates[key] = value
+	}
+	return ph.updateProduct(c, c.Param("id"), updates, http.StatusOK)
+}
 
-	// update data
-	result := ph.DB.Model(&entity.Product{}).Where("id = ?", id).Updates(product)
+// productFields maps the json name of every editable product field to its value.
+// The json names match the column names.
+func productFields(product entity.Product) map[string]any {
+	return map[string]any{
+		"name":         product.Name,
+		"description":  product.Description,
+		"rental_price": product.RentalPrice,
+		"currency":     product.Currency,
+		"stock":        product.Stock,
+		"category":     product.Category,
+		"branch":       product.Branch,
+	}
+}
+
+func (ph ProductHandler) updateProduct(c echo.Context, id string, updates map[string]any, status int) error {
+	// get product by ID
+	var product entity.Product
+	result := ph.DB.Where("id = ?", id).First(&product)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error retrieving product data")
+		return result.Error
+	}
+
+	if err := checkIfMatch(c, product); err != nil {
+		return err
+	}
+	if code, ok := updates["currency"]; ok {
+		updates["currency"] = currency.Or(code.(string))
+		supported, err := currency.Supported(ph.DB, updates["currency"].(string))
+		if err != nil {
+			utils.HandleError(c, http.StatusInternalServerError, err, "Error retrieving currencies")
+			return err
+		}
+		if !supported {
+			err := fmt.Errorf("currency %s is not supported", updates["currency"])
+			utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+			return err
+		}
+	}
+
+	// update data only if nobody changed the product in the meantime
+	before := product
+	tx := ph.DB.Begin()
+	updates["version"] = gorm.Expr("version + 1")
+	result = tx.Model(&product).Where("version = ?", product.Version).Updates(updates)
 	if result.Error != nil {
 		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error updating data")
+		tx.Rollback()
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		err := fmt.Errorf("product %d was modified concurrently", product.ID)
+		utils.HandleError(c, http.StatusPreconditionFailed, err, "Product has changed, reload it and try again")
+		tx.Rollback()
+		return err
+	}
+	tx.Where("id = ?", id).First(&product)
+	if err := audit.Log(tx, audit.ActorFrom(c), audit.Update, audit.Products, product.ID, before, product); err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error writing audit log")
+		tx.Rollback()
+		return err
+	}
+	pending, err := ph.Events.Stage(tx, events.ProductUpdated{Product: product})
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error recording events")
+		tx.Rollback()
+		return err
+	}
+	result = tx.Commit()
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "commit error?")
+		return result.Error
+	}
+	ph.Events.Flush(c.Request().Context(), pending)
+
+	// reload the updated product
+	product = entity.Product{}
+	result = ph.DB.Preload("Records").Preload("Images").Where("id = ?", id).First(&product)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving updated data")
 		return result.Error
 	}
-	result.Preload("Records").First(&product)
-	c.JSON(http.StatusAccepted, product)
+	c.Response().Header().Set("ETag", utils.ETag(product.ID, product.Version))
+	c.JSON(status, product)
+	return nil
+}
+
+// checkIfMatch requires the If-Match header to hold the product's current
+// ETag, or the ETag of a read of its current version.
+func checkIfMatch(c echo.Context, product entity.Product) error {
+	match := c.Request().Header.Get("If-Match")
+	if match == "" {
+		err := fmt.Errorf("missing If-Match header")
+		utils.HandleError(c, http.StatusPreconditionRequired, err, "Send the product ETag in If-Match")
+		return err
+	}
+	if !utils.MatchVersion(match, product.ID, product.Version) {
+		err := fmt.Errorf("If-Match %s does not match the current product version", match)
+		utils.HandleError(c, http.StatusPreconditionFailed, err, "Product has changed, reload it and try again")
+		return err
+	}
 	return nil
 }
 
 // DeleteProduct godoc
 //
-//	@Summary		Delete product
-//	@Description	Delete product targeted by the given ID and related rent data
+//	@Summary		Archive product
+//	@Description	Archive (soft delete) product targeted by the given ID. Archived products are hidden from the catalog and cannot be rented, related rent data is kept. Requires the product's current ETag in If-Match.
 //	@Tags			Product
 //	@Accept			json
 //	@Produce		json
-//	@Param			id	path		int	true	"Product ID"
-//	@Success		200	{object}	string
-//	@Failure		400	{object}	utils.ErrorResponse
-//	@Failure		401	{object}	utils.ErrorResponse
-//	@Failure		500	{object}	utils.ErrorResponse
+//	@Param			id			path		int		true	"Product ID"
+//	@Param			If-Match	header		string	true	"Current product ETag"
+//	@Success		200			{object}	string
+//	@Failure		400			{object}	utils.ErrorResponse
+//	@Failure		401			{object}	utils.ErrorResponse
+//	@Failure		412			{object}	utils.ErrorResponse
+//	@Failure		428			{object}	utils.ErrorResponse
+//	@Failure		500			{object}	utils.ErrorResponse
 //	@Router			/products/{id} [delete]
 func (ph ProductHandler) DeleteProductByID(c echo.Context) error {
 	// get id from param
@@ -141,35 +385,344 @@ func (ph ProductHandler) DeleteProductByID(c echo.Context) error {
 
 	// get product by ID
 	var product entity.Product
-	result := ph.DB.Preload("Records").Where("id = ?", productID).First(&product)
+	result := ph.DB.Where("id = ?", productID).First(&product)
 	if result.Error != nil {
 		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error retrieving product data")
 		return result.Error
 	}
 
+	if err := checkIfMatch(c, product); err != nil {
+		return err
+	}
+
+	// soft delete, records and images are kept
 	tx := ph.DB.Begin()
-	for _, record := range product.Records {
-		result := tx.Delete(record)
-		if result.Error != nil {
-			utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error deleting related records")
-			tx.Rollback()
-			return result.Error
-		}
+	result = tx.Where("version = ?", product.Version).Delete(&product)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error archiving product")
+		tx.Rollback()
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		err := fmt.Errorf("product %d was modified concurrently", product.ID)
+		utils.HandleError(c, http.StatusPreconditionFailed, err, "Product has changed, reload it and try again")
+		tx.Rollback()
+		return err
+	}
+	if err := audit.Log(tx, audit.ActorFrom(c), audit.Delete, audit.Products, product.ID, product, nil); err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error writing audit log")
+		tx.Rollback()
+		return err
 	}
-	result = tx.Delete(product)
+	result = tx.Commit()
 	if result.Error != nil {
-		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error deleting product")
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "commit error?")
+		return result.Error
+	}
+
+	c.JSON(http.StatusOK, map[string]any{
+		"message": "product successfully archived",
+	})
+	return nil
+}
+
+// ReadArchived godoc
+//
+//	@Summary		Show archived products
+//	@Description	Show all archived products and their rent history. The ETag to restore a product with is "<id>-<version>".
+//	@Tags			Product
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{array}		entity.Product
+//	@Failure		401	{object}	utils.ErrorResponse
+//	@Failure		500	{object}	utils.ErrorResponse
+//	@Router			/products/archived [get]
+func (ph ProductHandler) ReadArchived(c echo.Context) error {
+	var products []entity.Product
+	result := ph.DB.Unscoped().Preload("Records").Preload("Images").Where("deleted_at IS NOT NULL").Find(&products)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving data")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, products)
+	return nil
+}
+
+// RestoreProduct godoc
+//
+//	@Summary		Restore product
+//	@Description	Restore an archived product targeted by the given ID back into the catalog. Requires the product's current ETag in If-Match.
+//	@Tags			Product
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			path		int		true	"Product ID"
+//	@Param			If-Match	header		string	true	"Current product ETag"
+//	@Success		200			{object}	entity.Product
+//	@Failure		400			{object}	utils.ErrorResponse
+//	@Failure		401			{object}	utils.ErrorResponse
+//	@Failure		412			{object}	utils.ErrorResponse
+//	@Failure		428			{object}	utils.ErrorResponse
+//	@Failure		500			{object}	utils.ErrorResponse
+//	@Router			/products/{id}/restore [post]
+func (ph ProductHandler) RestoreProductByID(c echo.Context) error {
+	// get archived product by ID
+	var product entity.Product
+	result := ph.DB.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", c.Param("id")).First(&product)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error retrieving archived product data")
+		return result.Error
+	}
+	if err := checkIfMatch(c, product); err != nil {
+		return err
+	}
+
+	// restore only if nobody changed the product in the meantime
+	before := product
+	tx := ph.DB.Begin()
+	result = tx.Unscoped().Model(&product).Where("version = ?", product.Version).
+		Updates(map[string]any{"deleted_at": nil, "version": gorm.Expr("version + 1")})
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error restoring product")
 		tx.Rollback()
 		return result.Error
 	}
+	if result.RowsAffected == 0 {
+		err := fmt.Errorf("product %d was modified concurrently", product.ID)
+		utils.HandleError(c, http.StatusPreconditionFailed, err, "Product has changed, reload it and try again")
+		tx.Rollback()
+		return err
+	}
+	tx.Unscoped().Where("id = ?", product.ID).First(&product)
+	if err := audit.Log(tx, audit.ActorFrom(c), audit.Update, audit.Products, product.ID, before, product); err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error writing audit log")
+		tx.Rollback()
+		return err
+	}
 	result = tx.Commit()
 	if result.Error != nil {
 		utils.HandleError(c, http.StatusInternalServerError, result.Error, "commit error?")
 		return result.Error
 	}
+	ph.DB.Preload("Records").Preload("Images").Where("id = ?", product.ID).First(&product)
+	c.Response().Header().Set("ETag", utils.ETag(product.ID, product.Version))
+	c.JSON(http.StatusOK, product)
+	return nil
+}
+
+const (
+	maxImageSize  = 5 << 20 // 5 MB
+	thumbnailSide = 256
+)
+
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// UploadProductImage godoc
+//
+//	@Summary		Upload product image
+//	@Description	Upload a jpeg, png or gif photo (max 5 MB) for the product targeted by the given ID. A thumbnail is generated alongside it.
+//	@Tags			Product
+//	@Accept			mpfd
+//	@Produce		json
+//	@Param			id		path		int		true	"Product ID"
+//	@Param			image	formData	file	true	"Image file"
+//	@Success		201		{object}	entity.ProductImage
+//	@Failure		400		{object}	utils.ErrorResponse
+//	@Failure		401		{object}	utils.ErrorResponse
+//	@Failure		413		{object}	utils.ErrorResponse
+//	@Failure		415		{object}	utils.ErrorResponse
+//	@Failure		500		{object}	utils.ErrorResponse
+//	@Router			/products/{id}/images [post]
+func (ph ProductHandler) UploadProductImage(c echo.Context) error {
+	// get product by ID
+	var product entity.Product
+	result := ph.DB.Where("id = ?", c.Param("id")).First(&product)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error retrieving product data")
+		return result.Error
+	}
+
+	// read file
+	fileHeader, err := c.FormFile("image")
+	if err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading image file")
+		return err
+	}
+	if fileHeader.Size > maxImageSize {
+		err = fmt.Errorf("image size %d is larger than %d bytes", fileHeader.Size, maxImageSize)
+		utils.HandleError(c, http.StatusRequestEntityTooLarge, err, "Image too large")
+		return err
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading image file")
+		return err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxImageSize+1))
+	if err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading image file")
+		return err
+	}
+	if len(data) > maxImageSize {
+		err = fmt.Errorf("image is larger than %d bytes", maxImageSize)
+		utils.HandleError(c, http.StatusRequestEntityTooLarge, err, "Image too large")
+		return err
+	}
+
+	// check content type from the file content, not the client header
+	contentType := http.DetectContentType(data)
+	ext, ok := imageExtensions[contentType]
+	if !ok {
+		err = fmt.Errorf("content type %s is not allowed", contentType)
+		utils.HandleError(c, http.StatusUnsupportedMediaType, err, "Only jpeg, png and gif images are allowed")
+		return err
+	}
+
+	// generate thumbnail
+	thumbnail, err := utils.MakeThumbnail(data, thumbnailSide)
+	if err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading image data")
+		return err
+	}
+
+	// store image and thumbnail
+	name := make([]byte, 16)
+	if _, err := rand.Read(name); err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error generating file name")
+		return err
+	}
+	image := entity.ProductImage{
+		ProductID:    product.ID,
+		ContentType:  contentType,
+		Size:         int64(len(data)),
+		Key:          fmt.Sprintf("products/%d/%s%s", product.ID, hex.EncodeToString(name), ext),
+		ThumbnailKey: fmt.Sprintf("products/%d/%s_thumb.jpg", product.ID, hex.EncodeToString(name)),
+	}
+	ctx := c.Request().Context()
+	image.URL, err = ph.Storage.Put(ctx, image.Key, bytes.NewReader(data), image.Size, contentType)
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error storing image")
+		return err
+	}
+	image.ThumbnailURL, err = ph.Storage.Put(ctx, image.ThumbnailKey, bytes.NewReader(thumbnail), int64(len(thumbnail)), "image/jpeg")
+	if err != nil {
+		ph.Storage.Delete(ctx, image.Key)
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error storing thumbnail")
+		return err
+	}
+
+	// insert data
+	tx := ph.DB.Begin()
+	before, err := productImages(tx, product.ID)
+	if err == nil {
+		err = tx.Create(&image).Error
+	}
+	if err == nil {
+		err = touchProduct(tx, product.ID)
+	}
+	if err == nil {
+		err = logImages(tx, audit.ActorFrom(c), product.ID, before)
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	}
+	if err != nil {
+		tx.Rollback()
+		ph.Storage.Delete(ctx, image.Key)
+		ph.Storage.Delete(ctx, image.ThumbnailKey)
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error inserting data")
+		return err
+	}
+	c.JSON(http.StatusCreated, image)
+	return nil
+}
+
+// DeleteProductImage godoc
+//
+//	@Summary		Delete product image
+//	@Description	Delete an image and its thumbnail from the product targeted by the given ID
+//	@Tags			Product
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			path		int	true	"Product ID"
+//	@Param			imageID		path		int	true	"Image ID"
+//	@Success		200			{object}	string
+//	@Failure		400			{object}	utils.ErrorResponse
+//	@Failure		401			{object}	utils.ErrorResponse
+//	@Failure		500			{object}	utils.ErrorResponse
+//	@Router			/products/{id}/images/{imageID} [delete]
+func (ph ProductHandler) DeleteProductImage(c echo.Context) error {
+	var image entity.ProductImage
+	result := ph.DB.Where("id = ? AND product_id = ?", c.Param("imageID"), c.Param("id")).First(&image)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error retrieving image data")
+		return result.Error
+	}
+
+	tx := ph.DB.Begin()
+	before, err := productImages(tx, image.ProductID)
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error retrieving image data")
+		tx.Rollback()
+		return err
+	}
+	result = tx.Delete(&image)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error deleting image")
+		tx.Rollback()
+		return result.Error
+	}
+	if err := touchProduct(tx, image.ProductID); err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error updating product version")
+		tx.Rollback()
+		return err
+	}
+	if err := logImages(tx, audit.ActorFrom(c), image.ProductID, before); err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error writing audit log")
+		tx.Rollback()
+		return err
+	}
+	result = tx.Commit()
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "commit error?")
+		return result.Error
+	}
+	ctx := c.Request().Context()
+	for _, key := range []string{image.Key, image.ThumbnailKey} {
+		if err := ph.Storage.Delete(ctx, key); err != nil {
+			utils.HandleError(c, http.StatusInternalServerError, err, "Error deleting stored file")
+			return err
+		}
+	}
 
 	c.JSON(http.StatusOK, map[string]any{
-		"message": "product successfully deleted",
+		"message": "image successfully deleted",
 	})
 	return nil
 }
+
+// productImages lists the image URLs of a product, to audit image changes as
+// product updates.
+func productImages(tx *gorm.DB, productID uint) (map[string]any, error) {
+	var urls []string
+	result := tx.Model(&entity.ProductImage{}).Where("product_id = ?", productID).Order("id").Pluck("url", &urls)
+	return map[string]any{"images": urls}, result.Error
+}
+
+// touchProduct bumps the product version after a change to its images, so
+// ETags taken before the change no longer match.
+func touchProduct(tx *gorm.DB, productID uint) error {
+	return tx.Model(&entity.Product{}).Where("id = ?", productID).Update("version", gorm.Expr("version + 1")).Error
+}
+
+func logImages(tx *gorm.DB, actor audit.Actor, productID uint, before map[string]any) error {
+	after, err := productImages(tx, productID)
+	if err != nil {
+		return err
+	}
+	return audit.Log(tx, actor, audit.Update, audit.Products, productID, before, after)
+}
@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"car-rental/entity"
+	"car-rental/pricing"
+	"car-rental/utils"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ReadAllPromos godoc
+//
+//	@Summary		Show all promo codes
+//	@Description	Show all promo codes and how often they were used
+//	@Tags			Promo
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{array}		entity.PromoCode
+//	@Failure		401	{object}	utils.ErrorResponse
+//	@Failure		500	{object}	utils.ErrorResponse
+//	@Router			/promos/ [get]
+func (ph PromoHandler) ReadAllPromos(c echo.Context) error {
+	var promos []entity.PromoCode
+	result := ph.DB.Order("id").Find(&promos)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving data")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, promos)
+	return nil
+}
+
+// ReadPromoByID godoc
+//
+//	@Summary		Show promo code
+//	@Description	Show promo code by id from url, with its redemptions
+//	@Tags			Promo
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"Promo code ID"
+//	@Success		200	{object}	string
+//	@Failure		400	{object}	utils.ErrorResponse
+//	@Failure		401	{object}	utils.ErrorResponse
+//	@Router			/promos/{id} [get]
+func (ph PromoHandler) ReadPromoByID(c echo.Context) error {
+	var promo entity.PromoCode
+	result := ph.DB.Where("id = ?", c.Param("id")).First(&promo)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error retrieving data")
+		return result.Error
+	}
+	var redemptions []entity.PromoRedemption
+	result = ph.DB.Where("promo_code_id = ?", promo.ID).Order("id").Find(&redemptions)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving redemptions")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, map[string]any{
+		"promo_code":  promo,
+		"redemptions": redemptions,
+	})
+	return nil
+}
+
+// CreatePromo godoc
+//
+//	@Summary		Create promo code
+//	@Description	Insert a new promo code. Type is percent or fixed. Validity window, usage caps and category or product restrictions are optional.
+//	@Tags			Promo
+//	@Accept			json
+//	@Produce		json
+//	@Param			promo	body		entity.PromoCode	true	"Promo code"
+//	@Success		201		{object}	entity.PromoCode
+//	@Failure		400		{object}	utils.ErrorResponse
+//	@Failure		401		{object}	utils.ErrorResponse
+//	@Router			/promos/ [post]
+func (ph PromoHandler) CreatePromo(c echo.Context) error {
+	// get input
+	var promo entity.PromoCode
+	if err := c.Bind(&promo); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+	promo.ID = 0
+	promo.UsedCount = 0
+	promo.Code = pricing.NormalizeCode(promo.Code)
+	if err := pricing.ValidatePromo(promo); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Invalid promo code")
+		return err
+	}
+
+	// insert data
+	result := ph.DB.Create(&promo)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error inserting data")
+		return result.Error
+	}
+	c.JSON(http.StatusCreated, promo)
+	return nil
+}
+
+// UpdatePromo godoc
+//
+//	@Summary		Update promo code
+//	@Description	Replace the promo code targeted by the given ID, its usage count is kept
+//	@Tags			Promo
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int					true	"Promo code ID"
+//	@Param			promo	body		entity.PromoCode	true	"Promo code"
+//	@Success		200		{object}	entity.PromoCode
+//	@Failure		400		{object}	utils.ErrorResponse
+//	@Failure		401		{object}	utils.ErrorResponse
+//	@Router			/promos/{id} [put]
+func (ph PromoHandler) UpdatePromo(c echo.Context) error {
+	// get promo by ID
+	var stored entity.PromoCode
+	result := ph.DB.Where("id = ?", c.Param("id")).First(&stored)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error retrieving promo data")
+		return result.Error
+	}
+
+	// get input
+	var promo entity.PromoCode
+	if err := c.Bind(&promo); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+	promo.Code = pricing.NormalizeCode(promo.Code)
+	if err := pricing.ValidatePromo(promo); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Invalid promo code")
+		return err
+	}
+
+	// replace data, the usage count is only changed by redemptions
+	result = ph.DB.Model(&stored).Select("*").Omit("id", "used_count", "created_at").Updates(promo)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error updating data")
+		return result.Error
+	}
+	ph.DB.Where("id = ?", stored.ID).First(&stored)
+	c.JSON(http.StatusOK, stored)
+	return nil
+}
+
+// DeletePromo godoc
+//
+//	@Summary		Delete promo code
+//	@Description	Delete the promo code targeted by the given ID. Codes that were already redeemed are disabled instead, so their redemptions are kept.
+//	@Tags			Promo
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"Promo code ID"
+//	@Success		200	{object}	string
+//	@Failure		400	{object}	utils.ErrorResponse
+//	@Failure		401	{object}	utils.ErrorResponse
+//	@Failure		500	{object}	utils.ErrorResponse
+//	@Router			/promos/{id} [delete]
+func (ph PromoHandler) DeletePromo(c echo.Context) error {
+	var promo entity.PromoCode
+	result := ph.DB.Where("id = ?", c.Param("id")).First(&promo)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error retrieving promo data")
+		return result.Error
+	}
+
+	if promo.UsedCount > 0 {
+		result = ph.DB.Model(&promo).Update("disabled", true)
+		if result.Error != nil {
+			utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error disabling promo code")
+			return result.Error
+		}
+		c.JSON(http.StatusOK, map[string]any{
+			"message": "promo code was already used and has been disabled",
+		})
+		return nil
+	}
+
+	result = ph.DB.Delete(&promo)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error deleting promo code")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, map[string]any{
+		"message": "promo code successfully deleted",
+	})
+	return nil
+}
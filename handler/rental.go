@@ -1,13 +1,25 @@
 package handler
 
 import (
+	"car-rental/audit"
+	"car-rental/currency"
 	"car-rental/entity"
+	"car-rental/events"
+	"car-rental/invoice"
+	"car-rental/loyalty"
+	"car-rental/pricing"
 	"car-rental/utils"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"reflect"
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
 )
 
 // GetUserRents godoc
@@ -33,7 +45,7 @@ func (rh RentalHandler) GetUserRents(c echo.Context) error {
 
 	// get records
 	var records []entity.Record
-	result := rh.DB.Where("user_id = ?", userID).Find(&records)
+	result := rh.DB.Preload("AddOns").Where("user_id = ?", userID).Find(&records)
 	if result.Error != nil {
 		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error retrieving data")
 		return result.Error
@@ -42,20 +54,20 @@ func (rh RentalHandler) GetUserRents(c echo.Context) error {
 	return nil
 }
 
-// RentAProduct godoc
+// QuoteRent godoc
 //
-//	@Summary		Create new rent
-//	@Description	Create a new rent for logged in user
+//	@Summary		Quote a rent
+//	@Description	Price a rent for the logged in user without booking it. The itemized quote is valid for 15 minutes and is honoured when renting with its ID.
 //	@Tags			Rental
 //	@Accept			json
 //	@Produce		json
-//	@Param			token	body		string	true	"Signed token string"
-//	@Success		200		{object}	string
+//	@Param			rent	body		entity.Rent	true	"Rent input"
+//	@Success		201		{object}	entity.Quote
 //	@Failure		400		{object}	utils.ErrorResponse
 //	@Failure		401		{object}	utils.ErrorResponse
 //	@Failure		500		{object}	utils.ErrorResponse
-//	@Router			/rent/ [post]
-func (rh RentalHandler) RentAProduct(c echo.Context) error {
+//	@Router			/rent/quote [post]
+func (rh RentalHandler) QuoteRent(c echo.Context) error {
 	// get user id from token
 	claims, err := utils.DecodeToken(c)
 	if err != nil {
@@ -77,65 +89,452 @@ func (rh RentalHandler) RentAProduct(c echo.Context) error {
 		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
 		return err
 	}
+	product, err := rh.getRentableProduct(c, input)
+	if err != nil {
+		return err
+	}
+
+	price, err := rh.priceRent(c, user, product, input)
+	if err != nil {
+		return err
+	}
+	charge, hold, _, err := rh.walletCharge(c, user, price)
+	if err != nil {
+		return err
+	}
+
+	// store the quote so it can be honoured later
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error generating quote ID")
+		return err
+	}
+	quote := entity.Quote{
+		ID:             hex.EncodeToString(id),
+		UserID:         user.ID,
+		ProductID:      product.ID,
+		RentLength:     input.RentLength,
+		PromoCode:      pricing.NormalizeCode(input.PromoCode),
+		AddOns:         pricing.MergeAddOns(input.AddOns),
+		RedeemPoints:   price.PointsRedeemed,
+		StartDate:      input.StartDate,
+		Price:          price,
+		DepositNeeded:  math.Max(charge+hold-(user.Deposit-user.Reserved), 0),
+		WalletCurrency: currency.Or(user.Currency),
+		ExpiresAt:      time.Now().Add(quoteValidity),
+	}
+	result = rh.DB.Create(&quote)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error inserting quote")
+		return result.Error
+	}
+	c.JSON(http.StatusCreated, quote)
+	return nil
+}
+
+const quoteValidity = 15 * time.Minute
+
+// priceRent prices a rent input with the pricing rules, then its add-ons,
+// then the user's loyalty tier, then its promo code, then redeemed points,
+// then tax, and adds the security hold of the product category.
+func (rh RentalHandler) priceRent(c echo.Context, user entity.User, product entity.Product, input entity.Rent) (entity.PriceBreakdown, error) {
+	now := time.Now()
+	price, err := rh.Pricing.Quote(product, rentStart(input, now), input.RentLength)
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error calculating price")
+		return price, err
+	}
+	if err := rh.Pricing.ApplyAddOns(&price, input.AddOns, rentStart(input, now), now); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Add-on cannot be rented")
+		return price, err
+	}
+	tier, _, err := loyalty.TierFor(rh.DB, user.ID, now)
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error retrieving loyalty tier")
+		return price, err
+	}
+	loyalty.ApplyTier(&price, tier)
+	if input.PromoCode != "" {
+		promo, err := rh.Pricing.FindPromo(input.PromoCode, user.ID, product, now)
+		if err != nil {
+			utils.HandleError(c, http.StatusBadRequest, err, "Promo code cannot be used")
+			return price, err
+		}
+		if err := rh.Pricing.ApplyPromo(&price, promo); err != nil {
+			utils.HandleError(c, http.StatusInternalServerError, err, "Error applying promo code")
+			return price, err
+		}
+	}
+	if input.RedeemPoints > 0 {
+		if int(input.RedeemPoints) > user.Points {
+			err = fmt.Errorf("user has %d loyalty points, %d requested", user.Points, input.RedeemPoints)
+			utils.HandleError(c, http.StatusBadRequest, err, "Not enough loyalty points")
+			return price, err
+		}
+		if _, err := loyalty.ApplyPoints(rh.DB, &price, input.RedeemPoints); err != nil {
+			utils.HandleError(c, http.StatusInternalServerError, err, "Error redeeming loyalty points")
+			return price, err
+		}
+	}
+	rate, err := rh.Pricing.TaxRate(product)
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error calculating tax")
+		return price, err
+	}
+	pricing.ApplyTax(&price, rate)
+	price.SecurityHold, err = rh.Pricing.SecurityHold(product.Category, price.Currency)
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error calculating security hold")
+		return price, err
+	}
+	return price, nil
+}
+
+// walletCharge converts the price total and security hold to the user's
+// wallet currency, returning both and the exchange rate used.
+func (rh RentalHandler) walletCharge(c echo.Context, user entity.User, price entity.PriceBreakdown) (float64, float64, float64, error) {
+	charge, rate, err := currency.Convert(rh.DB, price.Total, price.Currency, user.Currency)
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error converting price to wallet currency")
+		return 0, 0, 0, err
+	}
+	hold, _, err := currency.Convert(rh.DB, price.SecurityHold, price.Currency, user.Currency)
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error converting price to wallet currency")
+		return 0, 0, 0, err
+	}
+	return charge, hold, rate, nil
+}
+
+// maxAdvance is how far ahead a rent can be booked.
+const maxAdvance = 180 * 24 * time.Hour
+
+// rentStart is when a rent input starts: its start date, or now.
+func rentStart(input entity.Rent, now time.Time) time.Time {
+	if input.StartDate != nil && input.StartDate.After(now) {
+		return *input.StartDate
+	}
+	return now
+}
+
+// getRentableProduct loads the product of a rent input, refusing archived
+// products, empty rent lengths and start dates in the past or too far ahead.
+func (rh RentalHandler) getRentableProduct(c echo.Context, input entity.Rent) (entity.Product, error) {
+	if input.RentLength == 0 {
+		err := fmt.Errorf("rent_length must be at least 1 day")
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return entity.Product{}, err
+	}
+	if input.StartDate != nil {
+		now := time.Now()
+		if input.StartDate.Before(now.Add(-5*time.Minute)) || input.StartDate.After(now.Add(maxAdvance)) {
+			err := fmt.Errorf("start_date must be between now and %d days ahead", int(maxAdvance.Hours()/24))
+			utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+			return entity.Product{}, err
+		}
+	}
+
 	// get product from input
 	var product entity.Product
-	result = rh.DB.Where("id = ?", input.ProductID).First(&product)
+	result := rh.DB.Unscoped().Where("id = ?", input.ProductID).First(&product)
 	if result.Error != nil {
 		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error retrieving product data")
+		return product, result.Error
+	}
+	// deny archived products
+	if product.DeletedAt.Valid {
+		err := fmt.Errorf("product %d is archived", product.ID)
+		utils.HandleError(c, http.StatusBadRequest, err, "Product is not available")
+		return product, err
+	}
+	return product, nil
+}
+
+// RentAProduct godoc
+//
+//	@Summary		Create new rent
+//	@Description	Create a new rent for logged in user. When quote_id is given, the price of that quote is used as long as it is still valid. An optional start_date books the rent ahead, up to 180 days. Optional add_ons are priced and stored on the record, an optional promo_code is applied to the price and redeemed with the rent. The security hold of the product category is reserved in the wallet until the rent is returned.
+//	@Tags			Rental
+//	@Accept			json
+//	@Produce		json
+//	@Param			rent	body		entity.Rent	true	"Rent input"
+//	@Success		200		{object}	string
+//	@Failure		400		{object}	utils.ErrorResponse
+//	@Failure		401		{object}	utils.ErrorResponse
+//	@Failure		409		{object}	utils.ErrorResponse
+//	@Failure		500		{object}	utils.ErrorResponse
+//	@Router			/rent/ [post]
+func (rh RentalHandler) RentAProduct(c echo.Context) error {
+	// get user id from token
+	claims, err := utils.DecodeToken(c)
+	if err != nil {
+		utils.HandleError(c, http.StatusUnauthorized, err, "Error reading token")
+		return err
+	}
+	userID := claims["userID"]
+	// get user
+	var user entity.User
+	result := rh.DB.Where("id = ?", userID).First(&user)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving user data")
 		return result.Error
 	}
 
-	// compare (rentPrice * rentLength) with userDeposit
-	totalPrice := product.RentalPrice * float64(input.RentLength)
-	// deny if total price > deposit
-	if totalPrice > user.Deposit {
-		err = fmt.Errorf("total price %.2f is larger than user deposit %.2f", totalPrice, user.Deposit)
+	// read input
+	var input entity.Rent
+	if err := c.Bind(&input); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+
+	// get quote from input
+	var quote entity.Quote
+	if input.QuoteID != "" {
+		result = rh.DB.Where("id = ? AND user_id = ?", input.QuoteID, user.ID).First(&quote)
+		if result.Error != nil {
+			utils.HandleError(c, http.StatusBadRequest, result.Error, "Error retrieving quote data")
+			return result.Error
+		}
+		if quote.UsedAt != nil || time.Now().After(quote.ExpiresAt) {
+			err = fmt.Errorf("quote %s is used or expired", quote.ID)
+			utils.HandleError(c, http.StatusBadRequest, err, "Quote is no longer valid, request a new one")
+			return err
+		}
+		if (input.ProductID != 0 && input.ProductID != quote.ProductID) || (input.RentLength != 0 && input.RentLength != quote.RentLength) ||
+			(input.PromoCode != "" && pricing.NormalizeCode(input.PromoCode) != quote.PromoCode) ||
+			(len(input.AddOns) != 0 && !reflect.DeepEqual(pricing.MergeAddOns(input.AddOns), quote.AddOns)) ||
+			(input.RedeemPoints != 0 && input.RedeemPoints != quote.RedeemPoints) ||
+			(input.StartDate != nil && (quote.StartDate == nil || !input.StartDate.Equal(*quote.StartDate))) {
+			err = fmt.Errorf("quote %s is for product %d over %d days", quote.ID, quote.ProductID, quote.RentLength)
+			utils.HandleError(c, http.StatusBadRequest, err, "Rent input does not match the quote")
+			return err
+		}
+		input.ProductID = quote.ProductID
+		input.RentLength = quote.RentLength
+		input.PromoCode = quote.PromoCode
+		input.AddOns = quote.AddOns
+		input.RedeemPoints = quote.RedeemPoints
+		input.StartDate = quote.StartDate
+	}
+
+	product, err := rh.getRentableProduct(c, input)
+	if err != nil {
+		return err
+	}
+
+	// price the rent using the quote or the pricing rules
+	price := quote.Price
+	if input.QuoteID == "" {
+		price, err = rh.priceRent(c, user, product, input)
+		if err != nil {
+			return err
+		}
+	}
+	totalPrice, hold, rate, err := rh.walletCharge(c, user, price)
+	if err != nil {
+		return err
+	}
+	// deny while return fees are unpaid, or if total price and security hold > available deposit
+	if user.Owed > 0 {
+		err = fmt.Errorf("%w: %.2f owed", pricing.ErrFeesOwed, user.Owed)
+		utils.HandleError(c, http.StatusBadRequest, err, "Unpaid return fees")
+		return err
+	}
+	available := user.Deposit - user.Reserved
+	if totalPrice+hold > available {
+		err = fmt.Errorf("total price %.2f plus security hold %.2f is larger than available deposit %.2f", totalPrice, hold, available)
 		utils.HandleError(c, http.StatusBadRequest, err, "Not enough deposit")
 		return err
 	}
 	tx := rh.DB.Begin()
+	wallets, err := audit.SnapshotWallets(tx, user.ID)
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error reading wallet")
+		tx.Rollback()
+		return err
+	}
+	// use up the quote
+	if input.QuoteID != "" {
+		result = tx.Model(&entity.Quote{}).Where("id = ? AND used_at IS NULL", quote.ID).Update("used_at", time.Now())
+		if result.Error != nil {
+			utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error updating quote")
+			tx.Rollback()
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			err = fmt.Errorf("quote %s is already used", quote.ID)
+			utils.HandleError(c, http.StatusConflict, err, "Quote is no longer valid, request a new one")
+			tx.Rollback()
+			return err
+		}
+	}
+
 	// create record
-	result = tx.Create(&entity.Record{
+	start := rentStart(input, time.Now())
+	record := entity.Record{
 		UserID:    uint(userID.(float64)),
 		ProductID: product.ID,
-		EndDate:   time.Now().AddDate(0, 0, int(input.RentLength)),
-	})
+		StartDate: start,
+		EndDate:   start.AddDate(0, 0, int(input.RentLength)),
+		Total:     price.Total,
+		Tax:       price.Tax,
+		TaxName:   price.TaxName,
+		TaxRate:   price.TaxRate,
+		Currency:  price.Currency,
+		DailyRate: price.DailyRate,
+	}
+	result = tx.Create(&record)
 	if result.Error != nil {
 		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error inserting record")
 		tx.Rollback()
 		return result.Error
 	}
-	var record entity.Record
-	result.First(&record)
 
-	// update user by subtracting total price from deposit
-	result = tx.Model(&user).Update("Deposit", user.Deposit-totalPrice)
+	// store add-ons on the record, failing the rent if one ran out of stock meanwhile
+	if err := pricing.ReserveAddOns(tx, price, record, time.Now()); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, pricing.ErrAddOnOutOfStock) {
+			status = http.StatusConflict
+		}
+		utils.HandleError(c, status, err, "Error reserving add-ons")
+		tx.Rollback()
+		return err
+	}
+
+	// redeem the promo code, failing the rent if its usage limit was reached meanwhile
+	if promoID, discount := pricing.PromoDiscount(price); promoID != 0 {
+		if err := pricing.Redeem(tx, promoID, user.ID, record.ID, discount); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, pricing.ErrPromoUsedUp) {
+				status = http.StatusConflict
+			}
+			utils.HandleError(c, status, err, "Error redeeming promo code")
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// take the redeemed loyalty points, failing the rent if they were spent meanwhile
+	if err := loyalty.Spend(tx, user.ID, record.ID, price.PointsRedeemed); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, loyalty.ErrNotEnoughPoints) {
+			status = http.StatusConflict
+		}
+		utils.HandleError(c, status, err, "Error redeeming loyalty points")
+		tx.Rollback()
+		return err
+	}
+
+	// update user by subtracting total price from deposit and reserving the
+	// security hold, as long as the available deposit still covers both
+	result = tx.Model(&user).
+		Where("deposit - reserved >= ? AND owed <= 0", totalPrice+hold).
+		Updates(map[string]any{
+			"deposit":  gorm.Expr("deposit - ?", totalPrice),
+			"reserved": gorm.Expr("reserved + ?", hold),
+		})
 	if result.Error != nil {
 		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error updating user")
 		tx.Rollback()
 		return result.Error
 	}
-	result.First(&user)
+	if result.RowsAffected == 0 {
+		err = fmt.Errorf("available deposit changed and no longer covers %.2f", totalPrice+hold)
+		utils.HandleError(c, http.StatusBadRequest, err, "Not enough deposit")
+		tx.Rollback()
+		return err
+	}
+	tx.Where("id = ?", user.ID).First(&user)
 
-	result = tx.Commit()
+	// hold the security deposit
+	if hold > 0 {
+		result = tx.Create(&entity.DepositHold{
+			UserID:   user.ID,
+			RecordID: record.ID,
+			Amount:   hold,
+			Currency: currency.Or(user.Currency),
+			Status:   pricing.HoldHeld,
+		})
+		if result.Error != nil {
+			utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error holding security deposit")
+			tx.Rollback()
+			return result.Error
+		}
+	}
+
+	// record the charge and invoice it
+	result = tx.Create(&entity.LedgerEntry{
+		UserID:           user.ID,
+		Type:             "rental",
+		Amount:           -totalPrice,
+		Tax:              math.Round(price.Tax*rate*100) / 100,
+		Currency:         currency.Or(user.Currency),
+		OriginalAmount:   -price.Total,
+		OriginalCurrency: price.Currency,
+		ExchangeRate:     rate,
+		RecordID:         &record.ID,
+	})
 	if result.Error != nil {
-		utils.HandleError(c, http.StatusInternalServerError, result.Error, "commit error?")
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error inserting ledger entry")
+		tx.Rollback()
 		return result.Error
 	}
-
-	if err := c.JSON(http.StatusOK, map[string]any{
-		"rental_record": record,
-		"user_balance":  user.Deposit,
-	}); err != nil {
-		utils.HandleError(c, http.StatusInternalServerError, err, "Error writing json response")
+	inv := entity.Invoice{
+		Kind:          invoice.KindRental,
+		UserID:        user.ID,
+		RecordID:      &record.ID,
+		CustomerName:  user.Name,
+		CustomerEmail: user.Email,
+		Lines:         invoice.RentalLines(product, price),
+		Tax:           price.Tax,
+		TaxInclusive:  price.TaxInclusive,
+		Currency:      price.Currency,
+	}
+	if err := invoice.Issue(tx, &inv); err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error issuing invoice")
+		tx.Rollback()
 		return err
 	}
 
-	// send email notification
-	err = utils.SendEmail(user.Email, "Thank you for renting from us!", fmt.Sprintf("<h1>Thank you!</h1><br><p>Thank you for using our service!<br>Your Car Rental Deposit is now %v.</p>", user.Deposit))
+	// audit the new record and the charge
+	actor := audit.ActorFrom(c)
+	tx.Where("record_id = ?", record.ID).Find(&record.AddOns)
+	if err := audit.Log(tx, actor, audit.Create, audit.Records, record.ID, nil, record); err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error writing audit log")
+		tx.Rollback()
+		return err
+	}
+	if err := wallets.Log(tx, actor); err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error writing audit log")
+		tx.Rollback()
+		return err
+	}
+	pending, err := rh.Events.Stage(tx, events.RentalCreated{
+		User:       user,
+		Product:    product,
+		Record:     record,
+		RentLength: input.RentLength,
+		Price:      price,
+		Invoice:    inv,
+	})
 	if err != nil {
-		utils.HandleError(c, http.StatusInternalServerError, err, "Error sending email")
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error recording events")
+		tx.Rollback()
 		return err
 	}
-	return nil
+
+	result = tx.Commit()
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "commit error?")
+		return result.Error
+	}
+	rh.Events.Flush(c.Request().Context(), pending)
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"rental_record": record,
+		"price":         price,
+		"user_balance":  user.Deposit,
+		"user_reserved": user.Reserved,
+		"invoice":       inv.Number,
+	})
 }
@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"car-rental/report"
+	"car-rental/utils"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// reportPeriod reads the from and to dates of a report, defaulting to the
+// current month up to today. The returned end is exclusive.
+func reportPeriod(c echo.Context) (time.Time, time.Time, error) {
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	var err error
+	if q := c.QueryParam("from"); q != "" {
+		if from, err = time.ParseInLocation("2006-01-02", q, now.Location()); err != nil {
+			utils.HandleError(c, http.StatusBadRequest, err, "Error reading from date")
+			return from, to, err
+		}
+	}
+	if q := c.QueryParam("to"); q != "" {
+		if to, err = time.ParseInLocation("2006-01-02", q, now.Location()); err != nil {
+			utils.HandleError(c, http.StatusBadRequest, err, "Error reading to date")
+			return from, to, err
+		}
+	}
+	if to.Before(from) {
+		err = fmt.Errorf("to date is before from date")
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return from, to, err
+	}
+	return from, to.AddDate(0, 0, 1), nil
+}
+
+// writeReport sends report rows as JSON, or as a CSV download when
+// format=csv.
+func writeReport(c echo.Context, name string, rows any) error {
+	switch c.QueryParam("format") {
+	case "", "json":
+		return c.JSON(http.StatusOK, rows)
+	case "csv":
+		c.Response().Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+		c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.csv"`, name))
+		c.Response().WriteHeader(http.StatusOK)
+		return utils.WriteCSV(c.Response(), rows)
+	}
+	err := fmt.Errorf("format must be json or csv")
+	utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+	return err
+}
+
+// RevenueReport godoc
+//
+//	@Summary		Revenue report
+//	@Description	Sum the charged amount, net amount and tax of the rents started in a period, with the late and damage fees taken at their return, converted to the base currency, per day, week, month, category or product
+//	@Tags			Report
+//	@Accept			json
+//	@Produce		json,text/csv
+//	@Param			group	query		string	false	"day, week, month, category or product, defaults to month"
+//	@Param			from	query		string	false	"Start date, YYYY-MM-DD, defaults to the first day of the current month"
+//	@Param			to		query		string	false	"End date, YYYY-MM-DD, inclusive, defaults to today"
+//	@Param			format	query		string	false	"json or csv"
+//	@Success		200		{array}		entity.RevenueRow
+//	@Failure		400		{object}	utils.ErrorResponse
+//	@Failure		401		{object}	utils.ErrorResponse
+//	@Failure		500		{object}	utils.ErrorResponse
+//	@Router			/reports/revenue [get]
+func (rh ReportHandler) RevenueReport(c echo.Context) error {
+	from, to, err := reportPeriod(c)
+	if err != nil {
+		return err
+	}
+	group := c.QueryParam("group")
+	if group == "" {
+		group = report.ByMonth
+	}
+	if !report.ValidPeriod(group) && group != report.ByCategory && group != report.ByProduct {
+		err := fmt.Errorf("group must be day, week, month, category or product")
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+	rows, err := report.Revenue(rh.DB, group, from, to)
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error retrieving data")
+		return err
+	}
+	return writeReport(c, "revenue-by-"+group, rows)
+}
+
+// UtilizationReport godoc
+//
+//	@Summary		Fleet utilization report
+//	@Description	Show per product the days its units were rented out in a period against the days they were available, as a percentage. Each stock unit counts as available every day of the period.
+//	@Tags			Report
+//	@Accept			json
+//	@Produce		json,text/csv
+//	@Param			from	query		string	false	"Start date, YYYY-MM-DD, defaults to the first day of the current month"
+//	@Param			to		query		string	false	"End date, YYYY-MM-DD, inclusive, defaults to today"
+//	@Param			format	query		string	false	"json or csv"
+//	@Success		200		{array}		entity.UtilizationRow
+//	@Failure		400		{object}	utils.ErrorResponse
+//	@Failure		401		{object}	utils.ErrorResponse
+//	@Failure		500		{object}	utils.ErrorResponse
+//	@Router			/reports/utilization [get]
+func (rh ReportHandler) UtilizationReport(c echo.Context) error {
+	from, to, err := reportPeriod(c)
+	if err != nil {
+		return err
+	}
+	rows, err := report.Utilization(rh.DB, from, to, time.Now())
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error retrieving data")
+		return err
+	}
+	return writeReport(c, "utilization", rows)
+}
+
+// RentalLengthReport godoc
+//
+//	@Summary		Rental length report
+//	@Description	Average the booked length of the rents started in a period, and the actual length of the returned ones, per category with an "all" total row
+//	@Tags			Report
+//	@Accept			json
+//	@Produce		json,text/csv
+//	@Param			from	query		string	false	"Start date, YYYY-MM-DD, defaults to the first day of the current month"
+//	@Param			to		query		string	false	"End date, YYYY-MM-DD, inclusive, defaults to today"
+//	@Param			format	query		string	false	"json or csv"
+//	@Success		200		{array}		entity.RentalLengthRow
+//	@Failure		400		{object}	utils.ErrorResponse
+//	@Failure		401		{object}	utils.ErrorResponse
+//	@Failure		500		{object}	utils.ErrorResponse
+//	@Router			/reports/rental-length [get]
+func (rh ReportHandler) RentalLengthReport(c echo.Context) error {
+	from, to, err := reportPeriod(c)
+	if err != nil {
+		return err
+	}
+	rows, err := report.RentalLength(rh.DB, from, to)
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error retrieving data")
+		return err
+	}
+	return writeReport(c, "rental-length", rows)
+}
+
+// TopCustomersReport godoc
+//
+//	@Summary		Top customers report
+//	@Description	Rank the customers who spent the most on rents started in a period, converted to the base currency
+//	@Tags			Report
+//	@Accept			json
+//	@Produce		json,text/csv
+//	@Param			limit	query		int		false	"Number of customers, 1 to 100, defaults to 10"
+//	@Param			from	query		string	false	"Start date, YYYY-MM-DD, defaults to the first day of the current month"
+//	@Param			to		query		string	false	"End date, YYYY-MM-DD, inclusive, defaults to today"
+//	@Param			format	query		string	false	"json or csv"
+//	@Success		200		{array}		entity.TopCustomerRow
+//	@Failure		400		{object}	utils.ErrorResponse
+//	@Failure		401		{object}	utils.ErrorResponse
+//	@Failure		500		{object}	utils.ErrorResponse
+//	@Router			/reports/top-customers [get]
+func (rh ReportHandler) TopCustomersReport(c echo.Context) error {
+	from, to, err := reportPeriod(c)
+	if err != nil {
+		return err
+	}
+	limit := 10
+	if q := c.QueryParam("limit"); q != "" {
+		limit, err = strconv.Atoi(q)
+		if err != nil || limit < 1 || limit > 100 {
+			err = fmt.Errorf("limit must be between 1 and 100")
+			utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+			return err
+		}
+	}
+	rows, err := report.TopCustomers(rh.DB, from, to, limit)
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error retrieving data")
+		return err
+	}
+	return writeReport(c, "top-customers", rows)
+}
+
+// TopUpReport godoc
+//
+//	@Summary		Top-up volume report
+//	@Description	Count and sum the wallet top-ups made in a period, converted to the base currency, per day, week or month
+//	@Tags			Report
+//	@Accept			json
+//	@Produce		json,text/csv
+//	@Param			group	query		string	false	"day, week or month, defaults to month"
+//	@Param			from	query		string	false	"Start date, YYYY-MM-DD, defaults to the first day of the current month"
+//	@Param			to		query		string	false	"End date, YYYY-MM-DD, inclusive, defaults to today"
+//	@Param			format	query		string	false	"json or csv"
+//	@Success		200		{array}		entity.TopUpRow
+//	@Failure		400		{object}	utils.ErrorResponse
+//	@Failure		401		{object}	utils.ErrorResponse
+//	@Failure		500		{object}	utils.ErrorResponse
+//	@Router			/reports/topups [get]
+func (rh ReportHandler) TopUpReport(c echo.Context) error {
+	from, to, err := reportPeriod(c)
+	if err != nil {
+		return err
+	}
+	group := c.QueryParam("group")
+	if group == "" {
+		group = report.ByMonth
+	}
+	if !report.ValidPeriod(group) {
+		err := fmt.Errorf("group must be day, week or month")
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+	rows, err := report.TopUps(rh.DB, group, from, to)
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error retrieving data")
+		return err
+	}
+	return writeReport(c, "topups-by-"+group, rows)
+}
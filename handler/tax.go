@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"car-rental/entity"
+	"car-rental/pricing"
+	"car-rental/utils"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ReadAllTaxRates godoc
+//
+//	@Summary		Show all tax rates
+//	@Description	Show all tax rates with the category and branch they apply to
+//	@Tags			Tax
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{array}		entity.TaxRate
+//	@Failure		401	{object}	utils.ErrorResponse
+//	@Failure		500	{object}	utils.ErrorResponse
+//	@Router			/tax/rates [get]
+func (th TaxHandler) ReadAllTaxRates(c echo.Context) error {
+	var rates []entity.TaxRate
+	result := th.DB.Order("id").Find(&rates)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving data")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, rates)
+	return nil
+}
+
+// CreateTaxRate godoc
+//
+//	@Summary		Create tax rate
+//	@Description	Insert a new tax rate. Empty category and branch apply to every product, the most specific rate wins. Inclusive rates treat prices as already including the tax.
+//	@Tags			Tax
+//	@Accept			json
+//	@Produce		json
+//	@Param			rate	body		entity.TaxRate	true	"Tax rate"
+//	@Success		201		{object}	entity.TaxRate
+//	@Failure		400		{object}	utils.ErrorResponse
+//	@Failure		401		{object}	utils.ErrorResponse
+//	@Router			/tax/rates [post]
+func (th TaxHandler) CreateTaxRate(c echo.Context) error {
+	var rate entity.TaxRate
+	if err := c.Bind(&rate); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+	rate.ID = 0
+	if err := pricing.ValidateTaxRate(rate); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Invalid tax rate")
+		return err
+	}
+
+	result := th.DB.Create(&rate)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error inserting data")
+		return result.Error
+	}
+	c.JSON(http.StatusCreated, rate)
+	return nil
+}
+
+// UpdateTaxRate godoc
+//
+//	@Summary		Update tax rate
+//	@Description	Replace the tax rate targeted by the given ID. Rents already booked keep their tax.
+//	@Tags			Tax
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int				true	"Tax rate ID"
+//	@Param			rate	body		entity.TaxRate	true	"Tax rate"
+//	@Success		200		{object}	entity.TaxRate
+//	@Failure		400		{object}	utils.ErrorResponse
+//	@Failure		401		{object}	utils.ErrorResponse
+//	@Router			/tax/rates/{id} [put]
+func (th TaxHandler) UpdateTaxRate(c echo.Context) error {
+	var stored entity.TaxRate
+	result := th.DB.Where("id = ?", c.Param("id")).First(&stored)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error retrieving tax rate data")
+		return result.Error
+	}
+
+	var rate entity.TaxRate
+	if err := c.Bind(&rate); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+	rate.ID = stored.ID
+	if err := pricing.ValidateTaxRate(rate); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Invalid tax rate")
+		return err
+	}
+
+	result = th.DB.Save(&rate)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error updating data")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, rate)
+	return nil
+}
+
+// DeleteTaxRate godoc
+//
+//	@Summary		Delete tax rate
+//	@Description	Delete the tax rate targeted by the given ID
+//	@Tags			Tax
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"Tax rate ID"
+//	@Success		200	{object}	string
+//	@Failure		400	{object}	utils.ErrorResponse
+//	@Failure		401	{object}	utils.ErrorResponse
+//	@Failure		500	{object}	utils.ErrorResponse
+//	@Router			/tax/rates/{id} [delete]
+func (th TaxHandler) DeleteTaxRate(c echo.Context) error {
+	var rate entity.TaxRate
+	result := th.DB.Where("id = ?", c.Param("id")).First(&rate)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error retrieving tax rate data")
+		return result.Error
+	}
+	result = th.DB.Delete(&rate)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error deleting tax rate")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, map[string]any{
+		"message": "tax rate successfully deleted",
+	})
+	return nil
+}
+
+// TaxSummary godoc
+//
+//	@Summary		Tax summary
+//	@Description	Sum the charged amount, net amount and tax of the rents started in a period, per currency and tax rate
+//	@Tags			Tax
+//	@Accept			json
+//	@Produce		json
+//	@Param			from	query		string	false	"Start date, YYYY-MM-DD, defaults to the first day of the current month"
+//	@Param			to		query		string	false	"End date, YYYY-MM-DD, inclusive, defaults to today"
+//	@Success		200		{array}		entity.TaxSummaryRow
+//	@Failure		400		{object}	utils.ErrorResponse
+//	@Failure		401		{object}	utils.ErrorResponse
+//	@Failure		500		{object}	utils.ErrorResponse
+//	@Router			/tax/summary [get]
+func (th TaxHandler) TaxSummary(c echo.Context) error {
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	// today, bookings starting later are not in the summary yet
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	var err error
+	if q := c.QueryParam("from"); q != "" {
+		if from, err = time.ParseInLocation("2006-01-02", q, now.Location()); err != nil {
+			utils.HandleError(c, http.StatusBadRequest, err, "Error reading from date")
+			return err
+		}
+	}
+	if q := c.QueryParam("to"); q != "" {
+		if to, err = time.ParseInLocation("2006-01-02", q, now.Location()); err != nil {
+			utils.HandleError(c, http.StatusBadRequest, err, "Error reading to date")
+			return err
+		}
+	}
+
+	var rows []entity.TaxSummaryRow
+	result := th.DB.Model(&entity.Record{}).
+		Select("currency, tax_name, tax_rate, COUNT(*) AS rents, SUM(total) AS total, SUM(total - tax) AS net, SUM(tax) AS tax").
+		Where("start_date >= ? AND start_date < ?", from, to.AddDate(0, 0, 1)).
+		Group("currency, tax_name, tax_rate").
+		Order("currency, tax_name, tax_rate").
+		Scan(&rows)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving data")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, rows)
+	return nil
+}
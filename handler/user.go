@@ -1,26 +1,40 @@
 package handler
 
 import (
+	"car-rental/audit"
+	"car-rental/currency"
+	"car-rental/emails"
 	"car-rental/entity"
+	"car-rental/events"
+	"car-rental/invoice"
+	"car-rental/loyalty"
+	"car-rental/notify"
+	"car-rental/payout"
+	"car-rental/pricing"
+	"car-rental/referral"
 	"car-rental/utils"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 // RegisterUser godoc
 //
 //	@Summary		Register User
-//	@Description	Register a user by json, notify the registered account, and returns a jwt token. Email will be validated first.
+//	@Description	Register a user by json, notify the registered account, and returns a jwt token. Email will be validated first. The optional currency sets the wallet currency, it defaults to the base currency. The optional locale picks the email language, it defaults to the Accept-Language header. The optional referrer_code is another user's referral code, both get wallet credit once the new user returns their first rent.
 //	@Tags			User
 //	@Accept			json
 //	@Produce		json,html
-//	@Param			account	body		entity.User	true	"Register user"
+//	@Param			account		body		entity.User	true	"Register user"
+//	@Param			X-Device-ID	header		string		false	"Device identifier, required with a referral code and limits referrals per device"
 //	@Success		201		{object}	entity.User
 //	@Failure		400		{object}	utils.ErrorResponse
 //	@Failure		500		{object}	utils.ErrorResponse
@@ -63,13 +77,98 @@ func (uh UserHandler) RegisterUser(c echo.Context) error {
 	}
 	user.Password = string(hashedPass)
 
+	// wallet currency
+	user.Currency = currency.Or(user.Currency)
+	supported, err := currency.Supported(uh.DB, user.Currency)
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error retrieving currencies")
+		return err
+	}
+	if !supported {
+		err = fmt.Errorf("currency %s is not supported", user.Currency)
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+
+	// email locale, from the input or the Accept-Language header
+	if user.Locale != "" {
+		locale := emails.NormalizeLocale(user.Locale)
+		if locale == "" {
+			err = fmt.Errorf("locale %q must look like en or en-GB", user.Locale)
+			utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+			return err
+		}
+		user.Locale = locale
+	} else {
+		// an unusable header is ignored, the default locale applies
+		user.Locale, _, _ = strings.Cut(c.Request().Header.Get("Accept-Language"), ",")
+		user.Locale, _, _ = strings.Cut(user.Locale, ";")
+		user.Locale = emails.NormalizeLocale(user.Locale)
+	}
+
+	code, err := referral.NewCode()
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error generating referral code")
+		return err
+	}
+	user.ReferralCode = &code
+
+	// check the referrer, holding its limits until the user is inserted
+	tx := uh.DB.Begin()
+	user.DeviceID = c.Request().Header.Get("X-Device-ID")
+	var referrer entity.User
+	if user.ReferrerCode != "" {
+		referrer, err = referral.Check(tx, user.ReferrerCode, user.Email, user.DeviceID)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, referral.ErrRejected) {
+				status = http.StatusBadRequest
+			}
+			utils.HandleError(c, status, err, "Referral code cannot be used")
+			tx.Rollback()
+			return err
+		}
+	}
+
 	// insert data
-	result := uh.DB.Select("name", "email", "password").Create(&user)
+	result := tx.Select("name", "email", "password", "currency", "locale", "referral_code", "device_id").Create(&user)
 	if result.Error != nil {
 		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error inserting")
+		tx.Rollback()
 		return result.Error
 	}
-	result.First(&user)
+	if referrer.ID != 0 {
+		result = tx.Create(&entity.Referral{
+			ReferrerID: referrer.ID,
+			ReferredID: user.ID,
+			DeviceID:   user.DeviceID,
+			Status:     referral.StatusPending,
+		})
+		if result.Error != nil {
+			utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error inserting referral")
+			tx.Rollback()
+			return result.Error
+		}
+	}
+	tx.Where("id = ?", user.ID).First(&user)
+	if err := audit.Log(tx, audit.ActorFrom(c), audit.Create, audit.Users, user.ID, nil, user); err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error writing audit log")
+		tx.Rollback()
+		return err
+	}
+	pending, err := uh.Events.Stage(tx, events.UserRegistered{User: user})
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error recording events")
+		tx.Rollback()
+		return err
+	}
+	result = tx.Commit()
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "commit error?")
+		return result.Error
+	}
+	uh.Events.Flush(c.Request().Context(), pending)
+	uh.DB.Where("id = ?", user.ID).First(&user)
 
 	// generate token
 	token, err := utils.GenerateToken(c, user.ID, user.Role)
@@ -78,20 +177,9 @@ func (uh UserHandler) RegisterUser(c echo.Context) error {
 		return err
 	}
 	// show token
-	err = c.JSON(http.StatusCreated, map[string]any{
+	return c.JSON(http.StatusCreated, map[string]any{
 		"token": token,
 	})
-	if err != nil {
-		utils.HandleError(c, http.StatusInternalServerError, err, "Error displaying token, try logging in.")
-		return err
-	}
-	// send email notification
-	err = utils.SendEmail(user.Email, fmt.Sprintf("Welcome to Car Rental, %s!", user.Name), "<h1>Welcome!</h1><br><p>You have successfully registered to Car Rental.</p>")
-	if err != nil {
-		utils.HandleError(c, http.StatusInternalServerError, err, "Error sending email")
-		return err
-	}
-	return nil
 }
 
 // LoginUser godoc
@@ -191,7 +279,7 @@ func (uh UserHandler) ReadByID(c echo.Context) error {
 // TopUpDeposit godoc
 //
 //	@Summary		Top up user deposit
-//	@Description	Top up the user's deposit by the specified amount, and send an email notification
+//	@Description	Top up the user's deposit by the specified amount, issue an invoice, and send an email notification with the invoice attached
 //	@Tags			User
 //	@Accept			json
 //	@Produce		json
@@ -223,22 +311,320 @@ func (uh UserHandler) TopUpDeposit(c echo.Context) error {
 		return result.Error
 	}
 
+	if topUp.Deposit <= 0 {
+		err = fmt.Errorf("top up amount must be positive")
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+
+	tx := uh.DB.Begin()
+	wallets, err := audit.SnapshotWallets(tx, user.ID)
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error reading wallet")
+		tx.Rollback()
+		return err
+	}
 	// add input deposit to user deposit
-	user.Deposit += topUp.Deposit
-	result = uh.DB.Save(&user)
+	result = tx.Model(&user).Update("deposit", gorm.Expr("deposit + ?", topUp.Deposit))
 	if result.Error != nil {
 		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error updating data")
+		tx.Rollback()
 		return result.Error
 	}
-	c.JSON(http.StatusOK, map[string]any{
+	entry := entity.LedgerEntry{
+		UserID:           user.ID,
+		Type:             "topup",
+		Amount:           topUp.Deposit,
+		Currency:         currency.Or(user.Currency),
+		OriginalAmount:   topUp.Deposit,
+		OriginalCurrency: currency.Or(user.Currency),
+		ExchangeRate:     1,
+	}
+	result = tx.Create(&entry)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error inserting ledger entry")
+		tx.Rollback()
+		return result.Error
+	}
+	inv := entity.Invoice{
+		Kind:          invoice.KindTopUp,
+		UserID:        user.ID,
+		LedgerEntryID: &entry.ID,
+		CustomerName:  user.Name,
+		CustomerEmail: user.Email,
+		Lines:         []entity.InvoiceLine{{Description: "Wallet top-up", Amount: topUp.Deposit}},
+		Currency:      currency.Or(user.Currency),
+	}
+	if err := invoice.Issue(tx, &inv); err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error issuing invoice")
+		tx.Rollback()
+		return err
+	}
+	// the top-up pays off unpaid return fees first
+	if _, err := pricing.PayOwed(tx, user.ID); err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error paying owed fees")
+		tx.Rollback()
+		return err
+	}
+	tx.Where("id = ?", user.ID).First(&user)
+
+	if err := wallets.Log(tx, audit.ActorFrom(c)); err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error writing audit log")
+		tx.Rollback()
+		return err
+	}
+	pending, err := uh.Events.Stage(tx, events.WalletToppedUp{User: user, Amount: topUp.Deposit, Invoice: inv})
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error recording events")
+		tx.Rollback()
+		return err
+	}
+	result = tx.Commit()
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "commit error?")
+		return result.Error
+	}
+	uh.Events.Flush(c.Request().Context(), pending)
+
+	return c.JSON(http.StatusOK, map[string]any{
 		"Current Deposit": user.Deposit,
+		"currency":        currency.Or(user.Currency),
+		"invoice":         inv.Number,
+		"owed":            user.Owed,
 	})
+}
 
-	// send email notification
-	err = utils.SendEmail(user.Email, "Top Up Successful!", fmt.Sprintf("<h1>Top Up Successful!</h1><br><p>Your Car Rental Deposit is now %v.</p>", user.Deposit))
+// GetWallet godoc
+//
+//	@Summary		Show user wallet
+//	@Description	Show the logged in user's deposit, the part reserved by security holds and requested withdrawals, the available balance, unpaid return fees, the open holds and the withdrawals not yet settled
+//	@Tags			User
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	string
+//	@Failure		401	{object}	utils.ErrorResponse
+//	@Failure		500	{object}	utils.ErrorResponse
+//	@Router			/users/wallet [get]
+func (uh UserHandler) GetWallet(c echo.Context) error {
+	// get user from auth token
+	claims, err := utils.DecodeToken(c)
 	if err != nil {
-		utils.HandleError(c, http.StatusInternalServerError, err, "Error sending email")
+		utils.HandleError(c, http.StatusUnauthorized, err, "Error reading token")
 		return err
 	}
+	var user entity.User
+	result := uh.DB.Where("id = ?", claims["userID"]).First(&user)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving user data")
+		return result.Error
+	}
+
+	var holds []entity.DepositHold
+	result = uh.DB.Where("user_id = ? AND status = ?", user.ID, pricing.HoldHeld).Order("id").Find(&holds)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving holds")
+		return result.Error
+	}
+	var withdrawals []entity.Withdrawal
+	result = uh.DB.Where("user_id = ? AND status IN ?", user.ID, []string{payout.WithdrawalRequested, payout.WithdrawalProcessing}).Order("id").Find(&withdrawals)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving withdrawals")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, map[string]any{
+		"currency":    currency.Or(user.Currency),
+		"deposit":     user.Deposit,
+		"reserved":    user.Reserved,
+		"available":   user.Deposit - user.Reserved,
+		"owed":        user.Owed,
+		"holds":       holds,
+		"withdrawals": withdrawals,
+	})
 	return nil
 }
+
+// GetProfile godoc
+//
+//	@Summary		Show user profile
+//	@Description	Show the logged in user with their loyalty points, tier, rolling yearly spend, the next tier, their referral code and the users they referred
+//	@Tags			User
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	string
+//	@Failure		401	{object}	utils.ErrorResponse
+//	@Failure		500	{object}	utils.ErrorResponse
+//	@Router			/users/me [get]
+func (uh UserHandler) GetProfile(c echo.Context) error {
+	// get user from auth token
+	claims, err := utils.DecodeToken(c)
+	if err != nil {
+		utils.HandleError(c, http.StatusUnauthorized, err, "Error reading token")
+		return err
+	}
+	var user entity.User
+	result := uh.DB.Where("id = ?", claims["userID"]).First(&user)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving user data")
+		return result.Error
+	}
+	if err := referral.EnsureCode(uh.DB, &user); err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error generating referral code")
+		return err
+	}
+	user.Password = ""
+
+	var referrals []entity.Referral
+	result = uh.DB.Where("referrer_id = ?", user.ID).Order("id").Find(&referrals)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving referrals")
+		return result.Error
+	}
+
+	tier, spend, err := loyalty.TierFor(uh.DB, user.ID, time.Now())
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error retrieving loyalty tier")
+		return err
+	}
+	next, err := loyalty.NextTier(uh.DB, spend)
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error retrieving loyalty tier")
+		return err
+	}
+	profile := map[string]any{
+		"user":          user,
+		"points":        user.Points,
+		"points_value":  float64(user.Points) * loyalty.PointValue(),
+		"base_currency": currency.Base(),
+		"rolling_spend": spend,
+		"tier":          nil,
+		"next_tier":     nil,
+		"referral_code": user.ReferralCode,
+		"referrals":     referrals,
+	}
+	if tier.ID != 0 {
+		profile["tier"] = tier
+	}
+	if next.ID != 0 {
+		profile["next_tier"] = next
+	}
+	c.JSON(http.StatusOK, profile)
+	return nil
+}
+
+// GetNotificationSettings godoc
+//
+//	@Summary		Show notification settings
+//	@Description	Show the logged in user's phone, webhook URL and the channels enabled for each event. Events without a stored preference go out by email only.
+//	@Tags			User
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	entity.NotificationSettings
+//	@Failure		401	{object}	utils.ErrorResponse
+//	@Failure		500	{object}	utils.ErrorResponse
+//	@Router			/users/notifications [get]
+func (uh UserHandler) GetNotificationSettings(c echo.Context) error {
+	claims, err := utils.DecodeToken(c)
+	if err != nil {
+		utils.HandleError(c, http.StatusUnauthorized, err, "Error reading token")
+		return err
+	}
+	var user entity.User
+	result := uh.DB.Where("id = ?", claims["userID"]).First(&user)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving user data")
+		return result.Error
+	}
+
+	prefs, err := notify.Preferences(uh.DB, user.ID)
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error retrieving preferences")
+		return err
+	}
+	c.JSON(http.StatusOK, entity.NotificationSettings{
+		Phone:       user.Phone,
+		WebhookURL:  user.WebhookURL,
+		Preferences: prefs,
+	})
+	return nil
+}
+
+// SetNotificationSettings godoc
+//
+//	@Summary		Set notification settings
+//	@Description	Set the logged in user's phone and webhook URL, and switch channels on or off per event. The phone, the webhook URL, events and channels left out keep their setting, an empty phone or webhook URL removes it. The phone is in international format, e.g. +6281234567890. Events are booking_confirmed, topup_received, low_balance, rental_starting_soon and rental_ending_soon, channels are email, sms and webhook.
+//	@Tags			User
+//	@Accept			json
+//	@Produce		json
+//	@Param			settings	body		entity.NotificationSettingsInput	true	"Notification settings"
+//	@Success		200			{object}	entity.NotificationSettings
+//	@Failure		400			{object}	utils.ErrorResponse
+//	@Failure		401			{object}	utils.ErrorResponse
+//	@Failure		500			{object}	utils.ErrorResponse
+//	@Router			/users/notifications [put]
+func (uh UserHandler) SetNotificationSettings(c echo.Context) error {
+	claims, err := utils.DecodeToken(c)
+	if err != nil {
+		utils.HandleError(c, http.StatusUnauthorized, err, "Error reading token")
+		return err
+	}
+	var user entity.User
+	result := uh.DB.Where("id = ?", claims["userID"]).First(&user)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving user data")
+		return result.Error
+	}
+
+	var input entity.NotificationSettingsInput
+	if err := c.Bind(&input); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+	// only the contact details that were sent are changed
+	updates := map[string]any{}
+	if input.Phone != nil {
+		if *input.Phone != "" {
+			if err := notify.ValidatePhone(*input.Phone); err != nil {
+				utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+				return err
+			}
+		}
+		updates["phone"] = *input.Phone
+	}
+	if input.WebhookURL != nil {
+		if *input.WebhookURL != "" {
+			if err := utils.CheckPublicURL(c.Request().Context(), *input.WebhookURL); err != nil {
+				err = fmt.Errorf("webhook_url must be an http or https URL of a public host: %w", err)
+				utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+				return err
+			}
+		}
+		updates["webhook_url"] = *input.WebhookURL
+	}
+
+	before := user
+	tx := uh.DB.Begin()
+	if len(updates) > 0 {
+		result = tx.Model(&user).Updates(updates)
+		if result.Error != nil {
+			utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error updating user")
+			tx.Rollback()
+			return result.Error
+		}
+	}
+	if err := audit.Log(tx, audit.ActorFrom(c), audit.Update, audit.Users, user.ID, before, user); err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error writing audit log")
+		tx.Rollback()
+		return err
+	}
+	if err := notify.SetPreferences(tx, user.ID, input.Preferences); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error saving preferences")
+		tx.Rollback()
+		return err
+	}
+	result = tx.Commit()
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "commit error?")
+		return result.Error
+	}
+	return uh.GetNotificationSettings(c)
+}
@@ -0,0 +1,233 @@
+package handler
+
+import (
+	"car-rental/entity"
+	"car-rental/utils"
+	"car-rental/webhook"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ReadAllWebhookEndpoints godoc
+//
+//	@Summary		Show webhook endpoints
+//	@Description	Show every partner webhook endpoint with the events it is subscribed to
+//	@Tags			Webhook
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{array}		entity.WebhookEndpoint
+//	@Failure		401	{object}	utils.ErrorResponse
+//	@Failure		500	{object}	utils.ErrorResponse
+//	@Router			/webhooks/endpoints [get]
+func (wh WebhookHandler) ReadAllWebhookEndpoints(c echo.Context) error {
+	var endpoints []entity.WebhookEndpoint
+	result := wh.DB.Order("id").Find(&endpoints)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving data")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, endpoints)
+	return nil
+}
+
+// CreateWebhookEndpoint godoc
+//
+//	@Summary		Create webhook endpoint
+//	@Description	Register a partner URL for events rental.created, rental.returned, wallet.topped_up and product.updated, or * for all. A signing secret is generated: every delivery carries X-Webhook-Timestamp and X-Webhook-Signature, the hex HMAC-SHA256 of "<timestamp>.<body>".
+//	@Tags			Webhook
+//	@Accept			json
+//	@Produce		json
+//	@Param			endpoint	body		entity.WebhookEndpoint	true	"Webhook endpoint"
+//	@Success		201			{object}	entity.WebhookEndpoint
+//	@Failure		400			{object}	utils.ErrorResponse
+//	@Failure		401			{object}	utils.ErrorResponse
+//	@Router			/webhooks/endpoints [post]
+func (wh WebhookHandler) CreateWebhookEndpoint(c echo.Context) error {
+	var endpoint entity.WebhookEndpoint
+	if err := c.Bind(&endpoint); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+	endpoint.ID = 0
+	if err := webhook.ValidateEndpoint(endpoint); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Invalid webhook endpoint")
+		return err
+	}
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error generating secret")
+		return err
+	}
+	endpoint.Secret = secret
+
+	result := wh.DB.Create(&endpoint)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error inserting data")
+		return result.Error
+	}
+	c.JSON(http.StatusCreated, endpoint)
+	return nil
+}
+
+// UpdateWebhookEndpoint godoc
+//
+//	@Summary		Update webhook endpoint
+//	@Description	Replace the URL, description, events and disabled flag of the endpoint targeted by the given ID. The secret is kept.
+//	@Tags			Webhook
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			path		int						true	"Endpoint ID"
+//	@Param			endpoint	body		entity.WebhookEndpoint	true	"Webhook endpoint"
+//	@Success		200			{object}	entity.WebhookEndpoint
+//	@Failure		400			{object}	utils.ErrorResponse
+//	@Failure		401			{object}	utils.ErrorResponse
+//	@Router			/webhooks/endpoints/{id} [put]
+func (wh WebhookHandler) UpdateWebhookEndpoint(c echo.Context) error {
+	var stored entity.WebhookEndpoint
+	result := wh.DB.Where("id = ?", c.Param("id")).First(&stored)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error retrieving endpoint data")
+		return result.Error
+	}
+
+	var endpoint entity.WebhookEndpoint
+	if err := c.Bind(&endpoint); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+	if err := webhook.ValidateEndpoint(endpoint); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Invalid webhook endpoint")
+		return err
+	}
+	stored.URL = endpoint.URL
+	stored.Description = endpoint.Description
+	stored.Events = endpoint.Events
+	stored.Disabled = endpoint.Disabled
+
+	result = wh.DB.Save(&stored)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error updating data")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, stored)
+	return nil
+}
+
+// DeleteWebhookEndpoint godoc
+//
+//	@Summary		Delete webhook endpoint
+//	@Description	Delete the endpoint targeted by the given ID. Its delivery log is kept.
+//	@Tags			Webhook
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"Endpoint ID"
+//	@Success		200	{object}	string
+//	@Failure		400	{object}	utils.ErrorResponse
+//	@Failure		401	{object}	utils.ErrorResponse
+//	@Failure		500	{object}	utils.ErrorResponse
+//	@Router			/webhooks/endpoints/{id} [delete]
+func (wh WebhookHandler) DeleteWebhookEndpoint(c echo.Context) error {
+	var endpoint entity.WebhookEndpoint
+	result := wh.DB.Where("id = ?", c.Param("id")).First(&endpoint)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error retrieving endpoint data")
+		return result.Error
+	}
+	result = wh.DB.Delete(&endpoint)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error deleting endpoint")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, map[string]any{
+		"message": "endpoint successfully deleted",
+	})
+	return nil
+}
+
+// ReadWebhookDeliveries godoc
+//
+//	@Summary		Show webhook deliveries
+//	@Description	Show the latest deliveries without their attempt log, optionally filtered by endpoint, event and status pending, sending, delivered or dead
+//	@Tags			Webhook
+//	@Accept			json
+//	@Produce		json
+//	@Param			endpoint_id	query		int		false	"Endpoint ID"
+//	@Param			event		query		string	false	"Event type"
+//	@Param			status		query		string	false	"Delivery status"
+//	@Success		200			{array}		entity.WebhookDelivery
+//	@Failure		401			{object}	utils.ErrorResponse
+//	@Failure		500			{object}	utils.ErrorResponse
+//	@Router			/webhooks/deliveries [get]
+func (wh WebhookHandler) ReadWebhookDeliveries(c echo.Context) error {
+	query := wh.DB.Order("id DESC").Limit(200)
+	if id := c.QueryParam("endpoint_id"); id != "" {
+		query = query.Where("endpoint_id = ?", id)
+	}
+	if event := c.QueryParam("event"); event != "" {
+		query = query.Where("event = ?", event)
+	}
+	if status := c.QueryParam("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var deliveries []entity.WebhookDelivery
+	result := query.Find(&deliveries)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving data")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, deliveries)
+	return nil
+}
+
+// ReadWebhookDelivery godoc
+//
+//	@Summary		Show webhook delivery
+//	@Description	Show the delivery targeted by the given ID with the log of every attempt
+//	@Tags			Webhook
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"Delivery ID"
+//	@Success		200	{object}	entity.WebhookDelivery
+//	@Failure		400	{object}	utils.ErrorResponse
+//	@Failure		401	{object}	utils.ErrorResponse
+//	@Router			/webhooks/deliveries/{id} [get]
+func (wh WebhookHandler) ReadWebhookDelivery(c echo.Context) error {
+	var delivery entity.WebhookDelivery
+	result := wh.DB.Preload("Log").Where("id = ?", c.Param("id")).First(&delivery)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error retrieving delivery data")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, delivery)
+	return nil
+}
+
+// ReplayWebhookDelivery godoc
+//
+//	@Summary		Replay webhook delivery
+//	@Description	Queue the payload of the delivery targeted by the given ID again, to the same endpoint and with the same event ID
+//	@Tags			Webhook
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"Delivery ID"
+//	@Success		201	{object}	entity.WebhookDelivery
+//	@Failure		400	{object}	utils.ErrorResponse
+//	@Failure		401	{object}	utils.ErrorResponse
+//	@Failure		500	{object}	utils.ErrorResponse
+//	@Router			/webhooks/deliveries/{id}/replay [post]
+func (wh WebhookHandler) ReplayWebhookDelivery(c echo.Context) error {
+	var delivery entity.WebhookDelivery
+	result := wh.DB.Where("id = ?", c.Param("id")).First(&delivery)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error retrieving delivery data")
+		return result.Error
+	}
+	replay, err := webhook.Replay(wh.DB, delivery)
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error queueing replay")
+		return err
+	}
+	c.JSON(http.StatusCreated, replay)
+	return nil
+}
@@ -0,0 +1,215 @@
+package handler
+
+import (
+	"car-rental/audit"
+	"car-rental/entity"
+	"car-rental/payout"
+	"car-rental/utils"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RequestWithdrawal godoc
+//
+//	@Summary		Request withdrawal
+//	@Description	Ask for unused wallet balance to be paid out to an account. The amount is reserved until an admin approves or rejects the request. A zero amount withdraws the whole available balance.
+//	@Tags			Withdrawal
+//	@Accept			json
+//	@Produce		json
+//	@Param			withdrawal	body		entity.WithdrawalInput	true	"Withdrawal"
+//	@Success		201			{object}	entity.Withdrawal
+//	@Failure		400			{object}	utils.ErrorResponse
+//	@Failure		401			{object}	utils.ErrorResponse
+//	@Failure		500			{object}	utils.ErrorResponse
+//	@Router			/users/withdrawals [post]
+func (wh WithdrawalHandler) RequestWithdrawal(c echo.Context) error {
+	// get user from auth token
+	claims, err := utils.DecodeToken(c)
+	if err != nil {
+		utils.HandleError(c, http.StatusUnauthorized, err, "Error reading token")
+		return err
+	}
+	var user entity.User
+	result := wh.DB.Where("id = ?", claims["userID"]).First(&user)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving user data")
+		return result.Error
+	}
+
+	var input entity.WithdrawalInput
+	if err := c.Bind(&input); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+	withdrawal, err := payout.RequestWithdrawal(wh.DB, audit.ActorFrom(c), user, input.Amount, input.Destination)
+	if err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Withdrawal cannot be requested")
+		return err
+	}
+	c.JSON(http.StatusCreated, withdrawal)
+	return nil
+}
+
+// ReadUserWithdrawals godoc
+//
+//	@Summary		Show user withdrawals
+//	@Description	Show the logged in user's withdrawals, newest first
+//	@Tags			Withdrawal
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{array}		entity.Withdrawal
+//	@Failure		401	{object}	utils.ErrorResponse
+//	@Failure		500	{object}	utils.ErrorResponse
+//	@Router			/users/withdrawals [get]
+func (wh WithdrawalHandler) ReadUserWithdrawals(c echo.Context) error {
+	claims, err := utils.DecodeToken(c)
+	if err != nil {
+		utils.HandleError(c, http.StatusUnauthorized, err, "Error reading token")
+		return err
+	}
+	var withdrawals []entity.Withdrawal
+	result := wh.DB.Where("user_id = ?", claims["userID"]).Order("id DESC").Find(&withdrawals)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving data")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, withdrawals)
+	return nil
+}
+
+// ReadAllWithdrawals godoc
+//
+//	@Summary		Show all withdrawals
+//	@Description	Show all withdrawals, optionally only those with a status of requested, rejected, processing, settled or failed
+//	@Tags			Withdrawal
+//	@Accept			json
+//	@Produce		json
+//	@Param			status	query		string	false	"Withdrawal status"
+//	@Success		200		{array}		entity.Withdrawal
+//	@Failure		401		{object}	utils.ErrorResponse
+//	@Failure		500		{object}	utils.ErrorResponse
+//	@Router			/withdrawals/ [get]
+func (wh WithdrawalHandler) ReadAllWithdrawals(c echo.Context) error {
+	query := wh.DB.Order("id")
+	if status := c.QueryParam("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var withdrawals []entity.Withdrawal
+	result := query.Find(&withdrawals)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving data")
+		return result.Error
+	}
+	c.JSON(http.StatusOK, withdrawals)
+	return nil
+}
+
+// ApproveWithdrawal godoc
+//
+//	@Summary		Approve withdrawal
+//	@Description	Approve a requested withdrawal. The amount leaves the deposit as a pending ledger entry and is sent to the payout provider. It settles, or is put back if the payout fails, when the provider reports so.
+//	@Tags			Withdrawal
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"Withdrawal ID"
+//	@Success		200	{object}	entity.Withdrawal
+//	@Failure		400	{object}	utils.ErrorResponse
+//	@Failure		401	{object}	utils.ErrorResponse
+//	@Failure		409	{object}	utils.ErrorResponse
+//	@Failure		502	{object}	utils.ErrorResponse
+//	@Router			/withdrawals/{id}/approve [post]
+func (wh WithdrawalHandler) ApproveWithdrawal(c echo.Context) error {
+	var withdrawal entity.Withdrawal
+	result := wh.DB.Where("id = ?", c.Param("id")).First(&withdrawal)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error retrieving withdrawal data")
+		return result.Error
+	}
+
+	err := payout.Approve(c.Request().Context(), wh.DB, wh.Payouts, &withdrawal, audit.ActorFrom(c), time.Now())
+	if errors.Is(err, payout.ErrAlreadyDecided) {
+		utils.HandleError(c, http.StatusConflict, err, "Withdrawal cannot be approved")
+		return err
+	}
+	if err != nil && withdrawal.Status == payout.WithdrawalProcessing {
+		// approved, but the provider could not be reached; sync retries it
+		utils.HandleError(c, http.StatusBadGateway, err, "Withdrawal approved but payout failed to send, retry with sync")
+		return err
+	}
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error approving withdrawal")
+		return err
+	}
+	c.JSON(http.StatusOK, withdrawal)
+	return nil
+}
+
+// RejectWithdrawal godoc
+//
+//	@Summary		Reject withdrawal
+//	@Description	Reject a requested withdrawal and give the reserved amount back to the wallet
+//	@Tags			Withdrawal
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			path		int							true	"Withdrawal ID"
+//	@Param			decision	body		entity.WithdrawalDecision	false	"Reason"
+//	@Success		200			{object}	entity.Withdrawal
+//	@Failure		400			{object}	utils.ErrorResponse
+//	@Failure		401			{object}	utils.ErrorResponse
+//	@Failure		409			{object}	utils.ErrorResponse
+//	@Router			/withdrawals/{id}/reject [post]
+func (wh WithdrawalHandler) RejectWithdrawal(c echo.Context) error {
+	var withdrawal entity.Withdrawal
+	result := wh.DB.Where("id = ?", c.Param("id")).First(&withdrawal)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusBadRequest, result.Error, "Error retrieving withdrawal data")
+		return result.Error
+	}
+	var input entity.WithdrawalDecision
+	if err := c.Bind(&input); err != nil {
+		utils.HandleError(c, http.StatusBadRequest, err, "Error reading input")
+		return err
+	}
+
+	err := payout.Reject(wh.DB, &withdrawal, audit.ActorFrom(c), input.Reason, time.Now())
+	if errors.Is(err, payout.ErrAlreadyDecided) {
+		utils.HandleError(c, http.StatusConflict, err, "Withdrawal cannot be rejected")
+		return err
+	}
+	if err != nil {
+		utils.HandleError(c, http.StatusInternalServerError, err, "Error rejecting withdrawal")
+		return err
+	}
+	c.JSON(http.StatusOK, withdrawal)
+	return nil
+}
+
+// SyncWithdrawals godoc
+//
+//	@Summary		Sync withdrawals
+//	@Description	Ask the payout provider about every processing withdrawal, settling the paid ones and putting failed ones back into the wallet
+//	@Tags			Withdrawal
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{array}		entity.Withdrawal
+//	@Failure		401	{object}	utils.ErrorResponse
+//	@Failure		500	{object}	utils.ErrorResponse
+//	@Router			/withdrawals/sync [post]
+func (wh WithdrawalHandler) SyncWithdrawals(c echo.Context) error {
+	var withdrawals []entity.Withdrawal
+	result := wh.DB.Where("status = ?", payout.WithdrawalProcessing).Order("id").Find(&withdrawals)
+	if result.Error != nil {
+		utils.HandleError(c, http.StatusInternalServerError, result.Error, "Error retrieving data")
+		return result.Error
+	}
+	for i := range withdrawals {
+		if err := payout.Sync(c.Request().Context(), wh.DB, wh.Payouts, &withdrawals[i], audit.ActorFrom(c)); err != nil {
+			c.Logger().Errorf("syncing withdrawal %d: %v", withdrawals[i].ID, err)
+		}
+	}
+	c.JSON(http.StatusOK, withdrawals)
+	return nil
+}
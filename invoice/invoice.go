@@ -0,0 +1,71 @@
+package invoice
+
+import (
+	"car-rental/entity"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	KindRental = "rental"
+	KindTopUp  = "topup"
+)
+
+// Issue numbers inv and stores it inside tx. The number comes from a counter
+// row that stays locked until tx ends, so concurrent invoices are numbered
+// one after the other and a rolled back transaction gives its number back,
+// leaving no gaps.
+func Issue(tx *gorm.DB, inv *entity.Invoice) error {
+	seq := entity.InvoiceSequence{Name: "invoice", Last: 1}
+	result := tx.Clauses(
+		clause.OnConflict{
+			Columns:   []clause.Column{{Name: "name"}},
+			DoUpdates: clause.Assignments(map[string]any{"last": gorm.Expr("invoice_sequences.last + 1")}),
+		},
+		clause.Returning{Columns: []clause.Column{{Name: "last"}}},
+	).Create(&seq)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	inv.IssuedAt = time.Now()
+	inv.Sequence = seq.Last
+	inv.Number = fmt.Sprintf("INV-%06d", seq.Last)
+	inv.CompanyName = os.Getenv("COMPANY_NAME")
+	inv.CompanyAddress = os.Getenv("COMPANY_ADDRESS")
+	inv.CompanyTaxID = os.Getenv("COMPANY_TAX_ID")
+	inv.Subtotal = 0
+	for _, line := range inv.Lines {
+		inv.Subtotal += line.Amount
+	}
+	inv.Subtotal = round(inv.Subtotal)
+	inv.Total = inv.Subtotal
+	if !inv.TaxInclusive {
+		inv.Total = round(inv.Subtotal + inv.Tax)
+	}
+	return tx.Create(inv).Error
+}
+
+// RentalLines turns a rent price into invoice lines.
+func RentalLines(product entity.Product, price entity.PriceBreakdown) []entity.InvoiceLine {
+	lines := []entity.InvoiceLine{{
+		Description: fmt.Sprintf("%s, %d day(s) at %.2f", product.Name, price.RentLength, price.DailyRate),
+		Amount:      price.Base,
+	}}
+	for _, line := range price.Lines {
+		lines = append(lines, entity.InvoiceLine{Description: line.Description, Amount: line.Amount})
+	}
+	for _, line := range price.AddOns {
+		lines = append(lines, entity.InvoiceLine{Description: line.Description, Amount: line.Amount})
+	}
+	return lines
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
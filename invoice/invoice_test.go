@@ -0,0 +1,75 @@
+package invoice
+
+import (
+	"car-rental/entity"
+	"car-rental/testdb"
+	"errors"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestIssueTotals(t *testing.T) {
+	tests := []struct {
+		name            string
+		inv             entity.Invoice
+		subtotal, total float64
+	}{
+		{"no tax", entity.Invoice{Lines: []entity.InvoiceLine{{Amount: 10.005}, {Amount: 5}}}, 15.01, 15.01},
+		{"exclusive tax", entity.Invoice{Lines: []entity.InvoiceLine{{Amount: 100}}, Tax: 11}, 100, 111},
+		{"inclusive tax", entity.Invoice{Lines: []entity.InvoiceLine{{Amount: 111}}, Tax: 11, TaxInclusive: true}, 111, 111},
+	}
+	db := testdb.Open(t)
+	for i, test := range tests {
+		inv := test.inv
+		if err := Issue(db, &inv); err != nil {
+			t.Fatal(err)
+		}
+		if inv.Sequence != uint(i+1) {
+			t.Errorf("%s: sequence %d, want %d", test.name, inv.Sequence, i+1)
+		}
+		if inv.Subtotal != test.subtotal || inv.Total != test.total {
+			t.Errorf("%s: subtotal %.2f and total %.2f, want %.2f and %.2f", test.name, inv.Subtotal, inv.Total, test.subtotal, test.total)
+		}
+	}
+}
+
+func TestIssueConcurrentWithoutGaps(t *testing.T) {
+	db := testdb.Open(t)
+	rollback := errors.New("rolled back")
+
+	// 40 invoices at the same time, every fourth transaction rolls back
+	var wg sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := db.Transaction(func(tx *gorm.DB) error {
+				inv := entity.Invoice{Kind: KindTopUp, Lines: []entity.InvoiceLine{{Amount: 1}}}
+				if err := Issue(tx, &inv); err != nil {
+					return err
+				}
+				if i%4 == 0 {
+					return rollback
+				}
+				return nil
+			})
+			if err != nil && !errors.Is(err, rollback) {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var invoices []entity.Invoice
+	db.Order("sequence").Find(&invoices)
+	if len(invoices) != 30 {
+		t.Fatalf("%d invoices, want 30", len(invoices))
+	}
+	for i, inv := range invoices {
+		if inv.Sequence != uint(i+1) {
+			t.Fatalf("invoice %d has sequence %d, numbering has gaps or duplicates", i+1, inv.Sequence)
+		}
+	}
+}
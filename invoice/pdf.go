@@ -0,0 +1,115 @@
+package invoice
+
+import (
+	"bytes"
+	"car-rental/entity"
+	"fmt"
+	"strings"
+)
+
+const linesPerPage = 48
+
+// RenderPDF lays an invoice out as plain text lines on A4 pages using the
+// built-in Courier font, so no font files or PDF libraries are needed.
+func RenderPDF(inv entity.Invoice) []byte {
+	text := []string{
+		"INVOICE " + inv.Number,
+		"",
+		inv.CompanyName,
+		inv.CompanyAddress,
+	}
+	if inv.CompanyTaxID != "" {
+		text = append(text, "Tax ID: "+inv.CompanyTaxID)
+	}
+	text = append(text,
+		"",
+		"Billed to: "+inv.CustomerName,
+		inv.CustomerEmail,
+		"Issued: "+inv.IssuedAt.Format("2006-01-02 15:04"),
+		"",
+	)
+	for _, line := range inv.Lines {
+		text = append(text, fmt.Sprintf("%-60s %12.2f", line.Description, line.Amount))
+	}
+	text = append(text,
+		"",
+		fmt.Sprintf("%-60s %12.2f", "Subtotal", inv.Subtotal),
+		fmt.Sprintf("%-60s %12.2f", taxLabel(inv), inv.Tax),
+		fmt.Sprintf("%-60s %12.2f", "Total", inv.Total),
+	)
+
+	var pages [][]string
+	for len(text) > linesPerPage {
+		pages = append(pages, text[:linesPerPage])
+		text = text[linesPerPage:]
+	}
+	pages = append(pages, text)
+	return writePDF(pages)
+}
+
+func writePDF(pages [][]string) []byte {
+	// object numbers: 1 catalog, 2 page tree, 3 font, then a page and a
+	// content stream per page
+	var objects []string
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+	)
+	for i, lines := range pages {
+		var stream bytes.Buffer
+		stream.WriteString("BT /F1 10 Tf 14 TL 50 800 Td\n")
+		for _, line := range lines {
+			fmt.Fprintf(&stream, "(%s) '\n", escape(line))
+		}
+		stream.WriteString("ET")
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", 5+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", stream.Len(), stream.String()),
+		)
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return out.Bytes()
+}
+
+// escape makes a line safe for a PDF string literal, replacing characters
+// outside printable ASCII.
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case r < 32 || r > 126:
+			b.WriteRune('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func taxLabel(inv entity.Invoice) string {
+	if inv.TaxInclusive {
+		return "Tax (included)"
+	}
+	return "Tax"
+}
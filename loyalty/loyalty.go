@@ -0,0 +1,194 @@
+package loyalty
+
+import (
+	"car-rental/currency"
+	"car-rental/entity"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrNotEnoughPoints is returned by Spend when the user spent the points
+// between pricing and renting.
+var ErrNotEnoughPoints = errors.New("not enough loyalty points")
+
+// spendWindow is how far back completed rents count towards a tier.
+const spendWindow = 365 * 24 * time.Hour
+
+// EarnUnit is how much base currency spend earns one point, set by
+// LOYALTY_EARN_UNIT.
+func EarnUnit() float64 {
+	return envFloat("LOYALTY_EARN_UNIT", 10000)
+}
+
+// PointValue is how much base currency one point is worth when redeemed, set
+// by LOYALTY_POINT_VALUE.
+func PointValue() float64 {
+	return envFloat("LOYALTY_POINT_VALUE", 100)
+}
+
+func envFloat(key string, fallback float64) float64 {
+	v, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil || v <= 0 {
+		return fallback
+	}
+	return v
+}
+
+// RollingSpend sums what a user paid, in the base currency, for rents
+// returned within the last year.
+func RollingSpend(db *gorm.DB, userID uint, now time.Time) (float64, error) {
+	var records []entity.Record
+	result := db.Where("user_id = ? AND returned_at IS NOT NULL AND returned_at >= ?", userID, now.Add(-spendWindow)).Find(&records)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	var spend float64
+	for _, record := range records {
+		amount, _, err := currency.Convert(db, record.Total, record.Currency, currency.Base())
+		if err != nil {
+			return 0, err
+		}
+		spend += amount
+	}
+	return spend, nil
+}
+
+// TierFor returns the highest tier unlocked by the user's rolling spend, the
+// zero tier when none is, and the spend itself.
+func TierFor(db *gorm.DB, userID uint, now time.Time) (entity.LoyaltyTier, float64, error) {
+	spend, err := RollingSpend(db, userID, now)
+	if err != nil {
+		return entity.LoyaltyTier{}, 0, err
+	}
+	var tier entity.LoyaltyTier
+	result := db.Where("min_spend <= ?", spend).Order("min_spend DESC").Limit(1).Find(&tier)
+	return tier, spend, result.Error
+}
+
+// ApplyTier adds the tier discount and makes its free add-on free, when the
+// customer picked it.
+func ApplyTier(price *entity.PriceBreakdown, tier entity.LoyaltyTier) {
+	if tier.ID == 0 {
+		return
+	}
+	if tier.FreeAddOnID != nil {
+		for _, line := range price.AddOns {
+			if line.AddOnID == *tier.FreeAddOnID {
+				// one unit is free
+				amount := round(line.Amount / float64(line.Quantity))
+				price.Lines = append(price.Lines, entity.PriceLine{
+					Description: fmt.Sprintf("%s member free add-on", tier.Name),
+					Amount:      -amount,
+				})
+				price.Total = round(price.Total - amount)
+			}
+		}
+	}
+	if tier.DiscountPercent > 0 {
+		amount := round(price.Total * tier.DiscountPercent / 100)
+		price.Lines = append(price.Lines, entity.PriceLine{
+			Description: fmt.Sprintf("%s member discount (%.2f%%)", tier.Name, tier.DiscountPercent),
+			Amount:      -amount,
+		})
+		price.Total = round(price.Total - amount)
+	}
+}
+
+// ApplyPoints redeems up to points against the price total, never taking
+// the total below zero, and returns the points actually used.
+func ApplyPoints(db *gorm.DB, price *entity.PriceBreakdown, points uint) (uint, error) {
+	if points == 0 {
+		return 0, nil
+	}
+	pointValue, _, err := currency.Convert(db, PointValue(), currency.Base(), price.Currency)
+	if err != nil {
+		return 0, err
+	}
+	if pointValue <= 0 {
+		return 0, nil
+	}
+	if max := uint(math.Floor(price.Total / pointValue)); points > max {
+		points = max
+	}
+	amount := round(float64(points) * pointValue)
+	if points == 0 {
+		return 0, nil
+	}
+	price.Lines = append(price.Lines, entity.PriceLine{
+		Description: fmt.Sprintf("%d loyalty points", points),
+		Amount:      -amount,
+	})
+	price.Total = round(price.Total - amount)
+	price.PointsRedeemed = points
+	return points, nil
+}
+
+// Spend takes redeemed points from a user inside tx, failing when the user
+// no longer has enough.
+func Spend(tx *gorm.DB, userID, recordID uint, points uint) error {
+	if points == 0 {
+		return nil
+	}
+	result := tx.Model(&entity.User{}).Where("id = ? AND points >= ?", userID, points).Update("points", gorm.Expr("points - ?", points))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotEnoughPoints
+	}
+	return tx.Create(&entity.PointsEntry{UserID: userID, RecordID: recordID, Points: -int(points), Reason: "redeemed"}).Error
+}
+
+// Earn awards points for a completed rent inside tx, once per rent: the
+// entry is unique per rent, so a second call, even a concurrent one, awards
+// nothing.
+func Earn(tx *gorm.DB, record entity.Record) (int, error) {
+	amount, _, err := currency.Convert(tx, record.Total, record.Currency, currency.Base())
+	if err != nil {
+		return 0, err
+	}
+	points := int(math.Floor(amount / EarnUnit()))
+	if points <= 0 {
+		return 0, nil
+	}
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&entity.PointsEntry{UserID: record.UserID, RecordID: record.ID, Points: points, Reason: "earned"})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return 0, result.Error
+	}
+	result = tx.Model(&entity.User{}).Where("id = ?", record.UserID).Update("points", gorm.Expr("points + ?", points))
+	return points, result.Error
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// ValidateTier checks the fields of a tier set by an admin.
+func ValidateTier(tier entity.LoyaltyTier) error {
+	if tier.Name == "" {
+		return fmt.Errorf("tier needs a name")
+	}
+	if tier.MinSpend < 0 {
+		return fmt.Errorf("min_spend cannot be negative")
+	}
+	if tier.DiscountPercent < 0 || tier.DiscountPercent > 100 {
+		return fmt.Errorf("discount_percent must be between 0 and 100")
+	}
+	return nil
+}
+
+// NextTier returns the cheapest tier above the given spend, or the zero tier
+// when the user already has the highest one.
+func NextTier(db *gorm.DB, spend float64) (entity.LoyaltyTier, error) {
+	var tier entity.LoyaltyTier
+	result := db.Where("min_spend > ?", spend).Order("min_spend").Limit(1).Find(&tier)
+	return tier, result.Error
+}
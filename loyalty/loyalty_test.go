@@ -0,0 +1,207 @@
+package loyalty
+
+import (
+	"car-rental/entity"
+	"car-rental/events"
+	"car-rental/testdb"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestTierFor(t *testing.T) {
+	t.Setenv("BASE_CURRENCY", "IDR")
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	lastMonth := now.AddDate(0, -1, 0)
+	twoYearsAgo := now.AddDate(-2, 0, 0)
+	tests := []struct {
+		name    string
+		records []entity.Record
+		tier    string
+		next    string
+	}{
+		{"no rents", nil, "", "Silver"},
+		{"below silver", []entity.Record{{Total: 999999, ReturnedAt: &lastMonth}}, "", "Silver"},
+		{"silver", []entity.Record{{Total: 600000, ReturnedAt: &lastMonth}, {Total: 600000, ReturnedAt: &lastMonth}}, "Silver", "Gold"},
+		{"gold at the threshold", []entity.Record{{Total: 5000000, ReturnedAt: &lastMonth}}, "Gold", ""},
+		{"converted to the base currency", []entity.Record{{Total: 100, Currency: "USD", ReturnedAt: &lastMonth}}, "Silver", "Gold"},
+		{"old and ongoing rents do not count", []entity.Record{{Total: 5000000, ReturnedAt: &twoYearsAgo}, {Total: 5000000}}, "", "Silver"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := testdb.Open(t)
+			db.Create(&entity.ExchangeRate{Currency: "USD", Rate: 0.0001})
+			db.Create(&[]entity.LoyaltyTier{{Name: "Silver", MinSpend: 1000000}, {Name: "Gold", MinSpend: 5000000}})
+			for _, record := range test.records {
+				record.UserID = 1
+				db.Create(&record)
+			}
+			tier, spend, err := TierFor(db, 1, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tier.Name != test.tier {
+				t.Errorf("tier %q at a spend of %v, want %q", tier.Name, spend, test.tier)
+			}
+			next, err := NextTier(db, spend)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if next.Name != test.next {
+				t.Errorf("next tier %q, want %q", next.Name, test.next)
+			}
+		})
+	}
+}
+
+func TestApplyTier(t *testing.T) {
+	seat := uint(3)
+	price := entity.PriceBreakdown{
+		Total:  1000,
+		AddOns: []entity.PriceLine{{AddOnID: seat, Quantity: 2, Amount: 200}},
+	}
+	ApplyTier(&price, entity.LoyaltyTier{ID: 1, Name: "Gold", DiscountPercent: 10, FreeAddOnID: &seat})
+	// one seat of 100 is free, then 10% off the rest
+	if price.Total != 810 || len(price.Lines) != 2 || price.Lines[0].Amount != -100 || price.Lines[1].Amount != -90 {
+		t.Errorf("got %+v, want a total of 810", price)
+	}
+
+	price = entity.PriceBreakdown{Total: 1000}
+	ApplyTier(&price, entity.LoyaltyTier{})
+	if price.Total != 1000 || len(price.Lines) != 0 {
+		t.Errorf("no tier changed the price: %+v", price)
+	}
+}
+
+func TestApplyPoints(t *testing.T) {
+	t.Setenv("BASE_CURRENCY", "IDR")
+	t.Setenv("LOYALTY_POINT_VALUE", "100")
+	db := testdb.Open(t)
+	db.Create(&entity.ExchangeRate{Currency: "USD", Rate: 0.0001})
+	tests := []struct {
+		name     string
+		price    entity.PriceBreakdown
+		points   uint
+		used     uint
+		total    float64
+		currency string
+	}{
+		{"none", entity.PriceBreakdown{Total: 50000}, 0, 0, 50000, "IDR"},
+		{"part of the total", entity.PriceBreakdown{Total: 50000}, 100, 100, 40000, "IDR"},
+		{"capped at the total", entity.PriceBreakdown{Total: 50000}, 1000, 500, 0, "IDR"},
+		{"only whole points", entity.PriceBreakdown{Total: 150}, 5, 1, 50, "IDR"},
+		{"in the price currency", entity.PriceBreakdown{Total: 3, Currency: "USD"}, 1000, 300, 0, "USD"},
+	}
+	for _, test := range tests {
+		price := test.price
+		price.Currency = test.currency
+		used, err := ApplyPoints(db, &price, test.points)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if used != test.used || price.Total != test.total || price.PointsRedeemed != test.used {
+			t.Errorf("%s: used %d for a total of %v, want %d for %v", test.name, used, price.Total, test.used, test.total)
+		}
+	}
+}
+
+func TestSpend(t *testing.T) {
+	db := testdb.Open(t)
+	user := entity.User{Email: "ana@example.com", Points: 50}
+	db.Create(&user)
+	if err := Spend(db, user.ID, 1, 60); !errors.Is(err, ErrNotEnoughPoints) {
+		t.Errorf("spent more points than the user has: %v", err)
+	}
+	if err := Spend(db, user.ID, 1, 50); err != nil {
+		t.Fatal(err)
+	}
+	db.First(&user, user.ID)
+	if user.Points != 0 {
+		t.Errorf("user has %d points left, want 0", user.Points)
+	}
+}
+
+func TestEarnOnce(t *testing.T) {
+	t.Setenv("BASE_CURRENCY", "IDR")
+	t.Setenv("LOYALTY_EARN_UNIT", "10000")
+	db := testdb.Open(t)
+	db.Create(&entity.ExchangeRate{Currency: "USD", Rate: 0.0001})
+	user := entity.User{Email: "ana@example.com"}
+	db.Create(&user)
+	idr := entity.Record{UserID: user.ID, Total: 125000, Currency: "IDR"}
+	usd := entity.Record{UserID: user.ID, Total: 10, Currency: "USD"}
+	db.Create(&idr)
+	db.Create(&usd)
+
+	// a retry, or a second processor, runs Earn again for the same rent
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		for _, record := range []entity.Record{idr, usd} {
+			wg.Add(1)
+			go func(record entity.Record) {
+				defer wg.Done()
+				err := db.Transaction(func(tx *gorm.DB) error {
+					_, err := Earn(tx, record)
+					return err
+				})
+				if err != nil {
+					t.Error(err)
+				}
+			}(record)
+		}
+	}
+	wg.Wait()
+
+	db.First(&user, user.ID)
+	if user.Points != 22 {
+		t.Errorf("user has %d points, want 12 for the IDR rent and 10 for the USD one", user.Points)
+	}
+	var entries int64
+	db.Model(&entity.PointsEntry{}).Where("reason = ?", "earned").Count(&entries)
+	if entries != 2 {
+		t.Errorf("%d earned entries, want 2", entries)
+	}
+
+	points, err := Earn(db, idr)
+	if err != nil || points != 0 {
+		t.Errorf("earned %d again, %v", points, err)
+	}
+}
+
+func TestSubscribeAwardsOnce(t *testing.T) {
+	t.Setenv("BASE_CURRENCY", "IDR")
+	t.Setenv("LOYALTY_EARN_UNIT", "10000")
+	db := testdb.Open(t)
+	bus := events.NewBus(db)
+	Subscribe(bus)
+	user := entity.User{Email: "ana@example.com"}
+	db.Create(&user)
+	record := entity.Record{UserID: user.ID, Total: 125000, Currency: "IDR"}
+	db.Create(&record)
+
+	tx := db.Begin()
+	pending, err := bus.Stage(tx, events.RentalReturned{Record: record})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Commit()
+	bus.Flush(context.Background(), pending)
+
+	// the event is delivered again, as if it had never been marked done
+	db.Model(&entity.DomainEvent{}).Where("1 = 1").Updates(map[string]any{"processed_at": nil, "done": "[]"})
+	bus.Flush(context.Background(), pending)
+
+	db.First(&user, user.ID)
+	if user.Points != 12 {
+		t.Errorf("user has %d points, want 12", user.Points)
+	}
+	var row entity.DomainEvent
+	db.First(&row)
+	if row.ProcessedAt == nil || row.LastError != "" {
+		t.Errorf("event not processed: %+v", row)
+	}
+}
@@ -0,0 +1,16 @@
+package loyalty
+
+import (
+	"car-rental/events"
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// Subscribe awards points when a rent is returned.
+func Subscribe(bus *events.Bus) {
+	bus.Subscribe("loyalty", events.NameRentalReturned, func(ctx context.Context, tx *gorm.DB, id uint, e events.Event) error {
+		_, err := Earn(tx, e.(events.RentalReturned).Record)
+		return err
+	})
+}
@@ -4,6 +4,11 @@ import (
 	"car-rental/config"
 	"car-rental/handler"
 	"car-rental/middleware"
+	"car-rental/outbox"
+	"car-rental/pricing"
+	"car-rental/reminder"
+	"car-rental/webhook"
+	"context"
 	"log"
 
 	_ "car-rental/docs"
@@ -27,30 +32,152 @@ func main() {
 		log.Fatal(err)
 	}
 	db := config.ConnectDB()
-	uh := handler.UserHandler{DB: db}
-	ph := handler.ProductHandler{DB: db}
-	rh := handler.RentalHandler{DB: db}
+	bus := config.ConnectEvents(db)
+	uh := handler.UserHandler{DB: db, Events: bus}
+	ph := handler.ProductHandler{DB: db, Storage: config.ConnectStorage(), Events: bus}
+	rh := handler.RentalHandler{DB: db, Pricing: pricing.Service{DB: db}, Events: bus}
+	prh := handler.PricingHandler{DB: db}
+	poh := handler.PromoHandler{DB: db}
+	ah := handler.AddOnHandler{DB: db}
+	th := handler.TaxHandler{DB: db}
+	ch := handler.CurrencyHandler{DB: db}
+	lh := handler.LoyaltyHandler{DB: db}
+	gh := handler.GiftCardHandler{DB: db}
+	wh := handler.WithdrawalHandler{DB: db, Payouts: config.ConnectPayouts()}
+	oh := handler.OutboxHandler{DB: db}
+	eh := handler.EmailHandler{}
+	whh := handler.WebhookHandler{DB: db}
+	adh := handler.AuditHandler{DB: db}
+	rph := handler.ReportHandler{DB: db}
+
+	// deliver queued notifications in the background
+	go outbox.NewDispatcher(db, config.ConnectNotifier().Send).Run(context.Background())
+	// remind customers before their rents start and end
+	go reminder.NewScheduler(db).Run(context.Background())
+	// deliver partner webhooks
+	go webhook.NewDispatcher(db).Run(context.Background())
+	// retry domain events that could not be delivered after commit
+	go bus.Run(context.Background())
 
 	e := echo.New()
+	e.Use(middleware.RequestID)
 	e.GET("/swagger/*", echoSwagger.WrapHandler)
+	e.Static("/uploads", config.UploadDir())
 
 	u := e.Group("/users")
 	u.POST("/register", uh.RegisterUser)
 	u.POST("/login", uh.LoginUser)
 	u.POST("/topup", uh.TopUpDeposit, middleware.Auth)
+	u.GET("/wallet", uh.GetWallet, middleware.Auth)
+	u.GET("/me", uh.GetProfile, middleware.Auth)
+	u.GET("/notifications", uh.GetNotificationSettings, middleware.Auth)
+	u.PUT("/notifications", uh.SetNotificationSettings, middleware.Auth)
+	u.POST("/withdrawals", wh.RequestWithdrawal, middleware.Auth)
+	u.GET("/withdrawals", wh.ReadUserWithdrawals, middleware.Auth)
+	u.GET("/invoices", uh.ReadInvoices, middleware.Auth)
+	u.GET("/invoices/:number", uh.ReadInvoiceByNumber, middleware.Auth)
 	u.GET("/", uh.ReadAll, middleware.AuthAdmin)
 	u.GET("/:id", uh.ReadByID, middleware.AuthAdmin)
 
 	p := e.Group("/products")
 	p.GET("/", ph.ReadAll, middleware.Auth)
+	p.GET("/archived", ph.ReadArchived, middleware.AuthAdmin)
+	p.GET("/export", ph.ExportProducts, middleware.AuthAdmin)
+	p.POST("/import", ph.ImportProducts, middleware.AuthAdmin)
 	p.GET("/:id", ph.ReadByID, middleware.Auth)
 	p.POST("/", ph.CreateProduct, middleware.AuthAdmin)
 	p.PUT("/:id", ph.UpdateProductByID, middleware.AuthAdmin)
+	p.PATCH("/:id", ph.PatchProductByID, middleware.AuthAdmin)
 	p.DELETE("/:id", ph.DeleteProductByID, middleware.AuthAdmin)
+	p.POST("/:id/restore", ph.RestoreProductByID, middleware.AuthAdmin)
+	p.POST("/:id/images", ph.UploadProductImage, middleware.AuthAdmin)
+	p.DELETE("/:id/images/:imageID", ph.DeleteProductImage, middleware.AuthAdmin)
 
 	r := e.Group("/rent")
 	r.GET("/", rh.GetUserRents, middleware.Auth)
 	r.POST("/", rh.RentAProduct, middleware.Auth)
+	r.POST("/quote", rh.QuoteRent, middleware.Auth)
+	r.POST("/:id/return", rh.ReturnRent, middleware.AuthAdmin)
+	r.GET("/:id/invoice", rh.GetRentInvoice, middleware.Auth)
+	r.GET("/holds/policies", rh.ReadHoldPolicies, middleware.AuthAdmin)
+	r.PUT("/holds/policies/:category", rh.SetHoldPolicy, middleware.AuthAdmin)
+
+	pr := e.Group("/pricing")
+	pr.GET("/rules", prh.ReadAllRules, middleware.AuthAdmin)
+	pr.POST("/rules", prh.CreateRule, middleware.AuthAdmin)
+	pr.PUT("/rules/:id", prh.UpdateRule, middleware.AuthAdmin)
+	pr.DELETE("/rules/:id", prh.DeleteRule, middleware.AuthAdmin)
+
+	po := e.Group("/promos")
+	po.GET("/", poh.ReadAllPromos, middleware.AuthAdmin)
+	po.GET("/:id", poh.ReadPromoByID, middleware.AuthAdmin)
+	po.POST("/", poh.CreatePromo, middleware.AuthAdmin)
+	po.PUT("/:id", poh.UpdatePromo, middleware.AuthAdmin)
+	po.DELETE("/:id", poh.DeletePromo, middleware.AuthAdmin)
+
+	a := e.Group("/addons")
+	a.GET("/", ah.ReadAllAddOns, middleware.Auth)
+	a.POST("/", ah.CreateAddOn, middleware.AuthAdmin)
+	a.PUT("/:id", ah.UpdateAddOn, middleware.AuthAdmin)
+	a.DELETE("/:id", ah.DeleteAddOn, middleware.AuthAdmin)
+
+	t := e.Group("/tax")
+	t.GET("/rates", th.ReadAllTaxRates, middleware.AuthAdmin)
+	t.POST("/rates", th.CreateTaxRate, middleware.AuthAdmin)
+	t.PUT("/rates/:id", th.UpdateTaxRate, middleware.AuthAdmin)
+	t.DELETE("/rates/:id", th.DeleteTaxRate, middleware.AuthAdmin)
+	t.GET("/summary", th.TaxSummary, middleware.AuthAdmin)
+
+	cu := e.Group("/currencies")
+	cu.GET("/", ch.ReadRates, middleware.Auth)
+	cu.PUT("/rates", ch.SetRates, middleware.AuthAdmin)
+	cu.POST("/reload", ch.ReloadRates, middleware.AuthAdmin)
+
+	l := e.Group("/loyalty")
+	l.GET("/tiers", lh.ReadAllTiers, middleware.Auth)
+	l.POST("/tiers", lh.CreateTier, middleware.AuthAdmin)
+	l.PUT("/tiers/:id", lh.UpdateTier, middleware.AuthAdmin)
+	l.DELETE("/tiers/:id", lh.DeleteTier, middleware.AuthAdmin)
+
+	g := e.Group("/giftcards")
+	g.POST("/redeem", gh.RedeemGiftCard, middleware.Auth)
+	g.GET("/", gh.ReadAllGiftCards, middleware.AuthAdmin)
+	g.POST("/", gh.GenerateGiftCards, middleware.AuthAdmin)
+	g.GET("/report", gh.GiftCardReport, middleware.AuthAdmin)
+	g.POST("/:id/revoke", gh.RevokeGiftCard, middleware.AuthAdmin)
+
+	w := e.Group("/withdrawals")
+	w.GET("/", wh.ReadAllWithdrawals, middleware.AuthAdmin)
+	w.POST("/sync", wh.SyncWithdrawals, middleware.AuthAdmin)
+	w.POST("/:id/approve", wh.ApproveWithdrawal, middleware.AuthAdmin)
+	w.POST("/:id/reject", wh.RejectWithdrawal, middleware.AuthAdmin)
+
+	o := e.Group("/outbox")
+	o.GET("/", oh.ReadOutbox, middleware.AuthAdmin)
+	o.POST("/:id/retry", oh.RetryOutboxMessage, middleware.AuthAdmin)
+
+	em := e.Group("/emails")
+	em.GET("/templates", eh.ReadEmailTemplates, middleware.AuthAdmin)
+	em.GET("/templates/:name/preview", eh.PreviewEmailTemplate, middleware.AuthAdmin)
+
+	wb := e.Group("/webhooks")
+	wb.GET("/endpoints", whh.ReadAllWebhookEndpoints, middleware.AuthAdmin)
+	wb.POST("/endpoints", whh.CreateWebhookEndpoint, middleware.AuthAdmin)
+	wb.PUT("/endpoints/:id", whh.UpdateWebhookEndpoint, middleware.AuthAdmin)
+	wb.DELETE("/endpoints/:id", whh.DeleteWebhookEndpoint, middleware.AuthAdmin)
+	wb.GET("/deliveries", whh.ReadWebhookDeliveries, middleware.AuthAdmin)
+	wb.GET("/deliveries/:id", whh.ReadWebhookDelivery, middleware.AuthAdmin)
+	wb.POST("/deliveries/:id/replay", whh.ReplayWebhookDelivery, middleware.AuthAdmin)
+
+	rp := e.Group("/reports")
+	rp.GET("/revenue", rph.RevenueReport, middleware.AuthAdmin)
+	rp.GET("/utilization", rph.UtilizationReport, middleware.AuthAdmin)
+	rp.GET("/rental-length", rph.RentalLengthReport, middleware.AuthAdmin)
+	rp.GET("/top-customers", rph.TopCustomersReport, middleware.AuthAdmin)
+	rp.GET("/topups", rph.TopUpReport, middleware.AuthAdmin)
+
+	ad := e.Group("/admin")
+	ad.GET("/audit", adh.ReadAuditLog, middleware.AuthAdmin)
 
 	e.Logger.Fatal(e.Start(":8080"))
 }
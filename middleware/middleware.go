@@ -2,6 +2,8 @@ package middleware
 
 import (
 	"car-rental/utils"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"net/http"
 
@@ -61,3 +63,20 @@ func getSession(c echo.Context) *sessions.Session {
 	session, _ := utils.CookieStore.Get(c.Request(), "session-test")
 	return session
 }
+
+// RequestID tags every request with an ID, kept from the X-Request-ID
+// header when the client sends one, and echoes it in the response.
+func RequestID(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id := c.Request().Header.Get(echo.HeaderXRequestID)
+		if id == "" || len(id) > 64 {
+			b := make([]byte, 16)
+			if _, err := rand.Read(b); err != nil {
+				return err
+			}
+			id = hex.EncodeToString(b)
+		}
+		c.Response().Header().Set(echo.HeaderXRequestID, id)
+		return next(c)
+	}
+}
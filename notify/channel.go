@@ -0,0 +1,85 @@
+package notify
+
+import (
+	"bytes"
+	"car-rental/entity"
+	"car-rental/utils"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Channel delivers one queued notification.
+type Channel interface {
+	Send(ctx context.Context, msg entity.OutboxMessage) error
+}
+
+// EmailChannel sends through SMTP.
+type EmailChannel struct{}
+
+func (EmailChannel) Send(ctx context.Context, msg entity.OutboxMessage) error {
+	attachments := make([]utils.Attachment, 0, len(msg.Attachments))
+	for _, a := range msg.Attachments {
+		attachments = append(attachments, utils.Attachment{Name: a.Name, Data: a.Data})
+	}
+	return utils.SendEmail(msg.To, msg.Subject, msg.Text, msg.Body, attachments...)
+}
+
+// LogSMS writes text messages to the log instead of a gateway, for local
+// development.
+type LogSMS struct{}
+
+func (LogSMS) Send(ctx context.Context, msg entity.OutboxMessage) error {
+	log.Printf("sms to %s: %s", msg.To, msg.Text)
+	return nil
+}
+
+// WebhookChannel posts the JSON body to the user's webhook URL. Without a
+// Client it only connects to public addresses.
+type WebhookChannel struct {
+	Client *http.Client
+}
+
+var publicClient = utils.PublicClient(10 * time.Second)
+
+func (w WebhookChannel) Send(ctx context.Context, msg entity.OutboxMessage) error {
+	client := w.Client
+	if client == nil {
+		client = publicClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, msg.To, bytes.NewBufferString(msg.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event", msg.Event)
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %s", res.Status)
+	}
+	return nil
+}
+
+// FakeChannel keeps what it is asked to send, for tests.
+type FakeChannel struct {
+	mu   sync.Mutex
+	Sent []entity.OutboxMessage
+	Err  error // returned by every Send when set
+}
+
+func (f *FakeChannel) Send(ctx context.Context, msg entity.OutboxMessage) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return f.Err
+	}
+	f.Sent = append(f.Sent, msg)
+	return nil
+}
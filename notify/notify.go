@@ -0,0 +1,245 @@
+package notify
+
+import (
+	"car-rental/currency"
+	"car-rental/emails"
+	"car-rental/entity"
+	"car-rental/outbox"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Channels.
+const (
+	Email   = "email"
+	SMS     = "sms"
+	Webhook = "webhook"
+)
+
+// Events users can choose channels for.
+const (
+	BookingConfirmed   = "booking_confirmed"
+	TopUpReceived      = "topup_received"
+	LowBalance         = "low_balance"
+	RentalStartingSoon = "rental_starting_soon"
+	RentalEndingSoon   = "rental_ending_soon"
+)
+
+// Events maps each event to the template its messages are rendered from.
+var Events = map[string]string{
+	BookingConfirmed:   emails.RentalReceipt,
+	TopUpReceived:      emails.TopUp,
+	LowBalance:         emails.LowBalance,
+	RentalStartingSoon: emails.RentalStartingSoon,
+	RentalEndingSoon:   emails.RentalEndingSoon,
+}
+
+// Channels lists every channel, in the order they are shown.
+var Channels = []string{Email, SMS, Webhook}
+
+// phonePattern is an E.164 number, e.g. +6281234567890.
+var phonePattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// ValidatePhone checks a phone number for SMS, which must be in
+// international format.
+func ValidatePhone(phone string) error {
+	if !phonePattern.MatchString(phone) {
+		return fmt.Errorf("phone must be in international format, e.g. +6281234567890")
+	}
+	return nil
+}
+
+// defaults applies to events a user has not set a preference for: email
+// only.
+func defaults(channel string) bool {
+	return channel == Email
+}
+
+// Notifier routes queued messages to the channel they were queued for.
+type Notifier struct {
+	Channels map[string]Channel
+}
+
+// Send is the outbox dispatcher's send function.
+func (n Notifier) Send(ctx context.Context, msg entity.OutboxMessage) error {
+	channel := msg.Channel
+	if channel == "" {
+		channel = Email
+	}
+	ch, ok := n.Channels[channel]
+	if !ok {
+		return fmt.Errorf("no %s channel configured", channel)
+	}
+	return ch.Send(ctx, msg)
+}
+
+// Preferences returns the channels enabled for each event, with defaults
+// filled in.
+func Preferences(db *gorm.DB, userID uint) (map[string]map[string]bool, error) {
+	prefs := map[string]map[string]bool{}
+	for event := range Events {
+		prefs[event] = map[string]bool{}
+		for _, channel := range Channels {
+			prefs[event][channel] = defaults(channel)
+		}
+	}
+	var stored []entity.NotificationPreference
+	result := db.Where("user_id = ?", userID).Find(&stored)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	for _, p := range stored {
+		if prefs[p.Event] != nil {
+			prefs[p.Event][p.Channel] = p.Enabled
+		}
+	}
+	return prefs, nil
+}
+
+// SetPreferences stores the given event and channel switches, leaving the
+// others as they are.
+func SetPreferences(db *gorm.DB, userID uint, prefs map[string]map[string]bool) error {
+	for event, channels := range prefs {
+		if _, ok := Events[event]; !ok {
+			return fmt.Errorf("unknown event %s", event)
+		}
+		for channel, enabled := range channels {
+			if !known(channel) {
+				return fmt.Errorf("unknown channel %s", channel)
+			}
+			pref := entity.NotificationPreference{UserID: userID, Event: event, Channel: channel}
+			result := db.Where(pref).Assign(map[string]any{"enabled": enabled}).FirstOrCreate(&pref)
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+	}
+	return nil
+}
+
+func known(channel string) bool {
+	for _, c := range Channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// Notify queues an event for every channel the user enabled and has contact
+// details for, inside tx. Attachments only go out by email.
+func Notify(tx *gorm.DB, user entity.User, event string, data any, attachments ...entity.Attachment) error {
+	prefs, err := Preferences(tx, user.ID)
+	if err != nil {
+		return err
+	}
+	name, ok := Events[event]
+	if !ok {
+		return fmt.Errorf("unknown event %s", event)
+	}
+	var rendered *emails.Email
+	for _, channel := range Channels {
+		if !prefs[event][channel] {
+			continue
+		}
+		msg := entity.OutboxMessage{Channel: channel, Event: event}
+		switch channel {
+		case Email:
+			msg.To = user.Email
+		case SMS:
+			msg.To = user.Phone
+		case Webhook:
+			msg.To = user.WebhookURL
+		}
+		if msg.To == "" {
+			continue
+		}
+
+		if channel == Webhook {
+			body, err := json.Marshal(map[string]any{
+				"event":      event,
+				"user_id":    user.ID,
+				"created_at": time.Now(),
+				"data":       data,
+			})
+			if err != nil {
+				return err
+			}
+			msg.Body = string(body)
+		} else {
+			if rendered == nil {
+				email, err := emails.Render(name, user.Locale, data)
+				if err != nil {
+					return err
+				}
+				rendered = &email
+			}
+			msg.Subject = rendered.Subject
+			msg.Text = rendered.Text
+			if channel == Email {
+				msg.Body = rendered.HTML
+				msg.Attachments = attachments
+			} else {
+				msg.Text = rendered.SMS
+			}
+		}
+		if err := outbox.Enqueue(tx, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SendEmail queues an email that does not depend on preferences, such as
+// the welcome email.
+func SendEmail(tx *gorm.DB, user entity.User, name string, data any, attachments ...entity.Attachment) error {
+	email, err := emails.Render(name, user.Locale, data)
+	if err != nil {
+		return err
+	}
+	return outbox.Enqueue(tx, entity.OutboxMessage{
+		Channel:     Email,
+		To:          user.Email,
+		Subject:     email.Subject,
+		Text:        email.Text,
+		Body:        email.HTML,
+		Attachments: attachments,
+	})
+}
+
+// LowBalanceThreshold is the available balance, in the base currency, below
+// which users get a low_balance notification. It is set by
+// LOW_BALANCE_THRESHOLD.
+func LowBalanceThreshold() float64 {
+	v, err := strconv.ParseFloat(os.Getenv("LOW_BALANCE_THRESHOLD"), 64)
+	if err != nil || v < 0 {
+		return 100000
+	}
+	return v
+}
+
+// CheckBalance queues a low_balance notification when a charge took the
+// user's available balance below the threshold.
+func CheckBalance(tx *gorm.DB, user entity.User) error {
+	threshold, _, err := currency.Convert(tx, LowBalanceThreshold(), currency.Base(), user.Currency)
+	if err != nil {
+		return err
+	}
+	available := user.Deposit - user.Reserved
+	if available >= threshold {
+		return nil
+	}
+	return Notify(tx, user, LowBalance, emails.LowBalanceData{
+		Name:      user.Name,
+		Available: available,
+		Threshold: threshold,
+		Currency:  currency.Or(user.Currency),
+	})
+}
@@ -0,0 +1,118 @@
+package notify
+
+import (
+	"car-rental/emails"
+	"car-rental/entity"
+	"car-rental/outbox"
+	"car-rental/testdb"
+	"context"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// deliver queues event for user and dispatches the outbox to fake channels.
+func deliver(t *testing.T, db *gorm.DB, user entity.User, event string) map[string]*FakeChannel {
+	t.Helper()
+	data := emails.Samples[Events[event]]
+	if err := Notify(db, user, event, data); err != nil {
+		t.Fatal(err)
+	}
+	fakes := map[string]*FakeChannel{Email: {}, SMS: {}, Webhook: {}}
+	n := Notifier{Channels: map[string]Channel{}}
+	for channel, fake := range fakes {
+		n.Channels[channel] = fake
+	}
+	if _, err := outbox.NewDispatcher(db, n.Send).DispatchOnce(context.Background(), time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	return fakes
+}
+
+func TestNotifyDefaultsToEmail(t *testing.T) {
+	db := testdb.Open(t)
+	user := entity.User{Email: "jane@example.com", Phone: "+6281234567", WebhookURL: "https://hooks.example.com/jane"}
+	db.Create(&user)
+
+	fakes := deliver(t, db, user, BookingConfirmed)
+	if len(fakes[Email].Sent) != 1 || len(fakes[SMS].Sent) != 0 || len(fakes[Webhook].Sent) != 0 {
+		t.Fatalf("sent email %d, sms %d, webhook %d, want only one email",
+			len(fakes[Email].Sent), len(fakes[SMS].Sent), len(fakes[Webhook].Sent))
+	}
+	email := fakes[Email].Sent[0]
+	if email.To != user.Email || email.Subject == "" || email.Body == "" {
+		t.Errorf("email %+v not addressed to the user or not rendered", email)
+	}
+}
+
+func TestNotifyFollowsPreferences(t *testing.T) {
+	db := testdb.Open(t)
+	user := entity.User{Email: "jane@example.com", Phone: "+6281234567", WebhookURL: "https://hooks.example.com/jane"}
+	db.Create(&user)
+	err := SetPreferences(db, user.ID, map[string]map[string]bool{
+		BookingConfirmed: {Email: false, SMS: true, Webhook: true},
+		TopUpReceived:    {SMS: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fakes := deliver(t, db, user, BookingConfirmed)
+	if len(fakes[Email].Sent) != 0 || len(fakes[SMS].Sent) != 1 || len(fakes[Webhook].Sent) != 1 {
+		t.Fatalf("sent email %d, sms %d, webhook %d, want sms and webhook",
+			len(fakes[Email].Sent), len(fakes[SMS].Sent), len(fakes[Webhook].Sent))
+	}
+	if sms := fakes[SMS].Sent[0]; sms.To != user.Phone || sms.Text == "" {
+		t.Errorf("sms %+v", sms)
+	}
+	if hook := fakes[Webhook].Sent[0]; hook.To != user.WebhookURL || hook.Event != BookingConfirmed || hook.Body == "" {
+		t.Errorf("webhook %+v", hook)
+	}
+
+	// email stays on for an event where only sms was switched on
+	fakes = deliver(t, db, user, TopUpReceived)
+	if len(fakes[Email].Sent) != 1 || len(fakes[SMS].Sent) != 1 || len(fakes[Webhook].Sent) != 0 {
+		t.Errorf("sent email %d, sms %d, webhook %d, want email and sms",
+			len(fakes[Email].Sent), len(fakes[SMS].Sent), len(fakes[Webhook].Sent))
+	}
+}
+
+func TestNotifySkipsMissingContact(t *testing.T) {
+	db := testdb.Open(t)
+	user := entity.User{Email: "jane@example.com"}
+	db.Create(&user)
+	SetPreferences(db, user.ID, map[string]map[string]bool{LowBalance: {SMS: true, Webhook: true}})
+
+	fakes := deliver(t, db, user, LowBalance)
+	if len(fakes[Email].Sent) != 1 || len(fakes[SMS].Sent) != 0 || len(fakes[Webhook].Sent) != 0 {
+		t.Errorf("sent email %d, sms %d, webhook %d, want only email without a phone or webhook URL",
+			len(fakes[Email].Sent), len(fakes[SMS].Sent), len(fakes[Webhook].Sent))
+	}
+}
+
+func TestNotifierUnknownChannel(t *testing.T) {
+	n := Notifier{Channels: map[string]Channel{Email: &FakeChannel{}}}
+	if err := n.Send(context.Background(), entity.OutboxMessage{Channel: SMS}); err == nil {
+		t.Error("sending on an unconfigured channel succeeded")
+	}
+	if err := n.Send(context.Background(), entity.OutboxMessage{}); err != nil {
+		t.Errorf("message without a channel did not default to email: %v", err)
+	}
+}
+
+func TestValidatePhone(t *testing.T) {
+	for phone, valid := range map[string]bool{
+		"+6281234567890":     true,
+		"+14155550123":       true,
+		"081234567890":       false,
+		"+0812345678":        false,
+		"+62 812 3456 789":   false,
+		"+62812345678901234": false,
+		"":                   false,
+	} {
+		if err := ValidatePhone(phone); (err == nil) != valid {
+			t.Errorf("ValidatePhone(%q) = %v, want valid %v", phone, err, valid)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package notify
+
+import (
+	"car-rental/currency"
+	"car-rental/emails"
+	"car-rental/entity"
+	"car-rental/events"
+	"car-rental/invoice"
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// Subscribe queues the notifications announcing domain events.
+func Subscribe(bus *events.Bus) {
+	on := func(event string, fn func(tx *gorm.DB, e events.Event) error) {
+		bus.Subscribe("notify", event, func(ctx context.Context, tx *gorm.DB, id uint, e events.Event) error {
+			return fn(tx, e)
+		})
+	}
+	on(events.NameUserRegistered, func(tx *gorm.DB, e events.Event) error {
+		user := e.(events.UserRegistered).User
+		return SendEmail(tx, user, emails.Welcome, emails.WelcomeData{Name: user.Name})
+	})
+	on(events.NameRentalCreated, func(tx *gorm.DB, e events.Event) error {
+		created := e.(events.RentalCreated)
+		inv := created.Invoice
+		err := Notify(tx, created.User, BookingConfirmed, emails.RentalReceiptData{
+			Name:           created.User.Name,
+			Product:        created.Product.Name,
+			RentLength:     created.RentLength,
+			Price:          created.Price,
+			Deposit:        created.User.Deposit,
+			WalletCurrency: currency.Or(created.User.Currency),
+			Invoice:        inv.Number,
+		}, entity.Attachment{Name: inv.Number + ".pdf", Data: invoice.RenderPDF(inv)})
+		if err != nil {
+			return err
+		}
+		return CheckBalance(tx, created.User)
+	})
+	on(events.NameWalletToppedUp, func(tx *gorm.DB, e events.Event) error {
+		topUp := e.(events.WalletToppedUp)
+		inv := topUp.Invoice
+		return Notify(tx, topUp.User, TopUpReceived, emails.TopUpData{
+			Name:     topUp.User.Name,
+			Amount:   topUp.Amount,
+			Deposit:  topUp.User.Deposit,
+			Currency: currency.Or(topUp.User.Currency),
+			Invoice:  inv.Number,
+		}, entity.Attachment{Name: inv.Number + ".pdf", Data: invoice.RenderPDF(inv)})
+	})
+}
@@ -0,0 +1,171 @@
+package outbox
+
+import (
+	"car-rental/entity"
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	StatusPending = "pending"
+	StatusSending = "sending" // claimed by a dispatcher until next_attempt_at
+	StatusSent    = "sent"
+	StatusDead    = "dead" // gave up after MaxAttempts, retried by an admin
+)
+
+// Enqueue stores a notification inside tx, so it is only sent when the
+// business change it announces is committed.
+func Enqueue(tx *gorm.DB, msg entity.OutboxMessage) error {
+	msg.Status = StatusPending
+	msg.NextAttemptAt = time.Now()
+	return tx.Create(&msg).Error
+}
+
+// Dispatcher delivers pending outbox messages in the background, retrying
+// failures with exponential backoff and dead-lettering them after
+// MaxAttempts.
+type Dispatcher struct {
+	DB          *gorm.DB
+	Send        func(context.Context, entity.OutboxMessage) error
+	Interval    time.Duration // how often to look for due messages
+	BatchSize   int
+	MaxAttempts int
+	BaseDelay   time.Duration // first retry delay, doubled on every attempt
+	MaxDelay    time.Duration
+	Lease       time.Duration // how long a claimed batch is reserved for its dispatcher
+}
+
+// NewDispatcher reads OUTBOX_INTERVAL, OUTBOX_MAX_ATTEMPTS and
+// OUTBOX_RETRY_DELAY, falling back to sensible defaults.
+func NewDispatcher(db *gorm.DB, send func(context.Context, entity.OutboxMessage) error) Dispatcher {
+	d := Dispatcher{
+		DB:          db,
+		Send:        send,
+		Interval:    5 * time.Second,
+		BatchSize:   20,
+		MaxAttempts: 8,
+		BaseDelay:   30 * time.Second,
+		MaxDelay:    6 * time.Hour,
+		Lease:       5 * time.Minute,
+	}
+	if v, err := time.ParseDuration(os.Getenv("OUTBOX_INTERVAL")); err == nil && v > 0 {
+		d.Interval = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("OUTBOX_MAX_ATTEMPTS")); err == nil && v > 0 {
+		d.MaxAttempts = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("OUTBOX_RETRY_DELAY")); err == nil && v > 0 {
+		d.BaseDelay = v
+	}
+	return d
+}
+
+// Run dispatches due messages every Interval until ctx is cancelled.
+func (d Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := d.DispatchOnce(ctx, time.Now())
+			if err != nil {
+				log.Printf("outbox: %v", err)
+			}
+			if err != nil || n < d.BatchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchOnce sends one batch of due messages and returns how many it
+// tried. The batch is first claimed for Lease in a short transaction, with
+// SKIP LOCKED so several instances can run side by side. Messages are then
+// sent outside any transaction and each outcome is recorded on its own, so
+// one failed update cannot resend the rest of the batch. Messages of a
+// dispatcher that died while sending are claimed again once the lease ends.
+func (d Dispatcher) DispatchOnce(ctx context.Context, now time.Time) (int, error) {
+	msgs, err := d.claim(now)
+	if err != nil {
+		return 0, err
+	}
+	for _, msg := range msgs {
+		updates := d.attempt(ctx, msg)
+		result := d.DB.Model(&entity.OutboxMessage{}).Where("id = ? AND status = ?", msg.ID, StatusSending).Updates(updates)
+		if result.Error != nil {
+			log.Printf("outbox: recording message %d: %v", msg.ID, result.Error)
+		}
+	}
+	return len(msgs), nil
+}
+
+// claim reserves a batch of due messages by marking them as sending until
+// the lease ends.
+func (d Dispatcher) claim(now time.Time) ([]entity.OutboxMessage, error) {
+	var msgs []entity.OutboxMessage
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status IN ? AND next_attempt_at <= ?", []string{StatusPending, StatusSending}, now).
+			Order("next_attempt_at, id").
+			Limit(d.BatchSize).
+			Find(&msgs)
+		if result.Error != nil || len(msgs) == 0 {
+			return result.Error
+		}
+		ids := make([]uint, len(msgs))
+		for i, msg := range msgs {
+			ids[i] = msg.ID
+		}
+		return tx.Model(&entity.OutboxMessage{}).Where("id IN ?", ids).
+			Updates(map[string]any{"status": StatusSending, "next_attempt_at": now.Add(d.Lease)}).Error
+	})
+	return msgs, err
+}
+
+// attempt sends msg and returns the columns recording the outcome.
+func (d Dispatcher) attempt(ctx context.Context, msg entity.OutboxMessage) map[string]any {
+	attempts := msg.Attempts + 1
+	err := d.Send(ctx, msg)
+	now := time.Now()
+	if err == nil {
+		return map[string]any{"status": StatusSent, "attempts": attempts, "sent_at": now, "last_error": ""}
+	}
+	updates := map[string]any{"attempts": attempts, "last_error": err.Error()}
+	if attempts >= d.MaxAttempts {
+		updates["status"] = StatusDead
+		log.Printf("outbox: message %d dead after %d attempts: %v", msg.ID, attempts, err)
+		return updates
+	}
+	updates["status"] = StatusPending
+	updates["next_attempt_at"] = now.Add(d.backoff(attempts))
+	return updates
+}
+
+func (d Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.BaseDelay
+	for i := 1; i < attempts && delay < d.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxDelay {
+		delay = d.MaxDelay
+	}
+	return delay
+}
+
+// Retry puts a dead message back in the queue with a fresh attempt count.
+func Retry(db *gorm.DB, id uint) (bool, error) {
+	result := db.Model(&entity.OutboxMessage{}).
+		Where("id = ? AND status = ?", id, StatusDead).
+		Updates(map[string]any{"status": StatusPending, "attempts": 0, "next_attempt_at": time.Now()})
+	return result.RowsAffected > 0, result.Error
+}
@@ -0,0 +1,64 @@
+package outbox
+
+import (
+	"car-rental/entity"
+	"car-rental/testdb"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDispatchOnce(t *testing.T) {
+	db := testdb.Open(t)
+	now := time.Now()
+	msgs := []entity.OutboxMessage{
+		{To: "ok@example.com", Status: StatusPending, NextAttemptAt: now.Add(-time.Minute)},
+		{To: "down@example.com", Status: StatusPending, NextAttemptAt: now.Add(-time.Minute)},
+		{To: "later@example.com", Status: StatusPending, NextAttemptAt: now.Add(time.Hour)},
+		// claimed by a dispatcher that died, its lease has ended
+		{To: "stale@example.com", Status: StatusSending, NextAttemptAt: now.Add(-time.Second)},
+		// claimed by a dispatcher that is still sending
+		{To: "busy@example.com", Status: StatusSending, NextAttemptAt: now.Add(time.Minute)},
+	}
+	db.Create(&msgs)
+
+	var sent []string
+	d := NewDispatcher(db, func(ctx context.Context, msg entity.OutboxMessage) error {
+		// the claim is committed before anything is sent
+		var stored entity.OutboxMessage
+		db.First(&stored, msg.ID)
+		if stored.Status != StatusSending {
+			t.Errorf("%s sent while %s", msg.To, stored.Status)
+		}
+		if msg.To == "down@example.com" {
+			return errors.New("connection refused")
+		}
+		sent = append(sent, msg.To)
+		return nil
+	})
+	n, err := d.DispatchOnce(context.Background(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 || len(sent) != 2 {
+		t.Errorf("tried %d and sent %v, want 3 tried and 2 sent", n, sent)
+	}
+
+	want := map[string]string{
+		"ok@example.com":    StatusSent,
+		"down@example.com":  StatusPending,
+		"later@example.com": StatusPending,
+		"stale@example.com": StatusSent,
+		"busy@example.com":  StatusSending,
+	}
+	db.Find(&msgs)
+	for _, msg := range msgs {
+		if msg.Status != want[msg.To] {
+			t.Errorf("%s is %s, want %s", msg.To, msg.Status, want[msg.To])
+		}
+		if msg.To == "down@example.com" && (msg.Attempts != 1 || !msg.NextAttemptAt.After(now) || msg.LastError == "") {
+			t.Errorf("failed message not scheduled for a retry: %+v", msg)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package payout
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeProvider accepts every payout and settles it after Delay. Payouts to a
+// destination containing "fail" fail instead, to try the failure path.
+type FakeProvider struct {
+	Delay time.Duration
+
+	mu      sync.Mutex
+	payouts map[string]fakePayout
+}
+
+type fakePayout struct {
+	req  Request
+	sent time.Time
+}
+
+func (p *FakeProvider) Send(ctx context.Context, req Request) (Result, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.payouts == nil {
+		p.payouts = map[string]fakePayout{}
+	}
+	ref := fmt.Sprintf("fake_%d", req.ID)
+	if _, ok := p.payouts[ref]; !ok {
+		p.payouts[ref] = fakePayout{req: req, sent: time.Now()}
+	}
+	return p.result(ref), nil
+}
+
+func (p *FakeProvider) Status(ctx context.Context, reference string) (Result, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.payouts[reference]; !ok {
+		return Result{}, fmt.Errorf("unknown payout %s", reference)
+	}
+	return p.result(reference), nil
+}
+
+func (p *FakeProvider) result(ref string) Result {
+	payout := p.payouts[ref]
+	res := Result{Reference: ref, Status: StatusPending}
+	if strings.Contains(payout.req.Destination, "fail") {
+		res.Status = StatusFailed
+		res.Reason = "destination rejected the payout"
+	} else if settle := payout.sent.Add(p.Delay); !time.Now().Before(settle) {
+		res.Status = StatusSettled
+		res.SettledAt = settle
+	}
+	return res
+}
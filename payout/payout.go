@@ -0,0 +1,34 @@
+package payout
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	StatusPending = "pending"
+	StatusSettled = "settled"
+	StatusFailed  = "failed"
+)
+
+// Request is money sent out to a customer's account.
+type Request struct {
+	ID          uint // withdrawal ID, used as idempotency key
+	Amount      float64
+	Currency    string
+	Destination string
+}
+
+// Result is what a provider knows about a payout.
+type Result struct {
+	Reference string
+	Status    string // pending,settled,failed
+	Reason    string
+	SettledAt time.Time
+}
+
+// Provider sends payouts and reports whether they settled.
+type Provider interface {
+	Send(ctx context.Context, req Request) (Result, error)
+	Status(ctx context.Context, reference string) (Result, error)
+}
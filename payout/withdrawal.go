@@ -0,0 +1,232 @@
+package payout
+
+import (
+	"car-rental/audit"
+	"car-rental/currency"
+	"car-rental/entity"
+	"car-rental/pricing"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Withdrawal statuses. Requested withdrawals reserve the amount in the
+// wallet, processing ones have left the deposit and wait for the payout.
+const (
+	WithdrawalRequested  = "requested"
+	WithdrawalRejected   = "rejected"
+	WithdrawalProcessing = "processing"
+	WithdrawalSettled    = "settled"
+	WithdrawalFailed     = "failed"
+)
+
+var (
+	ErrNotEnoughBalance = errors.New("not enough available balance")
+	ErrAlreadyDecided   = errors.New("withdrawal is already decided")
+)
+
+// RequestWithdrawal reserves amount of the user's available balance for a
+// withdrawal. An amount of zero withdraws the whole available balance.
+func RequestWithdrawal(db *gorm.DB, actor audit.Actor, user entity.User, amount float64, destination string) (entity.Withdrawal, error) {
+	w := entity.Withdrawal{
+		UserID:      user.ID,
+		Currency:    currency.Or(user.Currency),
+		Destination: destination,
+		Status:      WithdrawalRequested,
+	}
+	if destination == "" {
+		return w, fmt.Errorf("destination account is required")
+	}
+	if amount < 0 {
+		return w, fmt.Errorf("amount cannot be negative")
+	}
+	if user.Owed > 0 {
+		return w, pricing.ErrFeesOwed
+	}
+	if amount == 0 {
+		amount = user.Deposit - user.Reserved
+	}
+	w.Amount = math.Round(amount*100) / 100
+	if w.Amount <= 0 {
+		return w, ErrNotEnoughBalance
+	}
+
+	err := audited(db, actor, user.ID, func(tx *gorm.DB) error {
+		result := tx.Model(&entity.User{}).
+			Where("id = ? AND deposit - reserved >= ? AND owed <= 0", user.ID, w.Amount).
+			Update("reserved", gorm.Expr("reserved + ?", w.Amount))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotEnoughBalance
+		}
+		return tx.Create(&w).Error
+	})
+	return w, err
+}
+
+// Reject gives the reserved amount of a requested withdrawal back.
+func Reject(db *gorm.DB, w *entity.Withdrawal, actor audit.Actor, reason string, now time.Time) error {
+	return audited(db, actor, w.UserID, func(tx *gorm.DB) error {
+		if err := decide(tx, w, WithdrawalRejected, actor.UserID, reason, now); err != nil {
+			return err
+		}
+		return tx.Model(&entity.User{}).Where("id = ?", w.UserID).
+			Update("reserved", gorm.Expr("reserved - ?", w.Amount)).Error
+	})
+}
+
+// Approve takes the amount out of the deposit, records it as a pending
+// ledger entry and sends the payout.
+func Approve(ctx context.Context, db *gorm.DB, provider Provider, w *entity.Withdrawal, actor audit.Actor, now time.Time) error {
+	err := audited(db, actor, w.UserID, func(tx *gorm.DB) error {
+		if err := decide(tx, w, WithdrawalProcessing, actor.UserID, "", now); err != nil {
+			return err
+		}
+		result := tx.Model(&entity.User{}).Where("id = ?", w.UserID).Updates(map[string]any{
+			"deposit":  gorm.Expr("deposit - ?", w.Amount),
+			"reserved": gorm.Expr("reserved - ?", w.Amount),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		entry := entity.LedgerEntry{
+			UserID:           w.UserID,
+			Type:             "withdrawal",
+			Status:           StatusPending,
+			Amount:           -w.Amount,
+			Currency:         w.Currency,
+			OriginalAmount:   -w.Amount,
+			OriginalCurrency: w.Currency,
+			ExchangeRate:     1,
+		}
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+		w.LedgerEntryID = &entry.ID
+		return tx.Model(w).Update("ledger_entry_id", entry.ID).Error
+	})
+	if err != nil {
+		return err
+	}
+	return Sync(ctx, db, provider, w, actor)
+}
+
+// decide moves a requested withdrawal to status, failing when another admin
+// decided it first.
+func decide(tx *gorm.DB, w *entity.Withdrawal, status string, adminID *uint, reason string, now time.Time) error {
+	result := tx.Model(&entity.Withdrawal{}).
+		Where("id = ? AND status = ?", w.ID, WithdrawalRequested).
+		Updates(map[string]any{"status": status, "reason": reason, "decided_by": adminID, "decided_at": now})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAlreadyDecided
+	}
+	w.Status = status
+	w.Reason = reason
+	w.DecidedBy = adminID
+	w.DecidedAt = &now
+	return nil
+}
+
+// Sync sends a processing withdrawal that has no payout yet, or asks the
+// provider about the one it has, and settles or reverses it.
+func Sync(ctx context.Context, db *gorm.DB, provider Provider, w *entity.Withdrawal, actor audit.Actor) error {
+	if w.Status != WithdrawalProcessing {
+		return nil
+	}
+	var res Result
+	var err error
+	if w.Reference == "" {
+		res, err = provider.Send(ctx, Request{ID: w.ID, Amount: w.Amount, Currency: w.Currency, Destination: w.Destination})
+	} else {
+		res, err = provider.Status(ctx, w.Reference)
+	}
+	if err != nil {
+		return err
+	}
+	if res.Reference != w.Reference {
+		w.Reference = res.Reference
+		if err := db.Model(w).Update("reference", res.Reference).Error; err != nil {
+			return err
+		}
+	}
+
+	switch res.Status {
+	case StatusSettled:
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := finish(tx, w, WithdrawalSettled, "", res.SettledAt); err != nil {
+				return err
+			}
+			return tx.Model(&entity.LedgerEntry{}).Where("id = ?", w.LedgerEntryID).Update("status", StatusSettled).Error
+		})
+	case StatusFailed:
+		err = audited(db, actor, w.UserID, func(tx *gorm.DB) error {
+			if err := finish(tx, w, WithdrawalFailed, res.Reason, time.Now()); err != nil {
+				return err
+			}
+			if err := tx.Model(&entity.LedgerEntry{}).Where("id = ?", w.LedgerEntryID).Update("status", StatusFailed).Error; err != nil {
+				return err
+			}
+			// the money never left, put it back in the deposit
+			result := tx.Model(&entity.User{}).Where("id = ?", w.UserID).Update("deposit", gorm.Expr("deposit + ?", w.Amount))
+			if result.Error != nil {
+				return result.Error
+			}
+			return tx.Create(&entity.LedgerEntry{
+				UserID:           w.UserID,
+				Type:             "withdrawal_reversal",
+				Amount:           w.Amount,
+				Currency:         w.Currency,
+				OriginalAmount:   w.Amount,
+				OriginalCurrency: w.Currency,
+				ExchangeRate:     1,
+			}).Error
+		})
+	}
+	if errors.Is(err, errFinished) {
+		return nil
+	}
+	return err
+}
+
+// audited runs fn in a transaction and logs how it changed the user's wallet.
+func audited(db *gorm.DB, actor audit.Actor, userID uint, fn func(tx *gorm.DB) error) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		wallets, err := audit.SnapshotWallets(tx, userID)
+		if err != nil {
+			return err
+		}
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return wallets.Log(tx, actor)
+	})
+}
+
+var errFinished = errors.New("withdrawal is already finished")
+
+// finish moves a processing withdrawal to its final status once.
+func finish(tx *gorm.DB, w *entity.Withdrawal, status, reason string, at time.Time) error {
+	result := tx.Model(&entity.Withdrawal{}).
+		Where("id = ? AND status = ?", w.ID, WithdrawalProcessing).
+		Updates(map[string]any{"status": status, "reason": reason, "settled_at": at})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		// a concurrent sync finished it first
+		return errFinished
+	}
+	w.Status = status
+	w.Reason = reason
+	w.SettledAt = &at
+	return nil
+}
@@ -0,0 +1,151 @@
+package payout
+
+import (
+	"car-rental/audit"
+	"car-rental/entity"
+	"car-rental/testdb"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func newWithdrawal(t *testing.T, db *gorm.DB, destination string) (entity.User, entity.Withdrawal) {
+	t.Helper()
+	user := entity.User{Email: "bob@example.com", Deposit: 100}
+	db.Create(&user)
+	w, err := RequestWithdrawal(db, audit.Actor{UserID: &user.ID}, user, 40, destination)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user, w
+}
+
+func ledger(db *gorm.DB, userID uint) []entity.LedgerEntry {
+	var entries []entity.LedgerEntry
+	db.Where("user_id = ?", userID).Order("id").Find(&entries)
+	return entries
+}
+
+func TestApproveSettles(t *testing.T) {
+	db := testdb.Open(t)
+	ctx := context.Background()
+	provider := &FakeProvider{Delay: time.Hour}
+	user, w := newWithdrawal(t, db, "NL00BANK0123456789")
+
+	if err := Approve(ctx, db, provider, &w, audit.Actor{Role: "admin"}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if w.Status != WithdrawalProcessing || w.Reference == "" {
+		t.Fatalf("status %s reference %q, want processing with a reference", w.Status, w.Reference)
+	}
+	db.First(&user, user.ID)
+	if user.Deposit != 60 || user.Reserved != 0 {
+		t.Errorf("deposit %.2f reserved %.2f, want 60 and 0", user.Deposit, user.Reserved)
+	}
+	entries := ledger(db, user.ID)
+	if len(entries) != 1 || entries[0].Type != "withdrawal" || entries[0].Status != StatusPending || entries[0].Amount != -40 {
+		t.Fatalf("ledger %+v, want one pending withdrawal of -40", entries)
+	}
+
+	// still pending at the provider
+	if err := Sync(ctx, db, provider, &w, audit.Actor{}); err != nil {
+		t.Fatal(err)
+	}
+	if w.Status != WithdrawalProcessing {
+		t.Errorf("status %s before the payout settled", w.Status)
+	}
+
+	provider.Delay = 0
+	if err := Sync(ctx, db, provider, &w, audit.Actor{}); err != nil {
+		t.Fatal(err)
+	}
+	db.First(&w, w.ID)
+	if w.Status != WithdrawalSettled || w.SettledAt == nil {
+		t.Errorf("status %s, want settled", w.Status)
+	}
+	entries = ledger(db, user.ID)
+	if len(entries) != 1 || entries[0].Status != StatusSettled {
+		t.Errorf("ledger %+v, want the withdrawal settled", entries)
+	}
+}
+
+func TestApproveFailureReverses(t *testing.T) {
+	db := testdb.Open(t)
+	provider := &FakeProvider{}
+	user, w := newWithdrawal(t, db, "fail-account")
+
+	if err := Approve(context.Background(), db, provider, &w, audit.Actor{Role: "admin"}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	db.First(&w, w.ID)
+	if w.Status != WithdrawalFailed || w.Reason == "" {
+		t.Errorf("status %s reason %q, want failed with a reason", w.Status, w.Reason)
+	}
+	db.First(&user, user.ID)
+	if user.Deposit != 100 || user.Reserved != 0 {
+		t.Errorf("deposit %.2f reserved %.2f, want 100 and 0", user.Deposit, user.Reserved)
+	}
+	entries := ledger(db, user.ID)
+	if len(entries) != 2 || entries[0].Status != StatusFailed ||
+		entries[1].Type != "withdrawal_reversal" || entries[1].Amount != 40 {
+		t.Errorf("ledger %+v, want a failed withdrawal and its reversal", entries)
+	}
+}
+
+func TestDecideOnce(t *testing.T) {
+	db := testdb.Open(t)
+	ctx := context.Background()
+	provider := &FakeProvider{Delay: time.Hour}
+	user, w := newWithdrawal(t, db, "NL00BANK0123456789")
+
+	// two admins decide at the same time, only one of them wins
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	approved, rejected := w, w
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		errs[0] = Approve(ctx, db, provider, &approved, audit.Actor{Role: "admin"}, time.Now())
+	}()
+	go func() {
+		defer wg.Done()
+		errs[1] = Reject(db, &rejected, audit.Actor{Role: "admin"}, "suspicious", time.Now())
+	}()
+	wg.Wait()
+
+	decided := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			decided++
+		case !errors.Is(err, ErrAlreadyDecided):
+			t.Fatal(err)
+		}
+	}
+	if decided != 1 {
+		t.Fatalf("decided %d times, want once", decided)
+	}
+
+	// deciding again fails either way
+	again := w
+	if err := Reject(db, &again, audit.Actor{Role: "admin"}, "late", time.Now()); !errors.Is(err, ErrAlreadyDecided) {
+		t.Errorf("second reject: got %v, want ErrAlreadyDecided", err)
+	}
+	again = w
+	if err := Approve(ctx, db, provider, &again, audit.Actor{Role: "admin"}, time.Now()); !errors.Is(err, ErrAlreadyDecided) {
+		t.Errorf("second approve: got %v, want ErrAlreadyDecided", err)
+	}
+
+	// the reservation was released exactly once
+	db.First(&user, user.ID)
+	if user.Reserved != 0 {
+		t.Errorf("reserved %.2f, want 0", user.Reserved)
+	}
+	if errs[0] == nil && user.Deposit != 60 || errs[1] == nil && user.Deposit != 100 {
+		t.Errorf("deposit %.2f does not match the decision", user.Deposit)
+	}
+}
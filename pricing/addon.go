@@ -0,0 +1,145 @@
+package pricing
+
+import (
+	"car-rental/currency"
+	"car-rental/entity"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	AddOnPerDay    = "per_day"
+	AddOnPerRental = "per_rental"
+)
+
+var ErrAddOnOutOfStock = errors.New("add-on is out of stock")
+
+// ValidateAddOn checks the fields of an add-on set by an admin.
+func ValidateAddOn(addOn entity.AddOn) error {
+	if addOn.Name == "" {
+		return fmt.Errorf("add-on needs a name")
+	}
+	if addOn.PricingType != AddOnPerDay && addOn.PricingType != AddOnPerRental {
+		return fmt.Errorf("unknown pricing type %q, use per_day or per_rental", addOn.PricingType)
+	}
+	if addOn.Price < 0 {
+		return fmt.Errorf("price cannot be negative")
+	}
+	if addOn.Stock != nil && *addOn.Stock < 0 {
+		return fmt.Errorf("stock cannot be negative")
+	}
+	return nil
+}
+
+// MergeAddOns merges duplicate selections and defaults the quantity to 1.
+func MergeAddOns(selected []entity.RentAddOn) []entity.RentAddOn {
+	var merged []entity.RentAddOn
+	index := map[uint]int{}
+	for _, s := range selected {
+		if s.Quantity == 0 {
+			s.Quantity = 1
+		}
+		if i, ok := index[s.AddOnID]; ok {
+			merged[i].Quantity += s.Quantity
+			continue
+		}
+		index[s.AddOnID] = len(merged)
+		merged = append(merged, s)
+	}
+	return merged
+}
+
+// ApplyAddOns adds a price line per selected add-on of a rent starting at
+// start and raises the total. Stock is only checked here, it is reserved by
+// ReserveAddOns.
+func (s Service) ApplyAddOns(price *entity.PriceBreakdown, selected []entity.RentAddOn, start, now time.Time) error {
+	end := start.AddDate(0, 0, int(price.RentLength))
+	for _, sel := range MergeAddOns(selected) {
+		var addOn entity.AddOn
+		result := s.DB.Where("id = ? AND disabled = ?", sel.AddOnID, false).First(&addOn)
+		if result.Error != nil {
+			return fmt.Errorf("add-on %d not found", sel.AddOnID)
+		}
+		if addOn.Stock != nil {
+			inUse, err := addOnsInUse(s.DB, addOn.ID, start, end, now)
+			if err != nil {
+				return err
+			}
+			if inUse+int(sel.Quantity) > *addOn.Stock {
+				return fmt.Errorf("%w: %s", ErrAddOnOutOfStock, addOn.Name)
+			}
+		}
+
+		// add-on prices are set in the base currency
+		unitPrice, _, err := currency.Convert(s.DB, addOn.Price, currency.Base(), price.Currency)
+		if err != nil {
+			return err
+		}
+		amount := unitPrice * float64(sel.Quantity)
+		if addOn.PricingType == AddOnPerDay {
+			amount *= float64(price.RentLength)
+		}
+		amount = round(amount)
+		price.AddOns = append(price.AddOns, entity.PriceLine{
+			Description: fmt.Sprintf("%s x%d", addOn.Name, sel.Quantity),
+			AddOnID:     addOn.ID,
+			Quantity:    sel.Quantity,
+			Amount:      amount,
+		})
+		price.Total = round(price.Total + amount)
+	}
+	return nil
+}
+
+// ReserveAddOns stores the add-on lines of price on the record inside tx.
+// Add-on rows with limited stock are locked while their use is counted, so
+// concurrent rents cannot take more units than exist.
+func ReserveAddOns(tx *gorm.DB, price entity.PriceBreakdown, record entity.Record, now time.Time) error {
+	for _, line := range price.AddOns {
+		var addOn entity.AddOn
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", line.AddOnID).First(&addOn)
+		if result.Error != nil {
+			return result.Error
+		}
+		if addOn.Stock != nil {
+			inUse, err := addOnsInUse(tx, addOn.ID, record.StartDate, record.EndDate, now)
+			if err != nil {
+				return err
+			}
+			if inUse+int(line.Quantity) > *addOn.Stock {
+				return fmt.Errorf("%w: %s", ErrAddOnOutOfStock, addOn.Name)
+			}
+		}
+		// the line is priced in the record currency, addOn.Price in the base one
+		result = tx.Create(&entity.RecordAddOn{
+			RecordID:  record.ID,
+			AddOnID:   addOn.ID,
+			Name:      addOn.Name,
+			Quantity:  line.Quantity,
+			UnitPrice: round(line.Amount / float64(line.Quantity)),
+			Amount:    line.Amount,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+	}
+	return nil
+}
+
+// addOnsInUse counts the units of an add-on on unreturned rents overlapping
+// the period from start to end. Overdue rents keep their units until they
+// are returned.
+func addOnsInUse(db *gorm.DB, addOnID uint, start, end, now time.Time) (int, error) {
+	var inUse int
+	result := db.Table("record_add_ons").
+		Joins("JOIN records ON records.id = record_add_ons.record_id").
+		Where("record_add_ons.add_on_id = ? AND records.returned_at IS NULL", addOnID).
+		Where("records.start_date < ? AND (records.end_date > ? OR records.end_date < ?)", end, start, now).
+		Select("COALESCE(SUM(record_add_ons.quantity), 0)").
+		Scan(&inUse)
+	return inUse, result.Error
+}
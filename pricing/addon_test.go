@@ -0,0 +1,78 @@
+package pricing
+
+import (
+	"car-rental/entity"
+	"car-rental/testdb"
+	"testing"
+	"time"
+)
+
+func TestAddOnsInUse(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	returned := now.Add(-day)
+	tests := []struct {
+		name       string
+		start, end time.Time
+		returnedAt *time.Time
+		counted    bool
+	}{
+		{"ongoing", now.Add(-day), now.Add(day), nil, true},
+		{"ongoing but returned early", now.Add(-2 * day), now.Add(day), &returned, false},
+		{"overdue", now.Add(-3 * day), now.Add(-day), nil, true},
+		{"ended and returned", now.Add(-3 * day), now.Add(-day), &returned, false},
+		{"booked inside the period", now.Add(2 * day), now.Add(3 * day), nil, true},
+		{"booked after the period", now.Add(5 * day), now.Add(6 * day), nil, false},
+		{"booked right at the end", now.Add(4 * day), now.Add(6 * day), nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := testdb.Open(t)
+			record := entity.Record{StartDate: test.start, EndDate: test.end, ReturnedAt: test.returnedAt}
+			db.Create(&record)
+			db.Create(&entity.RecordAddOn{RecordID: record.ID, AddOnID: 1, Quantity: 2})
+
+			// the new rent runs for four days from now
+			inUse, err := addOnsInUse(db, 1, now, now.Add(4*day), now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := 0
+			if test.counted {
+				want = 2
+			}
+			if inUse != want {
+				t.Errorf("in use %d, want %d", inUse, want)
+			}
+		})
+	}
+}
+
+func TestReserveAddOnsInRecordCurrency(t *testing.T) {
+	t.Setenv("BASE_CURRENCY", "IDR")
+	db := testdb.Open(t)
+	db.Create(&entity.ExchangeRate{Currency: "USD", Rate: 0.0001})
+	addOn := entity.AddOn{Name: "Child seat", PricingType: AddOnPerDay, Price: 100000}
+	db.Create(&addOn)
+
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	price := entity.PriceBreakdown{Currency: "USD", RentLength: 3, Total: 90}
+	s := Service{DB: db}
+	if err := s.ApplyAddOns(&price, []entity.RentAddOn{{AddOnID: addOn.ID, Quantity: 2}}, now, now); err != nil {
+		t.Fatal(err)
+	}
+	if len(price.AddOns) != 1 || price.AddOns[0].Amount != 60 || price.Total != 150 {
+		t.Fatalf("got %+v, want a 60 USD add-on line", price)
+	}
+
+	record := entity.Record{StartDate: now, EndDate: now.AddDate(0, 0, 3), Currency: "USD"}
+	db.Create(&record)
+	if err := ReserveAddOns(db, price, record, now); err != nil {
+		t.Fatal(err)
+	}
+	var line entity.RecordAddOn
+	db.Where("record_id = ?", record.ID).First(&line)
+	if line.UnitPrice != 30 || line.Amount != 60 {
+		t.Errorf("stored %+v, want a 30 USD unit price", line)
+	}
+}
@@ -0,0 +1,102 @@
+package pricing
+
+import (
+	"car-rental/currency"
+	"car-rental/entity"
+	"errors"
+	"math"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	HoldHeld     = "held"
+	HoldReleased = "released"
+	HoldCaptured = "captured"
+)
+
+// ErrFeesOwed is returned when a user with unpaid return fees tries to spend
+// or withdraw their deposit.
+var ErrFeesOwed = errors.New("return fees are unpaid, top up the wallet first")
+
+// SecurityHold returns the refundable hold for renting a product of category
+// in currency code, zero when no hold policy is set for it. Policies are set
+// in the base currency.
+func (s Service) SecurityHold(category, code string) (float64, error) {
+	var policy entity.HoldPolicy
+	result := s.DB.Where("category = ?", category).First(&policy)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	amount, _, err := currency.Convert(s.DB, policy.Amount, currency.Base(), code)
+	return amount, err
+}
+
+// ChargeFees takes return fees the security hold did not cover from the
+// user's available deposit inside tx. What the deposit cannot cover is added
+// to the user's unpaid balance. The amount is in the wallet currency.
+func ChargeFees(tx *gorm.DB, userID uint, amount float64, recordID *uint) (float64, float64, error) {
+	var user entity.User
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", userID).First(&user)
+	if result.Error != nil {
+		return 0, 0, result.Error
+	}
+	charged := round(math.Min(amount, math.Max(user.Deposit-user.Reserved, 0)))
+	owed := round(amount - charged)
+	result = tx.Model(&user).Updates(map[string]any{
+		"deposit": gorm.Expr("deposit - ?", charged),
+		"owed":    gorm.Expr("owed + ?", owed),
+	})
+	if result.Error != nil {
+		return 0, 0, result.Error
+	}
+	if charged > 0 {
+		result = tx.Create(&entity.LedgerEntry{
+			UserID:           user.ID,
+			Type:             "return_fee",
+			Amount:           -charged,
+			Currency:         currency.Or(user.Currency),
+			OriginalAmount:   -charged,
+			OriginalCurrency: currency.Or(user.Currency),
+			ExchangeRate:     1,
+			RecordID:         recordID,
+		})
+	}
+	return charged, owed, result.Error
+}
+
+// PayOwed pays the user's unpaid return fees from their available deposit
+// inside tx, as far as it goes, and returns the amount paid. It is called
+// after crediting the wallet.
+func PayOwed(tx *gorm.DB, userID uint) (float64, error) {
+	var user entity.User
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", userID).First(&user)
+	if result.Error != nil || user.Owed <= 0 {
+		return 0, result.Error
+	}
+	paid := round(math.Min(user.Owed, math.Max(user.Deposit-user.Reserved, 0)))
+	if paid <= 0 {
+		return 0, nil
+	}
+	result = tx.Model(&user).Updates(map[string]any{
+		"deposit": gorm.Expr("deposit - ?", paid),
+		"owed":    gorm.Expr("owed - ?", paid),
+	})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	result = tx.Create(&entity.LedgerEntry{
+		UserID:           user.ID,
+		Type:             "fee_payment",
+		Amount:           -paid,
+		Currency:         currency.Or(user.Currency),
+		OriginalAmount:   -paid,
+		OriginalCurrency: currency.Or(user.Currency),
+		ExchangeRate:     1,
+	})
+	return paid, result.Error
+}
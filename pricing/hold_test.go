@@ -0,0 +1,47 @@
+package pricing
+
+import (
+	"car-rental/entity"
+	"car-rental/testdb"
+	"testing"
+)
+
+func TestChargeFeesAndPayOwed(t *testing.T) {
+	db := testdb.Open(t)
+	user := entity.User{Email: "renter@example.com", Deposit: 100, Reserved: 30}
+	db.Create(&user)
+
+	// 70 is available, the other 50 is owed
+	charged, owed, err := ChargeFees(db, user.ID, 120, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if charged != 70 || owed != 50 {
+		t.Errorf("charged %.2f and owed %.2f, want 70 and 50", charged, owed)
+	}
+	db.First(&user, user.ID)
+	if user.Deposit != 30 || user.Owed != 50 {
+		t.Errorf("deposit %.2f and owed %.2f, want 30 and 50", user.Deposit, user.Owed)
+	}
+
+	// a top-up of 20 pays part of it off
+	db.Model(&user).Update("deposit", 50)
+	paid, err := PayOwed(db, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paid != 20 {
+		t.Errorf("paid %.2f, want 20", paid)
+	}
+	db.First(&user, user.ID)
+	if user.Deposit != 30 || user.Owed != 30 {
+		t.Errorf("deposit %.2f and owed %.2f, want 30 and 30", user.Deposit, user.Owed)
+	}
+
+	var entries []entity.LedgerEntry
+	db.Where("user_id = ?", user.ID).Order("id").Find(&entries)
+	if len(entries) != 2 || entries[0].Type != "return_fee" || entries[0].Amount != -70 ||
+		entries[1].Type != "fee_payment" || entries[1].Amount != -20 {
+		t.Errorf("ledger entries %+v", entries)
+	}
+}
@@ -0,0 +1,156 @@
+package pricing
+
+import (
+	"car-rental/currency"
+	"car-rental/entity"
+	"fmt"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	TypeDuration = "duration"
+	TypeWeekend  = "weekend"
+	TypeSeason   = "season"
+)
+
+// Service prices rentals using the pricing rules stored in the database.
+type Service struct {
+	DB *gorm.DB
+}
+
+// Validate checks that a rule has the fields its type needs.
+func Validate(rule entity.PricingRule) error {
+	switch rule.Type {
+	case TypeDuration:
+		if rule.MinDays == 0 {
+			return fmt.Errorf("duration rule needs min_days")
+		}
+	case TypeWeekend:
+	case TypeSeason:
+		if rule.StartDate == nil || rule.EndDate == nil {
+			return fmt.Errorf("season rule needs start_date and end_date")
+		}
+		if rule.EndDate.Before(*rule.StartDate) {
+			return fmt.Errorf("season end_date is before start_date")
+		}
+	default:
+		return fmt.Errorf("unknown rule type %q, use duration, weekend or season", rule.Type)
+	}
+	if rule.Percent <= -100 {
+		return fmt.Errorf("percent must be larger than -100")
+	}
+	return nil
+}
+
+// Quote prices renting product for rentLength days starting at start.
+//
+// Weekend and season rules adjust the daily rate of every day they cover,
+// only the duration rule with the highest matching min_days applies, on the
+// base price. Category specific rules replace the generic rules of the same
+// type for products in that category.
+func (s Service) Quote(product entity.Product, start time.Time, rentLength uint) (entity.PriceBreakdown, error) {
+	var rules []entity.PricingRule
+	result := s.DB.Where("disabled = ? AND (category = '' OR category = ?)", false, product.Category).Order("id").Find(&rules)
+	if result.Error != nil {
+		return entity.PriceBreakdown{}, result.Error
+	}
+	return Evaluate(product, start, rentLength, applicable(rules, product.Category)), nil
+}
+
+// applicable drops generic rules whose type has a category specific override.
+func applicable(rules []entity.PricingRule, category string) []entity.PricingRule {
+	overridden := map[string]bool{}
+	for _, rule := range rules {
+		if rule.Category != "" && rule.Category == category {
+			overridden[rule.Type] = true
+		}
+	}
+	var out []entity.PricingRule
+	for _, rule := range rules {
+		if rule.Category == "" && overridden[rule.Type] {
+			continue
+		}
+		out = append(out, rule)
+	}
+	return out
+}
+
+// Evaluate prices a rental against an already filtered set of rules.
+func Evaluate(product entity.Product, start time.Time, rentLength uint, rules []entity.PricingRule) entity.PriceBreakdown {
+	breakdown := entity.PriceBreakdown{
+		ProductID:  product.ID,
+		Currency:   currency.Or(product.Currency),
+		DailyRate:  product.RentalPrice,
+		RentLength: rentLength,
+		Base:       round(product.RentalPrice * float64(rentLength)),
+		Lines:      []entity.PriceLine{},
+		AddOns:     []entity.PriceLine{},
+	}
+	total := breakdown.Base
+
+	// day based rules
+	for _, rule := range rules {
+		if rule.Type != TypeWeekend && rule.Type != TypeSeason {
+			continue
+		}
+		var days int
+		for i := 0; i < int(rentLength); i++ {
+			day := start.AddDate(0, 0, i)
+			if covers(rule, day) {
+				days++
+			}
+		}
+		if days == 0 {
+			continue
+		}
+		amount := round(product.RentalPrice * float64(days) * rule.Percent / 100)
+		breakdown.Lines = append(breakdown.Lines, entity.PriceLine{
+			Description: fmt.Sprintf("%s (%+.2f%% on %d day(s))", rule.Name, rule.Percent, days),
+			RuleID:      rule.ID,
+			Amount:      amount,
+		})
+		total += amount
+	}
+
+	// best duration rule
+	var best *entity.PricingRule
+	for i, rule := range rules {
+		if rule.Type == TypeDuration && rentLength >= rule.MinDays && (best == nil || rule.MinDays > best.MinDays) {
+			best = &rules[i]
+		}
+	}
+	if best != nil {
+		amount := round(breakdown.Base * best.Percent / 100)
+		breakdown.Lines = append(breakdown.Lines, entity.PriceLine{
+			Description: fmt.Sprintf("%s (%+.2f%% for %d+ days)", best.Name, best.Percent, best.MinDays),
+			RuleID:      best.ID,
+			Amount:      amount,
+		})
+		total += amount
+	}
+
+	breakdown.Total = round(math.Max(total, 0))
+	return breakdown
+}
+
+func covers(rule entity.PricingRule, day time.Time) bool {
+	switch rule.Type {
+	case TypeWeekend:
+		return day.Weekday() == time.Saturday || day.Weekday() == time.Sunday
+	case TypeSeason:
+		d := truncateDay(day)
+		return !d.Before(truncateDay(*rule.StartDate)) && !d.After(truncateDay(*rule.EndDate))
+	}
+	return false
+}
+
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,94 @@
+package pricing
+
+import (
+	"car-rental/entity"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func date(month time.Month, day int) *time.Time {
+	d := time.Date(2026, month, day, 0, 0, 0, 0, time.UTC)
+	return &d
+}
+
+func TestEvaluate(t *testing.T) {
+	product := entity.Product{ID: 1, RentalPrice: 100}
+	monday := time.Date(2026, time.June, 1, 10, 0, 0, 0, time.UTC)
+	weekend := entity.PricingRule{ID: 1, Name: "Weekend", Type: TypeWeekend, Percent: 20}
+	weekly := entity.PricingRule{ID: 2, Name: "Weekly", Type: TypeDuration, MinDays: 7, Percent: -10}
+	monthly := entity.PricingRule{ID: 3, Name: "Monthly", Type: TypeDuration, MinDays: 30, Percent: -25}
+
+	tests := []struct {
+		name   string
+		length uint
+		rules  []entity.PricingRule
+		lines  []uint // rule of every line, in order
+		total  float64
+	}{
+		{"no rules", 3, nil, []uint{}, 300},
+		{"weekend days only", 7, []entity.PricingRule{weekend}, []uint{1}, 740},
+		{"no weekend day", 3, []entity.PricingRule{weekend}, []uint{}, 300},
+		{"season ending inside the rental", 5, []entity.PricingRule{
+			{ID: 4, Name: "Low", Type: TypeSeason, Percent: -10, StartDate: date(time.May, 25), EndDate: date(time.June, 2)},
+		}, []uint{4}, 480},
+		{"season starting inside the rental", 5, []entity.PricingRule{
+			{ID: 4, Name: "High", Type: TypeSeason, Percent: 50, StartDate: date(time.June, 4), EndDate: date(time.June, 30)},
+		}, []uint{4}, 600},
+		{"season ending on the first day", 3, []entity.PricingRule{
+			{ID: 4, Name: "Low", Type: TypeSeason, Percent: -10, StartDate: date(time.May, 1), EndDate: date(time.June, 1)},
+		}, []uint{4}, 290},
+		{"season after the rental", 3, []entity.PricingRule{
+			{ID: 4, Name: "High", Type: TypeSeason, Percent: 50, StartDate: date(time.June, 4), EndDate: date(time.June, 30)},
+		}, []uint{}, 300},
+		{"longest reached duration wins", 10, []entity.PricingRule{monthly, weekly}, []uint{2}, 900},
+		{"duration not reached", 10, []entity.PricingRule{monthly}, []uint{}, 1000},
+		{"day rules stack before the duration rule", 7, []entity.PricingRule{weekly, weekend}, []uint{1, 2}, 670},
+		{"never below zero", 3, []entity.PricingRule{
+			{ID: 4, Name: "Sale", Type: TypeSeason, Percent: -60, StartDate: date(time.June, 1), EndDate: date(time.June, 30)},
+			{ID: 5, Name: "Short", Type: TypeDuration, MinDays: 3, Percent: -50},
+		}, []uint{4, 5}, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Evaluate(product, monday, test.length, test.rules)
+			if got.Base != product.RentalPrice*float64(test.length) {
+				t.Errorf("base %v", got.Base)
+			}
+			if got.Total != test.total {
+				t.Errorf("total %v, want %v", got.Total, test.total)
+			}
+			if len(got.Lines) != len(test.lines) {
+				t.Fatalf("lines %+v, want rules %v", got.Lines, test.lines)
+			}
+			for i, line := range got.Lines {
+				if line.RuleID != test.lines[i] {
+					t.Errorf("line %d from rule %d, want %d", i, line.RuleID, test.lines[i])
+				}
+			}
+		})
+	}
+}
+
+func TestApplicable(t *testing.T) {
+	weekend := entity.PricingRule{ID: 1, Type: TypeWeekend}
+	duration := entity.PricingRule{ID: 2, Type: TypeDuration}
+	suvDuration := entity.PricingRule{ID: 3, Type: TypeDuration, Category: "suv"}
+	tests := []struct {
+		category string
+		rules    []entity.PricingRule // as loaded by Quote
+		want     []uint
+	}{
+		{"suv", []entity.PricingRule{weekend, duration, suvDuration}, []uint{1, 3}},
+		{"sedan", []entity.PricingRule{weekend, duration}, []uint{1, 2}},
+	}
+	for _, test := range tests {
+		var got []uint
+		for _, rule := range applicable(test.rules, test.category) {
+			got = append(got, rule.ID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("%s: got rules %v, want %v", test.category, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package pricing
+
+import (
+	"car-rental/currency"
+	"car-rental/entity"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	PromoPercent = "percent"
+	PromoFixed   = "fixed"
+)
+
+var ErrPromoUsedUp = errors.New("promo code usage limit reached")
+
+// NormalizeCode makes promo codes case insensitive.
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// ValidatePromo checks the fields of a promo code set by an admin.
+func ValidatePromo(promo entity.PromoCode) error {
+	if promo.Code == "" {
+		return fmt.Errorf("promo code needs a code")
+	}
+	switch promo.Type {
+	case PromoPercent:
+		if promo.Value <= 0 || promo.Value > 100 {
+			return fmt.Errorf("percent value must be between 0 and 100")
+		}
+	case PromoFixed:
+		if promo.Value <= 0 {
+			return fmt.Errorf("fixed value must be positive")
+		}
+	default:
+		return fmt.Errorf("unknown promo type %q, use percent or fixed", promo.Type)
+	}
+	if promo.StartsAt != nil && promo.EndsAt != nil && promo.EndsAt.Before(*promo.StartsAt) {
+		return fmt.Errorf("ends_at is before starts_at")
+	}
+	return nil
+}
+
+// FindPromo loads a promo code and checks it can be used by userID on product.
+// The usage caps are checked again when the code is redeemed.
+func (s Service) FindPromo(code string, userID uint, product entity.Product, now time.Time) (entity.PromoCode, error) {
+	var promo entity.PromoCode
+	result := s.DB.Where("code = ?", NormalizeCode(code)).First(&promo)
+	if result.Error != nil {
+		return promo, fmt.Errorf("promo code %s not found", code)
+	}
+	switch {
+	case promo.Disabled:
+		return promo, fmt.Errorf("promo code %s is disabled", promo.Code)
+	case promo.StartsAt != nil && now.Before(*promo.StartsAt):
+		return promo, fmt.Errorf("promo code %s is not valid yet", promo.Code)
+	case promo.EndsAt != nil && now.After(*promo.EndsAt):
+		return promo, fmt.Errorf("promo code %s has expired", promo.Code)
+	case promo.ProductID != 0 && promo.ProductID != product.ID:
+		return promo, fmt.Errorf("promo code %s is not valid for this product", promo.Code)
+	case promo.Category != "" && promo.Category != product.Category:
+		return promo, fmt.Errorf("promo code %s is only valid for %s", promo.Code, promo.Category)
+	case promo.MaxUses != 0 && promo.UsedCount >= promo.MaxUses:
+		return promo, ErrPromoUsedUp
+	}
+	if promo.MaxUsesPerUser != 0 {
+		var used int64
+		s.DB.Model(&entity.PromoRedemption{}).Where("promo_code_id = ? AND user_id = ?", promo.ID, userID).Count(&used)
+		if used >= int64(promo.MaxUsesPerUser) {
+			return promo, ErrPromoUsedUp
+		}
+	}
+	return promo, nil
+}
+
+// ApplyPromo adds the promo discount as a price line and lowers the total.
+// Fixed values are set in the base currency and converted to the price
+// currency.
+func (s Service) ApplyPromo(price *entity.PriceBreakdown, promo entity.PromoCode) error {
+	var amount float64
+	if promo.Type == PromoPercent {
+		amount = round(price.Total * promo.Value / 100)
+	} else {
+		var err error
+		amount, _, err = currency.Convert(s.DB, promo.Value, currency.Base(), price.Currency)
+		if err != nil {
+			return err
+		}
+	}
+	amount = math.Min(amount, price.Total)
+	price.Lines = append(price.Lines, entity.PriceLine{
+		Description: "Promo " + promo.Code,
+		PromoCodeID: promo.ID,
+		Amount:      -amount,
+	})
+	price.Total = round(price.Total - amount)
+	return nil
+}
+
+// PromoDiscount returns the promo code and discount applied to a price, if any.
+func PromoDiscount(price entity.PriceBreakdown) (uint, float64) {
+	for _, line := range price.Lines {
+		if line.PromoCodeID != 0 {
+			return line.PromoCodeID, -line.Amount
+		}
+	}
+	return 0, 0
+}
+
+// Redeem records the use of a promo code inside tx. The promo row is locked
+// so the usage caps hold under concurrent rents.
+func Redeem(tx *gorm.DB, promoID, userID, recordID uint, amount float64) error {
+	var promo entity.PromoCode
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", promoID).First(&promo)
+	if result.Error != nil {
+		return result.Error
+	}
+	if promo.MaxUses != 0 && promo.UsedCount >= promo.MaxUses {
+		return ErrPromoUsedUp
+	}
+	if promo.MaxUsesPerUser != 0 {
+		var used int64
+		result = tx.Model(&entity.PromoRedemption{}).Where("promo_code_id = ? AND user_id = ?", promo.ID, userID).Count(&used)
+		if result.Error != nil {
+			return result.Error
+		}
+		if used >= int64(promo.MaxUsesPerUser) {
+			return ErrPromoUsedUp
+		}
+	}
+	result = tx.Model(&promo).Update("used_count", gorm.Expr("used_count + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	return tx.Create(&entity.PromoRedemption{
+		PromoCodeID: promo.ID,
+		UserID:      userID,
+		RecordID:    recordID,
+		Amount:      amount,
+	}).Error
+}
@@ -0,0 +1,99 @@
+package pricing
+
+import (
+	"car-rental/entity"
+	"car-rental/testdb"
+	"errors"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestRedeemCaps(t *testing.T) {
+	tests := []struct {
+		name      string
+		promo     entity.PromoCode
+		users     []uint // one redemption per entry, in order
+		redeemed  int
+		usedCount uint
+	}{
+		{"unlimited", entity.PromoCode{}, []uint{1, 1, 2}, 3, 3},
+		{"total cap", entity.PromoCode{MaxUses: 2}, []uint{1, 2, 3}, 2, 2},
+		{"per user cap", entity.PromoCode{MaxUsesPerUser: 1}, []uint{1, 1, 2, 2}, 2, 2},
+		{"both caps", entity.PromoCode{MaxUses: 3, MaxUsesPerUser: 2}, []uint{1, 1, 1, 2, 2}, 3, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := testdb.Open(t)
+			promo := test.promo
+			promo.Code = "SAVE10"
+			db.Create(&promo)
+
+			redeemed := 0
+			for i, userID := range test.users {
+				err := db.Transaction(func(tx *gorm.DB) error {
+					return Redeem(tx, promo.ID, userID, uint(i+1), 10)
+				})
+				switch {
+				case err == nil:
+					redeemed++
+				case !errors.Is(err, ErrPromoUsedUp):
+					t.Fatalf("redemption %d: %v", i, err)
+				}
+			}
+			if redeemed != test.redeemed {
+				t.Errorf("redeemed %d times, want %d", redeemed, test.redeemed)
+			}
+			db.First(&promo, promo.ID)
+			if promo.UsedCount != test.usedCount {
+				t.Errorf("used_count %d, want %d", promo.UsedCount, test.usedCount)
+			}
+		})
+	}
+}
+
+func TestRedeemConcurrent(t *testing.T) {
+	db := testdb.Open(t)
+	promo := entity.PromoCode{Code: "RUSH", MaxUses: 5, MaxUsesPerUser: 1}
+	db.Create(&promo)
+
+	// 30 redemptions by 10 users at the same time
+	var wg sync.WaitGroup
+	errs := make(chan error, 30)
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- db.Transaction(func(tx *gorm.DB) error {
+				return Redeem(tx, promo.ID, uint(i%10+1), uint(i+1), 10)
+			})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	redeemed := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			redeemed++
+		case !errors.Is(err, ErrPromoUsedUp):
+			t.Fatal(err)
+		}
+	}
+	if redeemed != 5 {
+		t.Errorf("redeemed %d times, want 5", redeemed)
+	}
+	var perUser []int64
+	db.Model(&entity.PromoRedemption{}).Select("COUNT(*)").Group("user_id").Pluck("COUNT(*)", &perUser)
+	for _, n := range perUser {
+		if n > 1 {
+			t.Errorf("a user redeemed %d times, want at most 1", n)
+		}
+	}
+	db.First(&promo, promo.ID)
+	if promo.UsedCount != 5 {
+		t.Errorf("used_count %d, want 5", promo.UsedCount)
+	}
+}
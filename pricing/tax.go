@@ -0,0 +1,58 @@
+package pricing
+
+import (
+	"car-rental/entity"
+	"fmt"
+)
+
+// ValidateTaxRate checks the fields of a tax rate set by an admin.
+func ValidateTaxRate(rate entity.TaxRate) error {
+	if rate.Name == "" {
+		return fmt.Errorf("tax rate needs a name")
+	}
+	if rate.Rate < 0 || rate.Rate > 100 {
+		return fmt.Errorf("rate must be between 0 and 100 percent")
+	}
+	return nil
+}
+
+// TaxRate finds the tax rate for a product. A rate for both its category and
+// branch wins over one for the category only, then the branch only, then the
+// default rate with neither. The zero TaxRate means no tax.
+func (s Service) TaxRate(product entity.Product) (entity.TaxRate, error) {
+	var rates []entity.TaxRate
+	result := s.DB.Where("(category = '' OR category = ?) AND (branch = '' OR branch = ?)", product.Category, product.Branch).Find(&rates)
+	if result.Error != nil {
+		return entity.TaxRate{}, result.Error
+	}
+	var best entity.TaxRate
+	bestScore := -1
+	for _, rate := range rates {
+		score := 0
+		if rate.Category != "" {
+			score += 2
+		}
+		if rate.Branch != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = rate, score
+		}
+	}
+	return best, nil
+}
+
+// ApplyTax computes the tax on the price total. In exclusive mode the tax is
+// added to the total, in inclusive mode it is the share of the total that is
+// tax.
+func ApplyTax(price *entity.PriceBreakdown, rate entity.TaxRate) {
+	price.TaxName = rate.Name
+	price.TaxRate = rate.Rate
+	price.TaxInclusive = rate.Inclusive
+	if rate.Inclusive {
+		price.Tax = round(price.Total - price.Total/(1+rate.Rate/100))
+		return
+	}
+	price.Tax = round(price.Total * rate.Rate / 100)
+	price.Total = round(price.Total + price.Tax)
+}
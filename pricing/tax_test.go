@@ -0,0 +1,69 @@
+package pricing
+
+import (
+	"car-rental/entity"
+	"car-rental/testdb"
+	"testing"
+)
+
+func TestTaxRate(t *testing.T) {
+	db := testdb.Open(t)
+	db.Create(&[]entity.TaxRate{
+		{Name: "default", Rate: 10},
+		{Name: "branch", Rate: 11, Branch: "bali"},
+		{Name: "category", Rate: 12, Category: "suv"},
+		{Name: "both", Rate: 13, Category: "suv", Branch: "bali"},
+		{Name: "other", Rate: 14, Category: "van", Branch: "jakarta"},
+	})
+	tests := []struct {
+		category, branch string
+		want             string
+	}{
+		{"suv", "bali", "both"},
+		{"suv", "jakarta", "category"},
+		{"sedan", "bali", "branch"},
+		{"sedan", "jakarta", "default"},
+		{"van", "bali", "branch"},
+	}
+	s := Service{DB: db}
+	for _, test := range tests {
+		rate, err := s.TaxRate(entity.Product{Category: test.category, Branch: test.branch})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rate.Name != test.want {
+			t.Errorf("%s in %s taxed at %q, want %q", test.category, test.branch, rate.Name, test.want)
+		}
+	}
+
+	db.Where("category = '' AND branch = ''").Delete(&entity.TaxRate{})
+	rate, err := s.TaxRate(entity.Product{Category: "sedan", Branch: "jakarta"})
+	if err != nil || rate.Rate != 0 {
+		t.Errorf("got %+v, %v without a default rate, want no tax", rate, err)
+	}
+}
+
+func TestApplyTax(t *testing.T) {
+	tests := []struct {
+		name       string
+		total      float64
+		rate       entity.TaxRate
+		tax, after float64
+	}{
+		{"no tax", 100, entity.TaxRate{}, 0, 100},
+		{"exclusive", 100, entity.TaxRate{Name: "VAT", Rate: 11}, 11, 111},
+		{"exclusive rounds the tax", 33.33, entity.TaxRate{Name: "VAT", Rate: 11}, 3.67, 37},
+		{"inclusive", 111, entity.TaxRate{Name: "VAT", Rate: 11, Inclusive: true}, 11, 111},
+		{"inclusive rounds the tax", 100, entity.TaxRate{Name: "VAT", Rate: 11, Inclusive: true}, 9.91, 100},
+	}
+	for _, test := range tests {
+		price := entity.PriceBreakdown{Total: test.total}
+		ApplyTax(&price, test.rate)
+		if price.Tax != test.tax || price.Total != test.after {
+			t.Errorf("%s: tax %v and total %v, want %v and %v", test.name, price.Tax, price.Total, test.tax, test.after)
+		}
+		if price.TaxInclusive != test.rate.Inclusive || price.TaxRate != test.rate.Rate {
+			t.Errorf("%s: breakdown %+v does not carry the rate", test.name, price)
+		}
+	}
+}
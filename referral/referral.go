@@ -0,0 +1,214 @@
+package referral
+
+import (
+	"car-rental/currency"
+	"car-rental/entity"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	StatusPending  = "pending"
+	StatusRewarded = "rewarded"
+)
+
+// ErrRejected wraps every reason a referral code cannot be used.
+var ErrRejected = errors.New("referral rejected")
+
+// publicDomains are email providers shared by unrelated people, so the same
+// domain check skips them. REFERRAL_PUBLIC_DOMAINS replaces the list.
+var publicDomains = []string{"gmail.com", "yahoo.com", "outlook.com", "hotmail.com", "icloud.com"}
+
+// NewCode generates a referral code for a new user.
+func NewCode() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return strings.ToUpper(hex.EncodeToString(b)), nil
+}
+
+// Reward is the wallet credit, in the base currency, each party gets. It is
+// set by REFERRAL_REWARD.
+func Reward() float64 {
+	v, err := strconv.ParseFloat(os.Getenv("REFERRAL_REWARD"), 64)
+	if err != nil || v < 0 {
+		return 50000
+	}
+	return v
+}
+
+func envInt(key string, fallback int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || v < 0 {
+		return fallback
+	}
+	return v
+}
+
+// normalizeEmail lowercases an email and drops a +tag from its local part.
+func normalizeEmail(email string) (string, string) {
+	local, domain, _ := strings.Cut(strings.ToLower(strings.TrimSpace(email)), "@")
+	local, _, _ = strings.Cut(local, "+")
+	return local, domain
+}
+
+func isPublicDomain(domain string) bool {
+	domains := publicDomains
+	if env := os.Getenv("REFERRAL_PUBLIC_DOMAINS"); env != "" {
+		domains = strings.Split(env, ",")
+	}
+	for _, d := range domains {
+		if strings.EqualFold(strings.TrimSpace(d), domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check looks up the referrer by code and checks that a user registering
+// with email from device may be referred by them. It runs inside the
+// registration transaction and locks the referrer and device until it ends,
+// so concurrent registrations cannot go past the referral limits.
+func Check(tx *gorm.DB, code, email, device string) (entity.User, error) {
+	var referrer entity.User
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("referral_code = ?", strings.ToUpper(strings.TrimSpace(code))).Limit(1).Find(&referrer)
+	if result.Error != nil {
+		return referrer, result.Error
+	}
+	if referrer.ID == 0 {
+		return referrer, fmt.Errorf("%w: unknown referral code", ErrRejected)
+	}
+
+	local, domain := normalizeEmail(email)
+	refLocal, refDomain := normalizeEmail(referrer.Email)
+	if local == refLocal && domain == refDomain {
+		return referrer, fmt.Errorf("%w: cannot refer yourself", ErrRejected)
+	}
+	if domain == refDomain && !isPublicDomain(domain) {
+		return referrer, fmt.Errorf("%w: referrer has the same email domain", ErrRejected)
+	}
+	if device == "" {
+		return referrer, fmt.Errorf("%w: device ID is required", ErrRejected)
+	}
+	if device == referrer.DeviceID {
+		return referrer, fmt.Errorf("%w: cannot refer yourself", ErrRejected)
+	}
+	result = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&entity.ReferralDevice{DeviceID: device})
+	if result.Error != nil {
+		return referrer, result.Error
+	}
+	result = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("device_id = ?", device).First(&entity.ReferralDevice{})
+	if result.Error != nil {
+		return referrer, result.Error
+	}
+	var count int64
+	result = tx.Model(&entity.Referral{}).Where("device_id = ?", device).Count(&count)
+	if result.Error != nil {
+		return referrer, result.Error
+	}
+	if count >= int64(envInt("REFERRAL_DEVICE_LIMIT", 1)) {
+		return referrer, fmt.Errorf("%w: device already used for a referral", ErrRejected)
+	}
+
+	result = tx.Model(&entity.Referral{}).Where("referrer_id = ?", referrer.ID).Count(&count)
+	if result.Error != nil {
+		return referrer, result.Error
+	}
+	if count >= int64(envInt("REFERRAL_MAX_PER_USER", 10)) {
+		return referrer, fmt.Errorf("%w: referrer reached the referral limit", ErrRejected)
+	}
+	return referrer, nil
+}
+
+// PendingReferrer returns who referred a user whose referral is not
+// rewarded yet, or 0.
+func PendingReferrer(db *gorm.DB, userID uint) (uint, error) {
+	var ref entity.Referral
+	result := db.Where("referred_id = ? AND status = ?", userID, StatusPending).Limit(1).Find(&ref)
+	return ref.ReferrerID, result.Error
+}
+
+// Complete rewards the pending referral of a user, if any, inside tx. It is
+// called when one of their rents is returned, so only the first one counts.
+func Complete(tx *gorm.DB, userID uint, now time.Time) (*entity.Referral, error) {
+	var ref entity.Referral
+	result := tx.Where("referred_id = ? AND status = ?", userID, StatusPending).Limit(1).Find(&ref)
+	if result.Error != nil || ref.ID == 0 {
+		return nil, result.Error
+	}
+	ref.Status = StatusRewarded
+	ref.Reward = Reward()
+	ref.Currency = currency.Base()
+	ref.RewardedAt = &now
+	result = tx.Model(&entity.Referral{}).Where("id = ? AND status = ?", ref.ID, StatusPending).Updates(map[string]any{
+		"status":      ref.Status,
+		"reward":      ref.Reward,
+		"currency":    ref.Currency,
+		"rewarded_at": now,
+	})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, result.Error
+	}
+	for _, id := range []uint{ref.ReferrerID, ref.ReferredID} {
+		if err := credit(tx, id, ref.Reward); err != nil {
+			return nil, err
+		}
+	}
+	return &ref, nil
+}
+
+// credit adds the reward, converted to the wallet currency, to a user's deposit.
+func credit(tx *gorm.DB, userID uint, reward float64) error {
+	if reward == 0 {
+		return nil
+	}
+	var user entity.User
+	result := tx.Where("id = ?", userID).First(&user)
+	if result.Error != nil {
+		return result.Error
+	}
+	amount, rate, err := currency.Convert(tx, reward, currency.Base(), user.Currency)
+	if err != nil {
+		return err
+	}
+	result = tx.Model(&user).Update("deposit", gorm.Expr("deposit + ?", amount))
+	if result.Error != nil {
+		return result.Error
+	}
+	return tx.Create(&entity.LedgerEntry{
+		UserID:           user.ID,
+		Type:             "referral",
+		Amount:           amount,
+		Currency:         currency.Or(user.Currency),
+		OriginalAmount:   reward,
+		OriginalCurrency: currency.Base(),
+		ExchangeRate:     rate,
+	}).Error
+}
+
+// EnsureCode gives a user registered before referrals existed a code.
+func EnsureCode(db *gorm.DB, user *entity.User) error {
+	if user.ReferralCode != nil {
+		return nil
+	}
+	code, err := NewCode()
+	if err != nil {
+		return err
+	}
+	result := db.Model(user).Where("referral_code IS NULL").Update("referral_code", code)
+	if result.Error != nil {
+		return result.Error
+	}
+	return db.Where("id = ?", user.ID).First(user).Error
+}
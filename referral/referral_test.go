@@ -0,0 +1,86 @@
+package referral
+
+import (
+	"car-rental/entity"
+	"car-rental/testdb"
+	"errors"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestCheck(t *testing.T) {
+	t.Setenv("REFERRAL_DEVICE_LIMIT", "1")
+	t.Setenv("REFERRAL_MAX_PER_USER", "2")
+	db := testdb.Open(t)
+	code := "ABCD1234"
+	referrer := entity.User{Email: "ann@corp.example", ReferralCode: &code, DeviceID: "ann-phone"}
+	db.Create(&referrer)
+	db.Create(&entity.Referral{ReferrerID: referrer.ID, ReferredID: 100, DeviceID: "used-phone"})
+
+	tests := []struct {
+		name, code, email, device string
+		ok                        bool
+	}{
+		{"valid", "abcd1234", "bob@mail.example", "bob-phone", true},
+		{"unknown code", "FFFF0000", "bob@mail.example", "bob-phone", false},
+		{"missing device", code, "bob@mail.example", "", false},
+		{"own device", code, "bob@mail.example", "ann-phone", false},
+		{"device limit", code, "bob@mail.example", "used-phone", false},
+		{"self with tag", code, "Ann+2@corp.example", "bob-phone", false},
+		{"same company domain", code, "bob@corp.example", "bob-phone", false},
+		{"public domain", code, "bob@gmail.com", "bob-phone", true},
+	}
+	for _, test := range tests {
+		_, err := Check(db, test.code, test.email, test.device)
+		if test.ok && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if !test.ok && !errors.Is(err, ErrRejected) {
+			t.Errorf("%s: got %v, want rejected", test.name, err)
+		}
+	}
+}
+
+func TestCheckConcurrentLimits(t *testing.T) {
+	t.Setenv("REFERRAL_DEVICE_LIMIT", "1")
+	t.Setenv("REFERRAL_MAX_PER_USER", "3")
+	db := testdb.Open(t)
+	code := "ABCD1234"
+	referrer := entity.User{Email: "ann@corp.example", ReferralCode: &code}
+	db.Create(&referrer)
+
+	// 20 registrations at the same time, two per device
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := db.Transaction(func(tx *gorm.DB) error {
+				device := string(rune('a' + i/2))
+				if _, err := Check(tx, code, "user@gmail.com", device); err != nil {
+					return err
+				}
+				return tx.Create(&entity.Referral{ReferrerID: referrer.ID, ReferredID: uint(i + 1), DeviceID: device}).Error
+			})
+			if err != nil && !errors.Is(err, ErrRejected) {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var referrals []entity.Referral
+	db.Find(&referrals)
+	if len(referrals) != 3 {
+		t.Errorf("%d referrals, want 3", len(referrals))
+	}
+	devices := map[string]bool{}
+	for _, ref := range referrals {
+		if devices[ref.DeviceID] {
+			t.Errorf("device %s used twice", ref.DeviceID)
+		}
+		devices[ref.DeviceID] = true
+	}
+}
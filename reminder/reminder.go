@@ -0,0 +1,178 @@
+package reminder
+
+import (
+	"car-rental/emails"
+	"car-rental/entity"
+	"car-rental/notify"
+	"context"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	KindPickup = "pickup"
+	KindReturn = "return"
+)
+
+// Scheduler sends reminders ahead of a rent's start and end. Every reminder
+// is recorded under a unique record, kind and offset in the same
+// transaction that queues it, so restarts and concurrent instances never
+// send one twice.
+type Scheduler struct {
+	DB            *gorm.DB
+	PickupOffsets []time.Duration // how long before StartDate, ascending
+	ReturnOffsets []time.Duration // how long before EndDate, ascending
+	Interval      time.Duration
+}
+
+// NewScheduler reads REMINDER_PICKUP_OFFSETS and REMINDER_RETURN_OFFSETS as
+// comma separated durations, both defaulting to 24h,2h, and
+// REMINDER_INTERVAL, defaulting to a minute.
+func NewScheduler(db *gorm.DB) Scheduler {
+	s := Scheduler{
+		DB:            db,
+		PickupOffsets: offsets("REMINDER_PICKUP_OFFSETS"),
+		ReturnOffsets: offsets("REMINDER_RETURN_OFFSETS"),
+		Interval:      time.Minute,
+	}
+	if v, err := time.ParseDuration(os.Getenv("REMINDER_INTERVAL")); err == nil && v > 0 {
+		s.Interval = v
+	}
+	return s
+}
+
+func offsets(key string) []time.Duration {
+	env, ok := os.LookupEnv(key)
+	if !ok {
+		env = "24h,2h"
+	}
+	var out []time.Duration
+	for _, v := range strings.Split(env, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Printf("reminder: ignoring %s offset %q", key, v)
+			continue
+		}
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// Run sends due reminders every Interval until ctx is cancelled.
+func (s Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.RunOnce(time.Now()); err != nil {
+			log.Printf("reminder: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce queues every reminder due at now and returns how many it queued.
+// Reminders that fail are logged and left for the next run.
+func (s Scheduler) RunOnce(now time.Time) (int, error) {
+	sent := 0
+	for _, kind := range []string{KindPickup, KindReturn} {
+		offsets, column := s.PickupOffsets, "start_date"
+		if kind == KindReturn {
+			offsets, column = s.ReturnOffsets, "end_date"
+		}
+		if len(offsets) == 0 {
+			continue
+		}
+		var records []entity.Record
+		result := s.DB.Where("returned_at IS NULL AND "+column+" > ? AND "+column+" <= ?", now, now.Add(offsets[len(offsets)-1])).
+			Order("id").Find(&records)
+		if result.Error != nil {
+			return sent, result.Error
+		}
+		for _, record := range records {
+			due := record.EndDate
+			if kind == KindPickup {
+				due = record.StartDate
+			}
+			// only the closest offset is sent, so a rent found late does
+			// not get every reminder at once
+			var offset time.Duration
+			for _, o := range offsets {
+				if due.Sub(now) <= o {
+					offset = o
+					break
+				}
+			}
+			// skip reminders whose time came before the rent was booked
+			if record.CreatedAt.After(due.Add(-offset)) {
+				continue
+			}
+			// a rent that cannot be reminded must not hold up the others,
+			// it is tried again on the next run
+			ok, err := s.send(record, kind, offset, now)
+			if err != nil {
+				log.Printf("reminder: %s reminder of rent %d: %v", kind, record.ID, err)
+				continue
+			}
+			if ok {
+				sent++
+			}
+		}
+	}
+	return sent, nil
+}
+
+// send records and queues one reminder, returning false when it was
+// already sent.
+func (s Scheduler) send(record entity.Record, kind string, offset time.Duration, now time.Time) (bool, error) {
+	sent := false
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&entity.Reminder{
+			RecordID: record.ID,
+			Kind:     kind,
+			Offset:   offset.String(),
+			SentAt:   now,
+		})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		var user entity.User
+		if err := tx.Where("id = ?", record.UserID).First(&user).Error; err != nil {
+			return err
+		}
+		var product entity.Product
+		if err := tx.Unscoped().Where("id = ?", record.ProductID).First(&product).Error; err != nil {
+			return err
+		}
+		event := notify.RentalEndingSoon
+		if kind == KindPickup {
+			event = notify.RentalStartingSoon
+		}
+		sent = true
+		return notify.Notify(tx, user, event, emails.RentalReminderData{
+			Name:        user.Name,
+			RecordID:    record.ID,
+			Product:     product.Name,
+			Category:    product.Category,
+			Description: product.Description,
+			Branch:      product.Branch,
+			StartDate:   record.StartDate,
+			EndDate:     record.EndDate,
+		})
+	})
+	return sent && err == nil, err
+}
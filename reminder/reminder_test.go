@@ -0,0 +1,90 @@
+package reminder
+
+import (
+	"car-rental/entity"
+	"car-rental/notify"
+	"car-rental/testdb"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunOnce(t *testing.T) {
+	db := testdb.Open(t)
+	now := time.Now().Truncate(time.Second)
+	hour := time.Hour
+	day := 24 * hour
+	user := entity.User{Name: "Ana", Email: "ana@example.com"}
+	db.Create(&user)
+	product := entity.Product{Name: "Clio", RentalPrice: 30, Stock: 1}
+	db.Create(&product)
+
+	returned := now.Add(-hour)
+	records := map[string]*entity.Record{
+		// the user is gone, failing must not hold up the rents after it
+		"orphan":   {UserID: user.ID + 100, StartDate: now.Add(20 * hour), EndDate: now.Add(5 * day), CreatedAt: now.Add(-2 * day)},
+		"tomorrow": {StartDate: now.Add(20 * hour), EndDate: now.Add(5 * day), CreatedAt: now.Add(-2 * day)},
+		// found late, only the closest reminder is sent
+		"soon": {StartDate: now.Add(hour), EndDate: now.Add(5 * day), CreatedAt: now.Add(-2 * day)},
+		// booked after its 24h reminder was due
+		"last minute": {StartDate: now.Add(10 * hour), EndDate: now.Add(5 * day), CreatedAt: now.Add(-hour)},
+		"ending":      {StartDate: now.Add(-2 * day), EndDate: now.Add(3 * hour), CreatedAt: now.Add(-3 * day)},
+		"returned":    {StartDate: now.Add(-2 * day), EndDate: now.Add(3 * hour), ReturnedAt: &returned, CreatedAt: now.Add(-3 * day)},
+	}
+	names := map[uint]string{}
+	for _, name := range []string{"orphan", "tomorrow", "soon", "last minute", "ending", "returned"} {
+		record := records[name]
+		if record.UserID == 0 {
+			record.UserID = user.ID
+		}
+		record.ProductID = product.ID
+		db.Create(record)
+		names[record.ID] = name
+	}
+
+	s := Scheduler{DB: db, PickupOffsets: []time.Duration{2 * hour, day}, ReturnOffsets: []time.Duration{2 * hour, day}}
+	runs := []struct {
+		now  time.Time
+		sent int
+	}{
+		{now, 3},
+		// a restart, or a second instance, sends nothing again
+		{now, 0},
+		{now.Add(90 * time.Minute), 1},
+	}
+	for i, run := range runs {
+		sent, err := s.RunOnce(run.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sent != run.sent {
+			t.Errorf("run %d sent %d reminders, want %d", i, sent, run.sent)
+		}
+	}
+
+	var reminders []entity.Reminder
+	db.Find(&reminders)
+	var got []string
+	for _, r := range reminders {
+		got = append(got, names[r.RecordID]+" "+r.Kind+" "+r.Offset)
+	}
+	sort.Strings(got)
+	want := []string{"ending return 24h0m0s", "ending return 2h0m0s", "soon pickup 2h0m0s", "tomorrow pickup 24h0m0s"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("reminders %v, want %v", got, want)
+	}
+
+	var msgs []entity.OutboxMessage
+	db.Find(&msgs)
+	events := map[string]int{}
+	for _, msg := range msgs {
+		if msg.To != user.Email {
+			t.Errorf("reminder sent to %s", msg.To)
+		}
+		events[msg.Event]++
+	}
+	if len(msgs) != 4 || events[notify.RentalStartingSoon] != 2 || events[notify.RentalEndingSoon] != 2 {
+		t.Errorf("queued %v, want 2 starting and 2 ending soon emails", events)
+	}
+}
@@ -0,0 +1,321 @@
+package report
+
+import (
+	"car-rental/currency"
+	"car-rental/entity"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Revenue groupings.
+const (
+	ByDay      = "day"
+	ByWeek     = "week"
+	ByMonth    = "month"
+	ByCategory = "category"
+	ByProduct  = "product"
+)
+
+// Periods a report can be grouped by. Weeks start on Monday.
+var Periods = []string{ByDay, ByWeek, ByMonth}
+
+// ValidPeriod reports whether group is one of Periods.
+func ValidPeriod(group string) bool {
+	for _, p := range Periods {
+		if p == group {
+			return true
+		}
+	}
+	return false
+}
+
+// periodStart is the SQL for the start date of the period a column falls in.
+// group must be one of Periods, it is not a query parameter.
+func periodStart(group, column string) string {
+	return fmt.Sprintf("to_char(date_trunc('%s', %s), 'YYYY-MM-DD')", group, column)
+}
+
+// revenueSum is one group of rents or fees in one currency.
+type revenueSum struct {
+	Group     string
+	ProductID uint
+	Currency  string
+	Rents     int
+	Total     float64
+	Tax       float64
+	Fees      float64
+}
+
+// Revenue sums what the rents started in [from, to) were charged, converted
+// to the base currency, per period, category or product. Late and damage
+// fees taken at return (hold_capture and return_fee ledger entries) count
+// towards the rent they were charged for. Fees the wallet could not cover
+// are left out, also once paid later (fee_payment entries), as that payment
+// is not tied to a rent.
+func Revenue(db *gorm.DB, group string, from, to time.Time) ([]entity.RevenueRow, error) {
+	var key, keys string
+	switch {
+	case ValidPeriod(group):
+		key = periodStart(group, "records.start_date")
+		keys = key
+	case group == ByCategory:
+		key = "products.category"
+		keys = key
+	case group == ByProduct:
+		key = "products.name"
+		keys = "products.id, products.name"
+	default:
+		return nil, fmt.Errorf("unknown group %s", group)
+	}
+	var sums []revenueSum
+	query := db.Table("records").
+		Joins("JOIN products ON products.id = records.product_id").
+		Where("records.start_date >= ? AND records.start_date < ?", from, to).
+		Group(keys + ", records.currency")
+	if group == ByProduct {
+		query = query.Select(key + ` AS "group", products.id AS product_id, records.currency, COUNT(*) AS rents, SUM(records.total) AS total, SUM(records.tax) AS tax`)
+	} else {
+		query = query.Select(key + ` AS "group", records.currency, COUNT(*) AS rents, SUM(records.total) AS total, SUM(records.tax) AS tax`)
+	}
+	if err := query.Scan(&sums).Error; err != nil {
+		return nil, err
+	}
+	var fees []revenueSum
+	// fee entries are negative as they are taken from the deposit
+	query = db.Table("ledger_entries").
+		Joins("JOIN records ON records.id = ledger_entries.record_id").
+		Joins("JOIN products ON products.id = records.product_id").
+		Where("ledger_entries.type IN ? AND records.start_date >= ? AND records.start_date < ?", []string{"hold_capture", "return_fee"}, from, to).
+		Group(keys + ", ledger_entries.currency")
+	if group == ByProduct {
+		query = query.Select(key + ` AS "group", products.id AS product_id, ledger_entries.currency, -SUM(ledger_entries.amount) AS fees`)
+	} else {
+		query = query.Select(key + ` AS "group", ledger_entries.currency, -SUM(ledger_entries.amount) AS fees`)
+	}
+	if err := query.Scan(&fees).Error; err != nil {
+		return nil, err
+	}
+
+	rows := map[string]*entity.RevenueRow{}
+	for _, sum := range append(sums, fees...) {
+		rate, err := currency.Rate(db, sum.Currency, currency.Base())
+		if err != nil {
+			return nil, err
+		}
+		id := sum.Group
+		if group == ByProduct {
+			id = fmt.Sprint(sum.ProductID)
+		}
+		row, ok := rows[id]
+		if !ok {
+			row = &entity.RevenueRow{Group: sum.Group, ProductID: sum.ProductID, Currency: currency.Base()}
+			rows[id] = row
+		}
+		row.Rents += sum.Rents
+		row.Total += (sum.Total + sum.Fees) * rate
+		row.Tax += sum.Tax * rate
+		row.Fees += sum.Fees * rate
+	}
+	result := make([]entity.RevenueRow, 0, len(rows))
+	for _, row := range rows {
+		row.Total = round(row.Total)
+		row.Tax = round(row.Tax)
+		row.Fees = round(row.Fees)
+		row.Net = round(row.Total - row.Tax)
+		result = append(result, *row)
+	}
+	if ValidPeriod(group) {
+		sort.Slice(result, func(i, j int) bool { return result[i].Group < result[j].Group })
+	} else {
+		sort.Slice(result, func(i, j int) bool { return result[i].Total > result[j].Total })
+	}
+	return result, nil
+}
+
+// Utilization compares, per product, the days its units were rented out in
+// [from, to) with the days they were available. Rents not returned yet count
+// until their end date, or until now when they are late. Archived products
+// only show up when they were rented in the period.
+func Utilization(db *gorm.DB, from, to, now time.Time) ([]entity.UtilizationRow, error) {
+	var rented []struct {
+		ProductID  uint
+		Rents      int
+		DaysRented float64
+	}
+	end := "COALESCE(returned_at, GREATEST(end_date, @now))"
+	result := db.Table("records").
+		Select("product_id, COUNT(*) AS rents, SUM(EXTRACT(EPOCH FROM LEAST("+end+", @to) - GREATEST(start_date, @from))) / 86400 AS days_rented",
+			map[string]any{"from": from, "to": to, "now": now}).
+		Where("start_date < @to AND "+end+" > @from", map[string]any{"from": from, "to": to, "now": now}).
+		Group("product_id").
+		Scan(&rented)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	byProduct := map[uint]int{}
+	ids := []uint{}
+	for i, r := range rented {
+		byProduct[r.ProductID] = i
+		ids = append(ids, r.ProductID)
+	}
+
+	var products []entity.Product
+	result = db.Unscoped().Where("deleted_at IS NULL OR id IN ?", append(ids, 0)).Order("id").Find(&products)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	days := to.Sub(from).Hours() / 24
+	rows := make([]entity.UtilizationRow, 0, len(products))
+	for _, product := range products {
+		row := entity.UtilizationRow{
+			ProductID: product.ID,
+			Name:      product.Name,
+			Category:  product.Category,
+			Units:     max(product.Stock, 1),
+		}
+		row.DaysAvailable = round(days * float64(row.Units))
+		if i, ok := byProduct[product.ID]; ok {
+			row.Rents = rented[i].Rents
+			row.DaysRented = round(rented[i].DaysRented)
+		}
+		if row.DaysAvailable > 0 {
+			row.Utilization = round(math.Min(row.DaysRented/row.DaysAvailable, 1) * 100)
+		}
+		rows = append(rows, row)
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Utilization > rows[j].Utilization })
+	return rows, nil
+}
+
+// RentalLength averages, per category and overall, the booked length of the
+// rents started in [from, to) and how long the returned ones actually took.
+func RentalLength(db *gorm.DB, from, to time.Time) ([]entity.RentalLengthRow, error) {
+	var rows []entity.RentalLengthRow
+	result := db.Table("records").
+		Joins("JOIN products ON products.id = records.product_id").
+		Select(`COALESCE(products.category, 'all') AS category, COUNT(*) AS rents,
+			AVG(EXTRACT(EPOCH FROM records.end_date - records.start_date)) / 86400 AS avg_booked_days,
+			COUNT(records.returned_at) AS returned,
+			COALESCE(AVG(EXTRACT(EPOCH FROM records.returned_at - records.start_date)) / 86400, 0) AS avg_actual_days`).
+		Where("records.start_date >= ? AND records.start_date < ?", from, to).
+		Group("ROLLUP (products.category)").
+		Order("products.category NULLS LAST").
+		Scan(&rows)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	for i := range rows {
+		rows[i].AvgBookedDays = round(rows[i].AvgBookedDays)
+		rows[i].AvgActualDays = round(rows[i].AvgActualDays)
+	}
+	return rows, nil
+}
+
+// TopCustomers ranks the users who spent the most, in the base currency, on
+// rents started in [from, to).
+func TopCustomers(db *gorm.DB, from, to time.Time, limit int) ([]entity.TopCustomerRow, error) {
+	var sums []struct {
+		UserID   uint
+		Currency string
+		Rents    int
+		Total    float64
+	}
+	result := db.Table("records").
+		Select("user_id, currency, COUNT(*) AS rents, SUM(total) AS total").
+		Where("start_date >= ? AND start_date < ?", from, to).
+		Group("user_id, currency").
+		Scan(&sums)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	byUser := map[uint]*entity.TopCustomerRow{}
+	for _, sum := range sums {
+		rate, err := currency.Rate(db, sum.Currency, currency.Base())
+		if err != nil {
+			return nil, err
+		}
+		row, ok := byUser[sum.UserID]
+		if !ok {
+			row = &entity.TopCustomerRow{UserID: sum.UserID, Currency: currency.Base()}
+			byUser[sum.UserID] = row
+		}
+		row.Rents += sum.Rents
+		row.Spend += sum.Total * rate
+	}
+	rows := make([]entity.TopCustomerRow, 0, len(byUser))
+	for _, row := range byUser {
+		row.Spend = round(row.Spend)
+		rows = append(rows, *row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Spend != rows[j].Spend {
+			return rows[i].Spend > rows[j].Spend
+		}
+		return rows[i].UserID < rows[j].UserID
+	})
+	if len(rows) > limit {
+		rows = rows[:limit]
+	}
+
+	for i := range rows {
+		var user entity.User
+		if err := db.Where("id = ?", rows[i].UserID).Limit(1).Find(&user).Error; err != nil {
+			return nil, err
+		}
+		rows[i].Name = user.Name
+		rows[i].Email = user.Email
+	}
+	return rows, nil
+}
+
+// TopUps sums the wallet top-ups made in [from, to), converted to the base
+// currency, per period.
+func TopUps(db *gorm.DB, group string, from, to time.Time) ([]entity.TopUpRow, error) {
+	if !ValidPeriod(group) {
+		return nil, fmt.Errorf("unknown period %s", group)
+	}
+	key := periodStart(group, "created_at")
+	var sums []struct {
+		Period   string
+		Currency string
+		TopUps   int
+		Amount   float64
+	}
+	result := db.Model(&entity.LedgerEntry{}).
+		Select(key+" AS period, currency, COUNT(*) AS top_ups, SUM(amount) AS amount").
+		Where("type = ? AND created_at >= ? AND created_at < ?", "topup", from, to).
+		Group(key + ", currency").
+		Scan(&sums)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	byPeriod := map[string]*entity.TopUpRow{}
+	for _, sum := range sums {
+		rate, err := currency.Rate(db, sum.Currency, currency.Base())
+		if err != nil {
+			return nil, err
+		}
+		row, ok := byPeriod[sum.Period]
+		if !ok {
+			row = &entity.TopUpRow{Period: sum.Period, Currency: currency.Base()}
+			byPeriod[sum.Period] = row
+		}
+		row.TopUps += sum.TopUps
+		row.Amount += sum.Amount * rate
+	}
+	rows := make([]entity.TopUpRow, 0, len(byPeriod))
+	for _, row := range byPeriod {
+		row.Amount = round(row.Amount)
+		rows = append(rows, *row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Period < rows[j].Period })
+	return rows, nil
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStorage writes files under Dir, served by the app under BaseURL.
+type LocalStorage struct {
+	Dir     string
+	BaseURL string
+}
+
+func (ls LocalStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (string, error) {
+	path := filepath.Join(ls.Dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, r); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(ls.BaseURL, "/") + "/" + key, nil
+}
+
+func (ls LocalStorage) Delete(ctx context.Context, key string) error {
+	err := os.Remove(filepath.Join(ls.Dir, filepath.FromSlash(key)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,72 @@
+// Package testdb opens a migrated database for package tests.
+//
+// Tests run against the Postgres database in TEST_DATABASE_DSN (key=value
+// form) when it is set, each test in its own schema. Otherwise they use a
+// throwaway SQLite file, where transactions take the write lock when they
+// begin, so concurrent tests still see serialized transactions.
+package testdb
+
+import (
+	"car-rental/entity"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Open returns a fresh database with every table migrated. It is dropped
+// when the test ends.
+func Open(t testing.TB) *gorm.DB {
+	t.Helper()
+	config := &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)}
+
+	var db *gorm.DB
+	var err error
+	if dsn := os.Getenv("TEST_DATABASE_DSN"); dsn != "" {
+		db, err = openSchema(t, dsn, config)
+	} else {
+		path := filepath.Join(t.TempDir(), "test.db")
+		db, err = gorm.Open(sqlite.Open("file:"+path+"?_busy_timeout=30000&_txlock=immediate"), config)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(entity.Tables()...); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func openSchema(t testing.TB, dsn string, config *gorm.Config) (*gorm.DB, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	schema := "test_" + hex.EncodeToString(b)
+
+	admin, err := gorm.Open(postgres.Open(dsn), config)
+	if err != nil {
+		return nil, err
+	}
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		if sqlDB, err := admin.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return gorm.Open(postgres.Open(dsn+" search_path="+schema), config)
+}
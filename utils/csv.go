@@ -0,0 +1,223 @@
+package utils
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WriteCSV writes a slice of structs as CSV with a header row, one column
+// per field named after its JSON tag. Text that a spreadsheet would read as
+// a formula is escaped.
+func WriteCSV(w io.Writer, rows any) error {
+	v := reflect.ValueOf(rows)
+	if v.Kind() != reflect.Slice {
+		return fmt.Errorf("csv rows must be a slice, got %s", v.Kind())
+	}
+	typ := v.Type().Elem()
+	if typ.Kind() != reflect.Struct {
+		return fmt.Errorf("csv rows must be structs, got %s", typ.Kind())
+	}
+	out := csv.NewWriter(w)
+	if err := out.Write(CSVHeader(typ)); err != nil {
+		return err
+	}
+	for i := 0; i < v.Len(); i++ {
+		if err := out.Write(CSVRecord(v.Index(i).Interface())); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// CSVHeader lists the columns of a struct type: its serialized fields named
+// after their JSON tag.
+func CSVHeader(typ reflect.Type) []string {
+	var header []string
+	for _, i := range csvFields(typ) {
+		header = append(header, csvName(typ.Field(i)))
+	}
+	return header
+}
+
+// CSVRecord formats a struct as a row in the order of CSVHeader.
+func CSVRecord(row any) []string {
+	v := reflect.ValueOf(row)
+	fields := csvFields(v.Type())
+	record := make([]string, len(fields))
+	for j, field := range fields {
+		record[j] = csvValue(v.Field(field))
+	}
+	return record
+}
+
+// CSVDecoder reads CSV rows into structs, matching columns to fields by
+// their JSON name. Columns may come in any order and be left out.
+type CSVDecoder struct {
+	r      *csv.Reader
+	typ    reflect.Type
+	fields []int // struct field per column
+	Line   int   // line of the last decoded row
+}
+
+// NewCSVDecoder reads the header row and fails on unknown columns.
+func NewCSVDecoder(r io.Reader, typ reflect.Type) (*CSVDecoder, error) {
+	d := &CSVDecoder{r: csv.NewReader(r), typ: typ}
+	d.r.TrimLeadingSpace = true
+	header, err := d.r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading csv header: %w", err)
+	}
+	byName := map[string]int{}
+	for _, i := range csvFields(typ) {
+		byName[csvName(typ.Field(i))] = i
+	}
+	for _, name := range header {
+		i, ok := byName[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown csv column %q", name)
+		}
+		d.fields = append(d.fields, i)
+	}
+	return d, nil
+}
+
+// Decode reads the next row into dst, a pointer to the decoder's struct
+// type. It returns io.EOF after the last row. A row that cannot be parsed
+// returns a *CSVRowError, and the next row can still be decoded.
+func (d *CSVDecoder) Decode(dst any) error {
+	record, err := d.r.Read()
+	if err == io.EOF {
+		return err
+	}
+	if perr, ok := err.(*csv.ParseError); ok && perr.Err == csv.ErrFieldCount {
+		d.Line = perr.StartLine
+		return &CSVRowError{Line: d.Line, Err: fmt.Errorf("expected %d columns, got %d", len(d.fields), len(record))}
+	}
+	if err != nil {
+		return err
+	}
+	d.Line, _ = d.r.FieldPos(0)
+	v := reflect.ValueOf(dst).Elem()
+	for col, field := range d.fields {
+		if err := parseCSVValue(v.Field(field), strings.TrimSpace(record[col])); err != nil {
+			return &CSVRowError{Line: d.Line, Err: fmt.Errorf("%s: %w", csvName(d.typ.Field(field)), err)}
+		}
+	}
+	return nil
+}
+
+// CSVRowError is a row that could not be parsed.
+type CSVRowError struct {
+	Line int
+	Err  error
+}
+
+func (e *CSVRowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func csvFields(typ reflect.Type) []int {
+	var fields []int
+	for i := 0; i < typ.NumField(); i++ {
+		if csvName(typ.Field(i)) != "" {
+			fields = append(fields, i)
+		}
+	}
+	return fields
+}
+
+// csvName is the JSON name of an exported field, or empty when it is not
+// serialized.
+func csvName(field reflect.StructField) string {
+	if !field.IsExported() {
+		return ""
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+func csvValue(v reflect.Value) string {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.String:
+		return escapeFormula(v.String())
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// formulaStart are the first characters that make spreadsheets read a cell
+// as a formula.
+const formulaStart = "=+-@\t\r"
+
+// escapeFormula prefixes text that a spreadsheet would run as a formula with
+// a quote, so it is shown as text. parseCSVValue drops the quote again.
+func escapeFormula(s string) string {
+	if s != "" && strings.ContainsRune(formulaStart, rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// parseCSVValue sets a string, number or bool field. Empty cells leave the
+// zero value.
+func parseCSVValue(v reflect.Value, s string) error {
+	if s == "" {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		if len(s) > 1 && s[0] == '\'' && strings.ContainsRune(formulaStart, rune(s[1])) {
+			s = s[1:]
+		}
+		v.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", s)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a positive whole number", s)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", s)
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", s)
+		}
+		v.SetBool(b)
+	default:
+		return fmt.Errorf("cannot read %s from csv", v.Kind())
+	}
+	return nil
+}
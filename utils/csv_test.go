@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type csvRow struct {
+	Name    string  `json:"name"`
+	Balance float64 `json:"balance"`
+}
+
+func TestCSVEscapesFormulas(t *testing.T) {
+	rows := []csvRow{
+		{Name: "=HYPERLINK(\"http://evil\")", Balance: -5},
+		{Name: "+1 555", Balance: 1},
+		{Name: "-rf", Balance: 2},
+		{Name: "@SUM(A1)", Balance: 3},
+		{Name: "Ana", Balance: 4},
+		{Name: "'quoted", Balance: 5},
+	}
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, rows); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"name,balance",
+		`"'=HYPERLINK(""http://evil"")",-5`,
+		"'+1 555,1",
+		"'-rf,2",
+		"'@SUM(A1),3",
+		"Ana,4",
+		"'quoted,5",
+		"",
+	}, "\n")
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	// reading the file back gives the original values
+	d, err := NewCSVDecoder(&buf, reflect.TypeOf(csvRow{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		var got csvRow
+		if err := d.Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != row {
+			t.Errorf("read %+v, want %+v", got, row)
+		}
+	}
+	if err := d.Decode(&csvRow{}); err != io.EOF {
+		t.Errorf("got %v after the last row, want EOF", err)
+	}
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// ETag builds a strong entity tag from a resource ID and its version.
+func ETag(id, version uint) string {
+	return fmt.Sprintf(`"%d-%d"`, id, version)
+}
+
+// ReadETag builds the entity tag of a read of a resource version whose body
+// also depends on other things, such as related rows or the display
+// currency. The tag changes with the body, and MatchVersion still accepts
+// it for the version it was read at.
+func ReadETag(id, version uint, body []byte) string {
+	sum := sha256.Sum256(body)
+	return fmt.Sprintf(`"%d-%d-%s"`, id, version, hex.EncodeToString(sum[:8]))
+}
+
+// MatchETag reports whether an If-Match or If-None-Match header value
+// matches etag. The header may be "*" or a comma separated list of tags,
+// weak tags are compared by their opaque value.
+func MatchETag(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchVersion reports whether an If-Match header value holds the ETag of
+// the resource version, or a ReadETag of it.
+func MatchVersion(header string, id, version uint) bool {
+	etag := ETag(id, version)
+	readPrefix := strings.TrimSuffix(etag, `"`) + "-"
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag || strings.HasPrefix(tag, readPrefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package utils
+
+import "testing"
+
+func TestReadETag(t *testing.T) {
+	idr := ReadETag(7, 3, []byte(`{"display_currency":"IDR"}`))
+	usd := ReadETag(7, 3, []byte(`{"display_currency":"USD"}`))
+	if idr == usd {
+		t.Errorf("reads with different bodies share the ETag %s", idr)
+	}
+	if !MatchETag(idr, idr) || MatchETag(usd, idr) {
+		t.Errorf("If-None-Match does not compare the whole read tag")
+	}
+
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{`"7-3"`, true},
+		{idr, true},
+		{"W/" + usd, true},
+		{`"7-2", ` + idr, true},
+		{"*", true},
+		{`"7-2"`, false},
+		{ReadETag(7, 2, []byte(`{}`)), false},
+		{`"7-31"`, false},
+		{ReadETag(17, 3, []byte(`{}`)), false},
+	}
+	for _, tt := range tests {
+		if got := MatchVersion(tt.header, 7, 3); got != tt.want {
+			t.Errorf("MatchVersion(%s) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
@@ -1,18 +1,38 @@
 package utils
 
 import (
+	"io"
 	"os"
 	"strconv"
 
 	"gopkg.in/gomail.v2"
 )
 
-func SendEmail(to, subject, content string) error {
+type Attachment struct {
+	Name string
+	Data []byte
+}
+
+// SendEmail sends a plain text email with an HTML alternative. The sender is
+// EMAIL_FROM, or SMTP_USER when it is not set.
+func SendEmail(to, subject, text, html string, attachments ...Attachment) error {
+	from := os.Getenv("EMAIL_FROM")
+	if from == "" {
+		from = os.Getenv("SMTP_USER")
+	}
 	m := gomail.NewMessage()
-	m.SetHeader("From", "rafie.fadlurahman@gmail.com")
+	m.SetHeader("From", from)
 	m.SetHeader("To", to)
 	m.SetHeader("Subject", subject)
-	m.SetBody("text/html", content)
+	m.SetBody("text/plain", text)
+	m.AddAlternative("text/html", html)
+	for _, a := range attachments {
+		data := a.Data
+		m.Attach(a.Name, gomail.SetCopyFunc(func(w io.Writer) error {
+			_, err := w.Write(data)
+			return err
+		}))
+	}
 
 	pass, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
 	d := gomail.NewDialer(
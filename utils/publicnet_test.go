@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := map[string]bool{
+		"93.184.216.34":   true,
+		"2606:2800:220::": true,
+		"127.0.0.1":       false,
+		"::1":             false,
+		"169.254.169.254": false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"100.64.0.1":      false,
+		"0.0.0.0":         false,
+		"fd00::1":         false,
+		"fe80::1":         false,
+		"::ffff:10.0.0.1": false,
+	}
+	for ip, want := range tests {
+		if got := IsPublicIP(net.ParseIP(ip)); got != want {
+			t.Errorf("IsPublicIP(%s) = %v, want %v", ip, got, want)
+		}
+	}
+}
+
+func TestCheckPublicURL(t *testing.T) {
+	tests := map[string]bool{
+		"https://93.184.216.34/hook":                   true,
+		"http://169.254.169.254/latest/meta-data":      false,
+		"http://127.0.0.1:8080/":                       false,
+		"http://[::1]/":                                false,
+		"http://localhost/":                            false,
+		"ftp://93.184.216.34/":                         false,
+		"not a url":                                    false,
+		"http://192.168.0.10/admin?next=https://x.com": false,
+	}
+	for raw, ok := range tests {
+		if err := CheckPublicURL(context.Background(), raw); (err == nil) != ok {
+			t.Errorf("CheckPublicURL(%q) = %v", raw, err)
+		}
+	}
+}
+
+func TestPublicClientRefusesInternal(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("internal server was reached")
+	}))
+	defer server.Close()
+
+	_, err := PublicClient(time.Second).Get(server.URL)
+	if !errors.Is(err, ErrNotPublic) {
+		t.Errorf("got %v, want ErrNotPublic", err)
+	}
+}
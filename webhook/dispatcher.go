@@ -0,0 +1,195 @@
+package webhook
+
+import (
+	"bytes"
+	"car-rental/entity"
+	"car-rental/utils"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Dispatcher sends pending deliveries in the background, retrying failures
+// with exponential backoff and logging every attempt.
+type Dispatcher struct {
+	DB          *gorm.DB
+	Client      *http.Client
+	Interval    time.Duration
+	BatchSize   int
+	MaxAttempts int
+	BaseDelay   time.Duration // first retry delay, doubled on every attempt
+	MaxDelay    time.Duration
+	Lease       time.Duration // how long a claimed batch is reserved for its dispatcher
+}
+
+// NewDispatcher reads WEBHOOK_MAX_ATTEMPTS and WEBHOOK_RETRY_DELAY, falling
+// back to sensible defaults. Endpoints are only posted to on public
+// addresses, even though admins set them.
+func NewDispatcher(db *gorm.DB) Dispatcher {
+	d := Dispatcher{
+		DB:          db,
+		Client:      utils.PublicClient(10 * time.Second),
+		Interval:    5 * time.Second,
+		BatchSize:   20,
+		MaxAttempts: 10,
+		BaseDelay:   time.Minute,
+		MaxDelay:    12 * time.Hour,
+		Lease:       5 * time.Minute,
+	}
+	if v, err := strconv.Atoi(os.Getenv("WEBHOOK_MAX_ATTEMPTS")); err == nil && v > 0 {
+		d.MaxAttempts = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("WEBHOOK_RETRY_DELAY")); err == nil && v > 0 {
+		d.BaseDelay = v
+	}
+	return d
+}
+
+// Run dispatches due deliveries every Interval until ctx is cancelled.
+func (d Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := d.DispatchOnce(ctx, time.Now())
+			if err != nil {
+				log.Printf("webhook: %v", err)
+			}
+			if err != nil || n < d.BatchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchOnce sends one batch of due deliveries. The batch is first claimed
+// for Lease in a short transaction, with SKIP LOCKED so several instances
+// never send the same one. Deliveries are then posted outside any
+// transaction and each attempt is recorded on its own, so one failed write
+// cannot resend the rest of the batch. Deliveries of a dispatcher that died
+// while sending are claimed again once the lease ends.
+func (d Dispatcher) DispatchOnce(ctx context.Context, now time.Time) (int, error) {
+	deliveries, err := d.claim(now)
+	if err != nil {
+		return 0, err
+	}
+	for _, delivery := range deliveries {
+		if err := d.deliver(ctx, delivery); err != nil {
+			log.Printf("webhook: delivery %d: %v", delivery.ID, err)
+		}
+	}
+	return len(deliveries), nil
+}
+
+// claim reserves a batch of due deliveries by marking them as sending until
+// the lease ends.
+func (d Dispatcher) claim(now time.Time) ([]entity.WebhookDelivery, error) {
+	var deliveries []entity.WebhookDelivery
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status IN ? AND next_attempt_at <= ?", []string{StatusPending, StatusSending}, now).
+			Order("next_attempt_at, id").
+			Limit(d.BatchSize).
+			Find(&deliveries)
+		if result.Error != nil || len(deliveries) == 0 {
+			return result.Error
+		}
+		ids := make([]uint, len(deliveries))
+		for i, delivery := range deliveries {
+			ids[i] = delivery.ID
+		}
+		return tx.Model(&entity.WebhookDelivery{}).Where("id IN ?", ids).
+			Updates(map[string]any{"status": StatusSending, "next_attempt_at": now.Add(d.Lease)}).Error
+	})
+	return deliveries, err
+}
+
+// deliver posts one claimed delivery and records the attempt and its outcome.
+func (d Dispatcher) deliver(ctx context.Context, delivery entity.WebhookDelivery) error {
+	var endpoint entity.WebhookEndpoint
+	if err := d.DB.Unscoped().Where("id = ?", delivery.EndpointID).First(&endpoint).Error; err != nil {
+		return err
+	}
+	attempt := d.attempt(ctx, endpoint, delivery)
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&attempt).Error; err != nil {
+			return err
+		}
+		return tx.Model(&entity.WebhookDelivery{}).Where("id = ? AND status = ?", delivery.ID, StatusSending).
+			Updates(d.outcome(delivery, attempt)).Error
+	})
+}
+
+// attempt posts one delivery and returns the log of it. The timestamp and
+// signature are taken when the request is sent.
+func (d Dispatcher) attempt(ctx context.Context, endpoint entity.WebhookEndpoint, delivery entity.WebhookDelivery) entity.WebhookAttempt {
+	now := time.Now()
+	attempt := entity.WebhookAttempt{DeliveryID: delivery.ID, CreatedAt: now}
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "car-rental-webhooks")
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-ID", delivery.EventID)
+	req.Header.Set("X-Webhook-Delivery", strconv.Itoa(int(delivery.ID)))
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set("X-Webhook-Signature", Sign(endpoint.Secret, now, body))
+
+	start := time.Now()
+	res, err := d.Client.Do(req)
+	attempt.DurationMS = time.Since(start).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer res.Body.Close()
+	resBody, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	attempt.StatusCode = res.StatusCode
+	attempt.Response = string(resBody)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		attempt.Error = res.Status
+	}
+	return attempt
+}
+
+// outcome returns the delivery columns to update after an attempt.
+func (d Dispatcher) outcome(delivery entity.WebhookDelivery, attempt entity.WebhookAttempt) map[string]any {
+	now := time.Now()
+	attempts := delivery.Attempts + 1
+	updates := map[string]any{"attempts": attempts, "last_status_code": attempt.StatusCode, "last_error": attempt.Error}
+	if attempt.Error == "" {
+		updates["status"] = StatusDelivered
+		updates["delivered_at"] = now
+		return updates
+	}
+	if attempts >= d.MaxAttempts {
+		updates["status"] = StatusDead
+		return updates
+	}
+	updates["status"] = StatusPending
+	delay := d.BaseDelay
+	for i := 1; i < attempts && delay < d.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxDelay {
+		delay = d.MaxDelay
+	}
+	updates["next_attempt_at"] = now.Add(delay)
+	return updates
+}
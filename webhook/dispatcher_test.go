@@ -0,0 +1,118 @@
+package webhook
+
+import (
+	"car-rental/entity"
+	"car-rental/testdb"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDispatchOnce(t *testing.T) {
+	db := testdb.Open(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.Atoi(r.Header.Get("X-Webhook-Delivery"))
+		// the claim is committed before anything is posted
+		var stored entity.WebhookDelivery
+		db.First(&stored, id)
+		if stored.Status != StatusSending {
+			t.Errorf("delivery %d posted while %s", id, stored.Status)
+		}
+		// the timestamp is taken when the request is sent, not when the batch was claimed
+		unix, _ := strconv.ParseInt(r.Header.Get("X-Webhook-Timestamp"), 10, 64)
+		sent := time.Unix(unix, 0)
+		if time.Since(sent) > time.Minute {
+			t.Errorf("delivery %d signed at %v", id, sent)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("X-Webhook-Signature") != Sign("secret", sent, body) {
+			t.Errorf("delivery %d has a bad signature", id)
+		}
+		if r.Header.Get("X-Webhook-Event") == "rent.returned" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	endpoint := entity.WebhookEndpoint{URL: server.URL, Events: []string{"*"}, Secret: "secret"}
+	db.Create(&endpoint)
+	// the dispatcher runs an hour behind, as if the batch waited that long
+	now := time.Now().Add(-time.Hour)
+	deliveries := []entity.WebhookDelivery{
+		{EventID: "ok", Event: "rent.created", Payload: `{}`, Status: StatusPending, NextAttemptAt: now.Add(-time.Minute)},
+		{EventID: "down", Event: "rent.returned", Payload: `{}`, Status: StatusPending, NextAttemptAt: now.Add(-time.Minute)},
+		{EventID: "later", Event: "rent.created", Payload: `{}`, Status: StatusPending, NextAttemptAt: now.Add(time.Hour)},
+		// claimed by a dispatcher that died, its lease has ended
+		{EventID: "stale", Event: "rent.created", Payload: `{}`, Status: StatusSending, NextAttemptAt: now.Add(-time.Second)},
+		// claimed by a dispatcher that is still sending
+		{EventID: "busy", Event: "rent.created", Payload: `{}`, Status: StatusSending, NextAttemptAt: now.Add(time.Minute)},
+	}
+	for i := range deliveries {
+		deliveries[i].EndpointID = endpoint.ID
+	}
+	db.Create(&deliveries)
+
+	d := NewDispatcher(db)
+	// the test server listens on loopback, which the default client refuses
+	d.Client = server.Client()
+	n, err := d.DispatchOnce(context.Background(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("tried %d deliveries, want 3", n)
+	}
+
+	want := map[string]string{
+		"ok":    StatusDelivered,
+		"down":  StatusPending,
+		"later": StatusPending,
+		"stale": StatusDelivered,
+		"busy":  StatusSending,
+	}
+	db.Find(&deliveries)
+	for _, delivery := range deliveries {
+		if delivery.Status != want[delivery.EventID] {
+			t.Errorf("%s is %s, want %s", delivery.EventID, delivery.Status, want[delivery.EventID])
+		}
+		if delivery.EventID == "down" && (delivery.Attempts != 1 || delivery.LastStatusCode != http.StatusInternalServerError || !delivery.NextAttemptAt.After(time.Now())) {
+			t.Errorf("failed delivery not scheduled for a retry: %+v", delivery)
+		}
+	}
+	var attempts int64
+	db.Model(&entity.WebhookAttempt{}).Count(&attempts)
+	if attempts != 3 {
+		t.Errorf("logged %d attempts, want 3", attempts)
+	}
+}
+
+func TestDispatchRefusesInternalEndpoints(t *testing.T) {
+	db := testdb.Open(t)
+	hit := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit = true
+	}))
+	defer server.Close()
+
+	endpoint := entity.WebhookEndpoint{URL: server.URL, Events: []string{"*"}, Secret: "secret"}
+	db.Create(&endpoint)
+	now := time.Now()
+	delivery := entity.WebhookDelivery{EndpointID: endpoint.ID, EventID: "evt_1", Event: "rent.created", Payload: `{}`, Status: StatusPending, NextAttemptAt: now}
+	db.Create(&delivery)
+
+	if _, err := NewDispatcher(db).DispatchOnce(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+	if hit {
+		t.Error("posted to a loopback endpoint")
+	}
+	db.First(&delivery, delivery.ID)
+	if delivery.Status != StatusPending || !strings.Contains(delivery.LastError, "public") {
+		t.Errorf("delivery %+v, want a retry with a refused connection", delivery)
+	}
+}
@@ -0,0 +1,51 @@
+package webhook
+
+import (
+	"car-rental/currency"
+	"car-rental/events"
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Subscribe queues a delivery to the partner endpoints for every domain
+// event they can subscribe to. The event ID partners see is derived from
+// the domain event, so a retried event keeps it.
+func Subscribe(bus *events.Bus) {
+	publish := func(event string, data func(events.Event) any) {
+		bus.Subscribe("webhooks", event, func(ctx context.Context, tx *gorm.DB, id uint, e events.Event) error {
+			return Publish(tx, fmt.Sprintf("evt_%d", id), event, data(e))
+		})
+	}
+	publish(RentalCreated, func(e events.Event) any {
+		created := e.(events.RentalCreated)
+		return map[string]any{
+			"rental_record": created.Record,
+			"price":         created.Price,
+			"invoice":       created.Invoice.Number,
+		}
+	})
+	publish(RentalReturned, func(e events.Event) any {
+		returned := e.(events.RentalReturned)
+		return map[string]any{
+			"rental_record": returned.Record,
+			"late_fee":      returned.LateFee,
+			"damage_fee":    returned.DamageFee,
+			"security_hold": returned.Hold,
+		}
+	})
+	publish(WalletToppedUp, func(e events.Event) any {
+		topUp := e.(events.WalletToppedUp)
+		return map[string]any{
+			"user_id":  topUp.User.ID,
+			"amount":   topUp.Amount,
+			"currency": currency.Or(topUp.User.Currency),
+			"deposit":  topUp.User.Deposit,
+			"invoice":  topUp.Invoice.Number,
+		}
+	})
+	publish(ProductUpdated, func(e events.Event) any {
+		return e.(events.ProductUpdated).Product
+	})
+}
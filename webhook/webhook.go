@@ -0,0 +1,152 @@
+package webhook
+
+import (
+	"car-rental/entity"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Event types partners can subscribe to.
+const (
+	RentalCreated  = "rental.created"
+	RentalReturned = "rental.returned"
+	WalletToppedUp = "wallet.topped_up"
+	ProductUpdated = "product.updated"
+	AllEvents      = "*"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusSending   = "sending" // claimed by a dispatcher until next_attempt_at
+	StatusDelivered = "delivered"
+	StatusDead      = "dead" // gave up after MaxAttempts, can be replayed
+)
+
+// EventTypes lists the events an endpoint can subscribe to.
+var EventTypes = []string{RentalCreated, RentalReturned, WalletToppedUp, ProductUpdated}
+
+// Payload is the JSON body of every delivery.
+type Payload struct {
+	ID        string    `json:"id"` // same for every delivery and replay of an event
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// NewSecret generates a signing secret for a new endpoint.
+func NewSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// ValidateEndpoint checks an endpoint set by an admin.
+func ValidateEndpoint(endpoint entity.WebhookEndpoint) error {
+	u, err := url.ParseRequestURI(endpoint.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("url must be an http or https URL")
+	}
+	if len(endpoint.Events) == 0 {
+		return fmt.Errorf("endpoint needs at least one event")
+	}
+	for _, event := range endpoint.Events {
+		if event != AllEvents && !known(event) {
+			return fmt.Errorf("unknown event %s", event)
+		}
+	}
+	return nil
+}
+
+func known(event string) bool {
+	for _, e := range EventTypes {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func subscribed(endpoint entity.WebhookEndpoint, event string) bool {
+	for _, e := range endpoint.Events {
+		if e == event || e == AllEvents {
+			return true
+		}
+	}
+	return false
+}
+
+// Publish queues a delivery of the event to every enabled endpoint
+// subscribed to it, inside tx so nothing goes out for a rolled back change.
+// id identifies the event to partners; publishing it again queues nothing
+// for the endpoints that already have it.
+func Publish(tx *gorm.DB, id, event string, data any) error {
+	var endpoints []entity.WebhookEndpoint
+	result := tx.Where("disabled = ?", false).Find(&endpoints)
+	if result.Error != nil {
+		return result.Error
+	}
+	var body []byte
+	for _, endpoint := range endpoints {
+		if !subscribed(endpoint, event) {
+			continue
+		}
+		if body == nil {
+			var err error
+			body, err = json.Marshal(Payload{ID: id, Type: event, CreatedAt: time.Now(), Data: data})
+			if err != nil {
+				return err
+			}
+		}
+		result = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&entity.WebhookDelivery{
+			EndpointID:    endpoint.ID,
+			EventID:       id,
+			Event:         event,
+			Payload:       string(body),
+			Status:        StatusPending,
+			NextAttemptAt: time.Now(),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+	}
+	return nil
+}
+
+// Sign returns the X-Webhook-Signature value for a body sent at timestamp:
+// the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the endpoint
+// secret. Partners recompute it and compare, and reject old timestamps to
+// stop replays by third parties.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Replay queues a new delivery of a past one, with the same event ID so the
+// partner can tell it apart from a new event.
+func Replay(db *gorm.DB, delivery entity.WebhookDelivery) (entity.WebhookDelivery, error) {
+	replay := entity.WebhookDelivery{
+		EndpointID:    delivery.EndpointID,
+		EventID:       delivery.EventID,
+		Event:         delivery.Event,
+		Payload:       delivery.Payload,
+		Status:        StatusPending,
+		NextAttemptAt: time.Now(),
+		ReplayOf:      &delivery.ID,
+	}
+	return replay, db.Create(&replay).Error
+}
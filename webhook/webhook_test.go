@@ -0,0 +1,54 @@
+package webhook
+
+import (
+	"car-rental/entity"
+	"car-rental/events"
+	"car-rental/testdb"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestPublishOncePerEvent(t *testing.T) {
+	db := testdb.Open(t)
+	all := entity.WebhookEndpoint{URL: "https://partner.example.com/all", Events: []string{AllEvents}, Secret: "a"}
+	returns := entity.WebhookEndpoint{URL: "https://partner.example.com/returns", Events: []string{RentalReturned}, Secret: "b"}
+	db.Create(&all)
+	db.Create(&returns)
+	bus := events.NewBus(db)
+	Subscribe(bus)
+
+	tx := db.Begin()
+	pending, err := bus.Stage(tx, events.ProductUpdated{Product: entity.Product{ID: 7, Name: "Clio"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Commit()
+	bus.Flush(context.Background(), pending)
+	// the event is delivered again, as if it had never been marked done
+	db.Model(&entity.DomainEvent{}).Where("1 = 1").Updates(map[string]any{"processed_at": nil, "done": "[]"})
+	bus.Flush(context.Background(), pending)
+
+	var deliveries []entity.WebhookDelivery
+	db.Find(&deliveries)
+	if len(deliveries) != 1 || deliveries[0].EndpointID != all.ID {
+		t.Fatalf("queued %+v, want one delivery to the endpoint subscribed to everything", deliveries)
+	}
+	var row entity.DomainEvent
+	db.First(&row)
+	var payload Payload
+	json.Unmarshal([]byte(deliveries[0].Payload), &payload)
+	if deliveries[0].EventID != fmt.Sprintf("evt_%d", row.ID) || payload.ID != deliveries[0].EventID {
+		t.Errorf("event ID %s in a payload with %s, want the ID of domain event %d", deliveries[0].EventID, payload.ID, row.ID)
+	}
+
+	// a replay repeats the event ID
+	replay, err := Replay(db, deliveries[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replay.EventID != deliveries[0].EventID || replay.ReplayOf == nil {
+		t.Errorf("replay %+v", replay)
+	}
+}